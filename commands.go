@@ -0,0 +1,201 @@
+// Copyright (C) 2026 Toitware ApS. All rights reserved.
+// Use of this source code is governed by an MIT-style license that can be
+// found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/toitlang/tpkg/pkg/tpkg"
+	"github.com/toitware/tpkg/config"
+	"github.com/toitware/tpkg/controllers"
+	"go.uber.org/fx"
+)
+
+func syncCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "sync",
+		Short: "Sync the local checkout of the registry repository",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runCommand(func(registry controllers.Registry) error {
+				ctx := commandContext()
+				if err := registry.Sync(ctx); err != nil {
+					return err
+				}
+				packages, err := registry.Packages(ctx)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "Synced %d packages at %s\n", len(packages), registry.Generation(ctx))
+				return nil
+			})
+		},
+	}
+}
+
+func registerCmd() *cobra.Command {
+	var dryRun bool
+	cmd := &cobra.Command{
+		Use:   "register <url> [version]",
+		Short: "Register a version of a package",
+		Long: `Register a version of a package.
+
+The version is the git tag, like 'v1.2.3'. Registers the newest version tag of
+the repository if no version is given.`,
+		Args: cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var version string
+			if len(args) > 1 {
+				version = args[1]
+			}
+			return runCommand(func(registry controllers.Registry) error {
+				ctx := commandContext()
+				if err := registry.Sync(ctx); err != nil {
+					return err
+				}
+				desc, err := registry.RegisterPackage(ctx, args[0], version, dryRun)
+				if err != nil {
+					return err
+				}
+				if dryRun {
+					fmt.Fprintf(cmd.OutOrStdout(), "%s version %s can be registered\n", desc.URL, desc.Version)
+				} else {
+					fmt.Fprintf(cmd.OutOrStdout(), "Registered %s version %s\n", desc.URL, desc.Version)
+				}
+				return nil
+			})
+		},
+	}
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "only run the checks")
+	return cmd
+}
+
+func validateCmd() *cobra.Command {
+	var url, version string
+	cmd := &cobra.Command{
+		Use:   "validate <path>",
+		Short: "Run the registration checks on a local package checkout",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runCommand(func(registry controllers.Registry) error {
+				ctx := commandContext()
+				if err := registry.Sync(ctx); err != nil {
+					return err
+				}
+				desc, err := registry.ValidatePackage(ctx, args[0], url, version)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "%s passes the registration checks\n", desc.Name)
+				return nil
+			})
+		},
+	}
+	cmd.Flags().StringVar(&url, "url", "", "the URL the package is registered with")
+	cmd.Flags().StringVar(&version, "version", "", "the version to register, like 'v1.2.3'")
+	cmd.MarkFlagRequired("url")
+	return cmd
+}
+
+func docsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "docs",
+		Short: "Manage the generated docs of packages",
+	}
+
+	buildCmd := &cobra.Command{
+		Use:   "build <url>[@<version>]",
+		Short: "Generate the docs of a package version",
+		Long: `Generate the docs of a package version.
+
+Builds the docs of the latest version if no version is given. Docs that are
+already generated are kept.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			url, version := args[0], controllers.LatestVersion
+			if i := strings.LastIndex(url, "@"); i >= 0 {
+				url, version = url[:i], url[i+1:]
+			}
+			return runCommand(func(registry controllers.Registry, toitdoc controllers.Toitdoc) error {
+				ctx := commandContext()
+				if err := registry.Sync(ctx); err != nil {
+					return err
+				}
+				info, err := registry.Version(ctx, url, version)
+				if err != nil {
+					return err
+				}
+				doc, err := toitdoc.Load(ctx, info.Desc)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "Built the docs of %s version %s in %s\n", info.Desc.URL, info.Desc.Version, doc.JSONPath())
+				return nil
+			})
+		},
+	}
+
+	gcCmd := &cobra.Command{
+		Use:   "gc",
+		Short: "Remove the docs of versions that aren't in the registry anymore",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runCommand(func(registry controllers.Registry, toitdoc controllers.Toitdoc) error {
+				ctx := commandContext()
+				if err := registry.Sync(ctx); err != nil {
+					return err
+				}
+				packages, err := registry.Packages(ctx)
+				if err != nil {
+					return err
+				}
+				var keep []*tpkg.Desc
+				for _, p := range packages {
+					keep = append(keep, p.Descriptions...)
+				}
+				removed, err := toitdoc.GC(keep)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "Removed the docs of %d versions\n", removed)
+				return nil
+			})
+		},
+	}
+
+	cmd.AddCommand(buildCmd, gcCmd)
+	return cmd
+}
+
+func configCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Inspect the configuration",
+	}
+	cmd.AddCommand(&cobra.Command{
+		Use:   "check",
+		Short: "Check that the configuration loads and the controllers can be created",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runCommand(func(cfg *config.Config, _ controllers.Registry, _ controllers.Toitdoc) {
+				fmt.Fprintln(cmd.OutOrStdout(), "The configuration is valid")
+			}, fx.Invoke(checkConfig))
+		},
+	}, &cobra.Command{
+		Use:   "dump",
+		Short: "Print the effective configuration, with secrets redacted",
+		Long: `Print the effective configuration, with secrets redacted.
+
+The configuration is the merge of the config files, listed at the top, with
+the environment variables substituted. It isn't checked.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return config.Dump(cmd.OutOrStdout())
+		},
+	})
+	return cmd
+}
@@ -0,0 +1,79 @@
+// Copyright (C) 2026 Toitware ApS. All rights reserved.
+// Use of this source code is governed by an MIT-style license that can be
+// found in the LICENSE file.
+
+package config
+
+import (
+	"fmt"
+	"io"
+
+	"gopkg.in/yaml.v2"
+)
+
+// redacted replaces the values of secrets in dumps.
+const redacted = "<redacted>"
+
+// secretKeys are the keys of the settings that hold secrets.
+var secretKeys = map[string]bool{
+	"ssh_key":          true,
+	"key":              true,
+	"password":         true,
+	"token":            true,
+	"secret":           true,
+	"challenge_secret": true,
+}
+
+// Dump writes the effective configuration, after merging the files and
+// substituting the environment variables, as YAML. Secrets are redacted.
+// The configuration isn't validated.
+func Dump(w io.Writer) error {
+	v, files, err := readConfig()
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if _, err := fmt.Fprintf(w, "# %s\n", file); err != nil {
+			return err
+		}
+	}
+	out, err := yaml.Marshal(redact(v.AllSettings()))
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(out)
+	return err
+}
+
+// redact replaces the non-empty values of the secretKeys in the settings.
+func redact(in interface{}) interface{} {
+	switch val := in.(type) {
+	case map[string]interface{}:
+		res := map[string]interface{}{}
+		for k, v := range val {
+			res[k] = redactValue(k, v)
+		}
+		return res
+	case map[interface{}]interface{}:
+		res := map[interface{}]interface{}{}
+		for k, v := range val {
+			res[k] = redactValue(fmt.Sprint(k), v)
+		}
+		return res
+	case []interface{}:
+		res := make([]interface{}, len(val))
+		for i, v := range val {
+			res[i] = redact(v)
+		}
+		return res
+	default:
+		return in
+	}
+}
+
+func redactValue(key string, value interface{}) interface{} {
+	if secretKeys[key] && value != nil && value != "" {
+		return redacted
+	}
+	return redact(value)
+}
@@ -0,0 +1,75 @@
+// Copyright (C) 2026 Toitware ApS. All rights reserved.
+// Use of this source code is governed by an MIT-style license that can be
+// found in the LICENSE file.
+
+package config
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// The ways to authenticate with a registry repository.
+const (
+	// GitAuthSSHKey uses the SSH key of the ssh_key_file_path.
+	GitAuthSSHKey = "ssh-key"
+	// GitAuthSSHAgent uses the keys of the agent at SSH_AUTH_SOCK.
+	GitAuthSSHAgent = "ssh-agent"
+	// GitAuthBasic uses the username and password over HTTP(S).
+	GitAuthBasic = "basic"
+	// GitAuthToken uses the token over HTTP(S).
+	GitAuthToken = "token"
+	// GitAuthNone accesses the repository anonymously. Registries without
+	// auth are read-only, unless they are local.
+	GitAuthNone = "none"
+)
+
+// GitUsername is the default user of the SSH and HTTP auth methods.
+const GitUsername = "git"
+
+// AuthMethod returns the configured auth method. If none is configured, it
+// is derived from the credentials that are set, falling back to the SSH
+// agent for 'ssh://' URLs and to anonymous access otherwise.
+func (g *Git) AuthMethod(url string, sshKeyFile string) string {
+	switch {
+	case g.Auth != "":
+		return g.Auth
+	case sshKeyFile != "":
+		return GitAuthSSHKey
+	case g.Token != "":
+		return GitAuthToken
+	case g.Password != "":
+		return GitAuthBasic
+	case strings.HasPrefix(url, "ssh://"):
+		return GitAuthSSHAgent
+	default:
+		return GitAuthNone
+	}
+}
+
+// User returns the configured username, or GitUsername.
+func (g *Git) User() string {
+	if g.Username != "" {
+		return g.Username
+	}
+	return GitUsername
+}
+
+// IsSSH returns whether the auth method uses SSH.
+func IsSSH(auth string) bool {
+	return auth == GitAuthSSHKey || auth == GitAuthSSHAgent
+}
+
+// RemoteURL returns the URL a repository is cloned from. Absolute paths are
+// local repositories and URLs with a scheme are used as they are. URLs
+// without scheme, like 'github.com/toitware/registry', use SSH for the SSH
+// auth methods and HTTPS otherwise.
+func RemoteURL(url string, auth string) string {
+	if filepath.IsAbs(url) || strings.Contains(url, "://") {
+		return url
+	}
+	if IsSSH(auth) {
+		return "ssh://" + url
+	}
+	return "https://" + url
+}
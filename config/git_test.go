@@ -0,0 +1,49 @@
+// Copyright (C) 2026 Toitware ApS. All rights reserved.
+// Use of this source code is governed by an MIT-style license that can be
+// found in the LICENSE file.
+
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_gitRemote(t *testing.T) {
+	tests := []struct {
+		git        Git
+		url        string
+		sshKeyFile string
+		auth       string
+		remote     string
+	}{
+		{Git{}, "github.com/toitware/registry", "/secrets/id", GitAuthSSHKey, "ssh://github.com/toitware/registry"},
+		{Git{}, "github.com/toitware/registry", "", GitAuthNone, "https://github.com/toitware/registry"},
+		{Git{Token: "t"}, "git.example.com/registry", "", GitAuthToken, "https://git.example.com/registry"},
+		{Git{Username: "u", Password: "p"}, "https://git.example.com/registry", "", GitAuthBasic, "https://git.example.com/registry"},
+		{Git{}, "ssh://git.example.com/registry", "", GitAuthSSHAgent, "ssh://git.example.com/registry"},
+		{Git{Auth: GitAuthSSHAgent}, "github.com/toitware/registry", "/secrets/id", GitAuthSSHAgent, "ssh://github.com/toitware/registry"},
+		{Git{}, "/srv/registry", "", GitAuthNone, "/srv/registry"},
+	}
+	for _, test := range tests {
+		auth := test.git.AuthMethod(test.url, test.sshKeyFile)
+		assert.Equal(t, test.auth, auth, test.url)
+		assert.Equal(t, test.remote, RemoteURL(test.url, auth), test.url)
+	}
+}
+
+func Test_validateGit(t *testing.T) {
+	problems := func(g Git, url string) []string {
+		v := &validator{}
+		g.validate(v, "registry", url, "", "")
+		return v.problems
+	}
+	assert.Empty(t, problems(Git{Token: "t"}, "git.example.com/registry"))
+	assert.Empty(t, problems(Git{}, "github.com/toitware/registry"))
+
+	assert.Len(t, problems(Git{Auth: "kerberos"}, "github.com/toitware/registry"), 1)
+	assert.Len(t, problems(Git{Auth: GitAuthBasic}, "github.com/toitware/registry"), 2)
+	assert.Len(t, problems(Git{Token: "t"}, "ssh://git.example.com/registry"), 1)
+	assert.Len(t, problems(Git{Auth: GitAuthSSHKey}, "https://git.example.com/registry"), 2)
+}
@@ -5,11 +5,14 @@
 package config
 
 import (
+	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strings"
 	"time"
 
+	"github.com/mitchellh/mapstructure"
 	"github.com/spf13/viper"
 	"go.uber.org/fx"
 )
@@ -17,6 +20,7 @@ import (
 var Module = fx.Provide(
 	loadConfig,
 	provideConfig,
+	provideWatcher,
 )
 
 type Config struct {
@@ -24,12 +28,28 @@ type Config struct {
 	DebugPort *int   `mapstructure:"debug_port"`
 	WebPath   string `mapstructure:"web_path"`
 	HTTPS     bool   `mapstructure:"https"`
+	// PublicURL is the URL the registry is reachable at, like
+	// 'https://pkg.toit.io'. The feeds, the sitemap and the package pages link
+	// to it.
+	PublicURL string `mapstructure:"public_url"`
 
-	Registry Registry `mapstructure:"registry"`
+	Registry  Registry   `mapstructure:"registry"`
+	Upstreams []Upstream `mapstructure:"upstreams"`
+	Verifier  Verifier   `mapstructure:"verifier"`
+	Policy    Policy     `mapstructure:"policy"`
+	Names     Names      `mapstructure:"names"`
+	Ownership Ownership  `mapstructure:"ownership"`
+	Auth      Auth       `mapstructure:"auth"`
+	Audit     Audit      `mapstructure:"audit"`
+	Webhooks  Webhooks   `mapstructure:"webhooks"`
+	Stats     Stats      `mapstructure:"stats"`
+	HTTPCache HTTPCache  `mapstructure:"http_cache"`
+	CORS      CORS       `mapstructure:"cors"`
 
 	Logging  Logging  `mapstructure:"logging"`
 	Metrics  Metrics  `mapstructure:"metrics"`
 	Toitdocs Toitdocs `mapstructure:"toitdocs"`
+	Readmes  Readmes  `mapstructure:"readmes"`
 }
 
 type Logging struct {
@@ -45,13 +65,187 @@ type Metrics struct {
 }
 
 type Registry struct {
+	// Name identifies the registry as the source of its packages.
+	Name string `mapstructure:"name"`
+	// Priority decides which registry serves a package that is in several
+	// registries. See Upstream.
+	Priority     int           `mapstructure:"priority"`
 	Url          string        `mapstructure:"url"`
 	Branch       string        `mapstructure:"branch"`
 	CachePath    string        `mapstructure:"cache_path"`
 	SSHKeyFile   string        `mapstructure:"ssh_key_file_path"`
 	SSHKey       string        `mapstructure:"ssh_key"`
+	Git          Git           `mapstructure:"git"`
 	AllowRewrite bool          `mapstructure:"allow_rewrite"`
 	SyncInterval time.Duration `mapstructure:"sync_interval"`
+	// MinSyncInterval limits how often the registry syncs on request.
+	MinSyncInterval time.Duration `mapstructure:"min_sync_interval"`
+	Signing         Signing       `mapstructure:"signing"`
+}
+
+// Upstream is a read-only registry whose packages are served together with
+// the ones of the registry. A package that is in several registries is
+// served by the one with the highest priority; the registry wins ties, then
+// the upstream that is listed first.
+type Upstream struct {
+	Name string `mapstructure:"name"`
+	Url  string `mapstructure:"url"`
+	// Branch defaults to the default branch of the repository.
+	Branch string `mapstructure:"branch"`
+	// SSHKeyFile is the SSH key that grants read access. Public registries
+	// are cloned over HTTPS if it is empty.
+	SSHKeyFile string `mapstructure:"ssh_key_file_path"`
+	Git        Git    `mapstructure:"git"`
+	Priority   int    `mapstructure:"priority"`
+}
+
+// Git configures the access to a registry repository. See AuthMethod and
+// RemoteURL.
+type Git struct {
+	// Auth is one of the GitAuth methods. It is derived from the other
+	// settings if empty.
+	Auth string `mapstructure:"auth"`
+	// Username is the user of the SSH and HTTP basic auth. Defaults to 'git'.
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+	// Token is an access token, sent as the password of HTTP basic auth.
+	Token string `mapstructure:"token"`
+	// KnownHostsFile lists the known_hosts files that verify SSH hosts,
+	// separated like PATH. Defaults to the files of SSH_KNOWN_HOSTS,
+	// ~/.ssh/known_hosts and /etc/ssh/ssh_known_hosts.
+	KnownHostsFile string `mapstructure:"known_hosts_file"`
+	// InsecureIgnoreHostKey disables the verification of SSH hosts.
+	InsecureIgnoreHostKey bool `mapstructure:"insecure_ignore_host_key"`
+}
+
+type Signing struct {
+	// The SSH private key (preferably ed25519) used to sign the registry.
+	// Signing is disabled if neither the key nor the key file is set.
+	KeyFile string `mapstructure:"key_file"`
+	Key     string `mapstructure:"key"`
+	// Detached writes a signature file next to each description.
+	Detached bool `mapstructure:"detached"`
+	// Commits signs the registry commits.
+	Commits bool `mapstructure:"commits"`
+}
+
+type Verifier struct {
+	// Interval between two verifications. Verification is disabled if 0.
+	Interval time.Duration `mapstructure:"interval"`
+	// AutoYank yanks versions whose tag was deleted or moved.
+	AutoYank bool `mapstructure:"auto_yank"`
+	// ReportPath is the file the last report is kept in across restarts.
+	// The report is only kept in memory if empty.
+	ReportPath string `mapstructure:"report_path"`
+}
+
+// Policy configures the checks that new registrations must pass.
+type Policy struct {
+	// RequireLicense requires a valid SPDX license expression.
+	RequireLicense     bool `mapstructure:"require_license"`
+	RequireDescription bool `mapstructure:"require_description"`
+	// AllowedHosts and AllowedOrganizations restrict the package URLs, for
+	// example to 'github.com' or 'github.com/toitware'. All URLs are allowed
+	// if both are empty.
+	AllowedHosts         []string `mapstructure:"allowed_hosts"`
+	AllowedOrganizations []string `mapstructure:"allowed_organizations"`
+	// RegistryDependenciesOnly forbids dependencies on packages that are not
+	// in the registry.
+	RegistryDependenciesOnly bool `mapstructure:"registry_dependencies_only"`
+	// MinSDK is the minimal SDK version packages must require.
+	MinSDK string `mapstructure:"min_sdk"`
+}
+
+// Names configures the checks against name-squatting.
+type Names struct {
+	// MaxDistance is the edit distance up to which the (normalized) names of
+	// two packages are considered confusingly similar.
+	MaxDistance int `mapstructure:"max_distance"`
+	// Reserved names can't be used by new packages.
+	Reserved []string `mapstructure:"reserved"`
+	// Action is either 'reject' or 'review'.
+	Action string `mapstructure:"action"`
+}
+
+type Ownership struct {
+	// ChallengeSecret signs the ownership challenge tokens. If empty, a
+	// random secret is used and tokens become invalid after a restart.
+	ChallengeSecret string `mapstructure:"challenge_secret"`
+	// OpenUnowned lets everybody register new versions of packages without
+	// owners, like the packages registered anonymously or before ownership
+	// existed, until somebody claims them.
+	OpenUnowned bool `mapstructure:"open_unowned"`
+}
+
+type Audit struct {
+	// Path of the JSONL audit log. Auditing is disabled if empty.
+	Path      string `mapstructure:"path"`
+	MaxSizeMB int    `mapstructure:"max_size_mb"`
+	// MaxFiles is the number of rotated files to keep.
+	MaxFiles int `mapstructure:"max_files"`
+}
+
+type Webhooks struct {
+	// QueuePath is the path of the database of pending and past deliveries.
+	QueuePath      string        `mapstructure:"queue_path"`
+	MaxAttempts    int           `mapstructure:"max_attempts"`
+	InitialBackoff time.Duration `mapstructure:"initial_backoff"`
+	MaxBackoff     time.Duration `mapstructure:"max_backoff"`
+	Timeout        time.Duration `mapstructure:"timeout"`
+	// HistorySize is the number of finished deliveries to keep.
+	HistorySize   int                   `mapstructure:"history_size"`
+	Subscriptions []WebhookSubscription `mapstructure:"subscriptions"`
+}
+
+type WebhookSubscription struct {
+	Name string `mapstructure:"name"`
+	URL  string `mapstructure:"url"`
+	// Secret signs the payloads. Payloads are unsigned if empty.
+	Secret string `mapstructure:"secret"`
+	// Events are the change kinds to deliver. Defaults to version_added
+	// and version_yanked.
+	Events []string `mapstructure:"events"`
+	// Packages are path.Match patterns of the package URLs to deliver.
+	// Defaults to all packages.
+	Packages []string `mapstructure:"packages"`
+}
+
+type Stats struct {
+	// Path is the path of the database of the counts. Counting is disabled
+	// if empty.
+	Path string `mapstructure:"path"`
+	// FlushInterval is the interval at which the counts are written to the
+	// database.
+	FlushInterval time.Duration `mapstructure:"flush_interval"`
+}
+
+// HTTPCache contains the Cache-Control headers of the routes. No header is
+// sent if empty.
+type HTTPCache struct {
+	API  string `mapstructure:"api"`
+	Docs string `mapstructure:"docs"`
+	// VersionedDocs are the docs of an explicit version, '<url>@<version>',
+	// which don't change.
+	VersionedDocs string `mapstructure:"versioned_docs"`
+	Feeds         string `mapstructure:"feeds"`
+	Sitemap       string `mapstructure:"sitemap"`
+	Badges        string `mapstructure:"badges"`
+}
+
+type CORS struct {
+	// AllowedOrigins are the origins, like 'https://pkg.toit.io', that may
+	// call the API from a browser. All origins are allowed if empty.
+	AllowedOrigins []string `mapstructure:"allowed_origins"`
+}
+
+type Auth struct {
+	Tokens []Token `mapstructure:"tokens"`
+}
+
+type Token struct {
+	Identity string `mapstructure:"identity"`
+	Token    string `mapstructure:"token"`
+	Admin    bool   `mapstructure:"admin"`
 }
 
 type SDK struct {
@@ -72,68 +266,199 @@ type Toitdocs struct {
 	SDK        SDK    `mapstructure:"sdk"`
 }
 
+// Readmes configures the cache of the READMEs and CHANGELOGs of packages.
+type Readmes struct {
+	CachePath       string        `mapstructure:"cache_path"`
+	DownloadTimeout time.Duration `mapstructure:"download_timeout"`
+	// MaxDownloadsPerMinute limits the downloads of READMEs that aren't
+	// cached yet. With 0, only the docs generation fills the cache.
+	MaxDownloadsPerMinute int `mapstructure:"max_downloads_per_minute"`
+}
+
 func provideConfig(cfg *viper.Viper) (*Config, error) {
 	res := &Config{}
+	var problems []string
 	if err := cfg.Unmarshal(res); err != nil {
-		return nil, err
+		decodeErr, ok := err.(*mapstructure.Error)
+		if !ok {
+			return nil, err
+		}
+		// Report the fields that can't be decoded together with the other
+		// problems.
+		problems = append(problems, decodeErr.Errors...)
 	}
 
+	if err := res.Validate(); err != nil {
+		problems = append(problems, err.(*ValidationError).Problems...)
+	}
+	if len(problems) > 0 {
+		return nil, &ValidationError{Problems: problems}
+	}
 	return res, nil
 }
 
+// EnvVariable selects the overlay 'config.<env>.yaml' of an environment,
+// like 'production'.
+const EnvVariable = "CONFIG_ENV"
+
 func loadConfig(log fx.Printer) (*viper.Viper, error) {
-	res := viper.New()
+	res, files, err := readConfig()
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		log.Printf("loading config file %s\n", file)
+	}
+	return res, nil
+}
+
+// readConfig reads the config files and substitutes the environment
+// variables. The base file, 'config.yaml' from CONFIG_PATH or ./config, is
+// overlayed with the file of the environment and the optional local file.
+// Returns the files that were read.
+func readConfig() (*viper.Viper, []string, error) {
+	base := viper.New()
 
 	if cfgPath, ok := os.LookupEnv("CONFIG_PATH"); ok {
-		res.AddConfigPath(cfgPath)
+		base.AddConfigPath(cfgPath)
 	}
-	res.AddConfigPath("./config")
+	base.AddConfigPath("./config")
 
-	res.SetConfigName("config")
+	base.SetConfigName("config")
 
-	log.Printf("loading config file %s.yaml\n", "base")
-	if err := res.ReadInConfig(); err != nil {
-		return nil, err
+	if err := base.ReadInConfig(); err != nil {
+		return nil, nil, err
 	}
 
-	envSubstitution(res)
+	settings := base.AllSettings()
+	files := []string{base.ConfigFileUsed()}
+	env, local := overlayFiles(base.ConfigFileUsed())
+	if env != "" {
+		// The overlay of an explicitly selected environment must exist.
+		if err := mergeConfigFile(settings, env); err != nil {
+			return nil, nil, err
+		}
+		files = append(files, env)
+	}
+	if _, err := os.Stat(local); err == nil {
+		if err := mergeConfigFile(settings, local); err != nil {
+			return nil, nil, err
+		}
+		files = append(files, local)
+	}
 
-	return res, nil
+	res := viper.New()
+	res.SetConfigFile(base.ConfigFileUsed())
+	if err := res.MergeConfigMap(settings); err != nil {
+		return nil, nil, err
+	}
+	if err := envSubstitution(res); err != nil {
+		return nil, nil, err
+	}
+
+	return res, files, nil
 }
 
-func envSubstitution(v *viper.Viper) {
+// overlayFiles returns the paths of the environment and local overlays of
+// the base config file. The environment overlay is empty if no environment
+// is selected.
+func overlayFiles(base string) (env string, local string) {
+	dir, ext := filepath.Dir(base), filepath.Ext(base)
+	if name := os.Getenv(EnvVariable); name != "" {
+		env = filepath.Join(dir, "config."+name+ext)
+	}
+	return env, filepath.Join(dir, "config.local"+ext)
+}
+
+// mergeConfigFile merges the settings of the file into the settings.
+func mergeConfigFile(settings map[string]interface{}, path string) error {
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return fmt.Errorf("failed to read config file '%s': %w", path, err)
+	}
+	mergeSettings(settings, v.AllSettings())
+	return nil
+}
+
+// mergeSettings overrides the settings in dst with the ones of src. Unlike
+// viper's merge, values may change their type, like '${PORT:8733}' to 9000.
+// Lists are replaced as a whole.
+func mergeSettings(dst map[string]interface{}, src map[string]interface{}) {
+	for k, sv := range src {
+		srcMap, srcIsMap := sv.(map[string]interface{})
+		dstMap, dstIsMap := dst[k].(map[string]interface{})
+		if srcIsMap && dstIsMap {
+			mergeSettings(dstMap, srcMap)
+		} else {
+			dst[k] = sv
+		}
+	}
+}
+
+// envSubstitution replaces the '${VAR:default}' references in the values.
+// A variable VAR that isn't set is read from the file at VAR_FILE, if that
+// is set, so secrets can be mounted as files.
+func envSubstitution(v *viper.Viper) error {
+	var problems []string
+	lookup := func(env string) (string, bool) {
+		val, ok, err := lookupEnv(env)
+		if err != nil {
+			problems = append(problems, err.Error())
+		}
+		return val, ok
+	}
 	for _, k := range v.AllKeys() {
-		v.Set(k, recEnvSubstitution(v.Get(k)))
+		v.Set(k, recEnvSubstitution(v.Get(k), lookup))
+	}
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+func lookupEnv(env string) (string, bool, error) {
+	if val, ok := os.LookupEnv(env); ok {
+		return val, true, nil
+	}
+	path, ok := os.LookupEnv(env + "_FILE")
+	if !ok || path == "" {
+		return "", false, nil
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", false, fmt.Errorf("%s: failed to read %s_FILE: %v", env, env, err)
 	}
+	return strings.TrimRight(string(content), "\r\n"), true, nil
 }
 
-func recEnvSubstitution(in interface{}) interface{} {
+func recEnvSubstitution(in interface{}, lookup func(env string) (string, bool)) interface{} {
 	switch val := in.(type) {
 	case string:
-		return ExpandEnv(val)
+		return ExpandWithDefault(val, lookup)
 	case []string:
 		for i, v := range val {
-			val[i] = ExpandEnv(v)
+			val[i] = ExpandWithDefault(v, lookup)
 		}
 		return val
 	case map[string]string:
 		for k, v := range val {
-			val[k] = ExpandEnv(v)
+			val[k] = ExpandWithDefault(v, lookup)
 		}
 		return val
 	case []interface{}:
 		for i, v := range val {
-			val[i] = recEnvSubstitution(v)
+			val[i] = recEnvSubstitution(v, lookup)
 		}
 		return val
 	case map[interface{}]interface{}:
 		for k, v := range val {
-			val[k] = recEnvSubstitution(v)
+			val[k] = recEnvSubstitution(v, lookup)
 		}
 		return val
 	case map[string]interface{}:
 		for k, v := range val {
-			val[k] = recEnvSubstitution(v)
+			val[k] = recEnvSubstitution(v, lookup)
 		}
 		return val
 	default:
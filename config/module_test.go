@@ -0,0 +1,84 @@
+// Copyright (C) 2026 Toitware ApS. All rights reserved.
+// Use of this source code is governed by an MIT-style license that can be
+// found in the LICENSE file.
+
+package config
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, path string, content string) {
+	require.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+}
+
+func setEnv(t *testing.T, env string, value string) {
+	old, ok := os.LookupEnv(env)
+	require.NoError(t, os.Setenv(env, value))
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv(env, old)
+		} else {
+			os.Unsetenv(env)
+		}
+	})
+}
+
+func Test_readConfigLayers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	writeFile(t, filepath.Join(dir, "config.yaml"), `
+port: ${TEST_PORT:8733}
+registry:
+  url: github.com/toitware/registry
+  branch: main
+auth:
+  tokens:
+    - identity: admin
+      token: ${TEST_ADMIN_TOKEN:}
+`)
+	writeFile(t, filepath.Join(dir, "config.staging.yaml"), `
+port: 9000
+registry:
+  branch: staging
+`)
+	writeFile(t, filepath.Join(dir, "config.local.yaml"), `
+registry:
+  url: /tmp/registry
+`)
+	writeFile(t, filepath.Join(dir, "admin-token"), "secret\n")
+	setEnv(t, "CONFIG_PATH", dir)
+	setEnv(t, EnvVariable, "staging")
+	setEnv(t, "TEST_ADMIN_TOKEN_FILE", filepath.Join(dir, "admin-token"))
+
+	v, files, err := readConfig()
+	require.NoError(t, err)
+	assert.Len(t, files, 3)
+	cfg := &Config{}
+	require.NoError(t, v.Unmarshal(cfg))
+	assert.Equal(t, 9000, cfg.Port)
+	assert.Equal(t, "staging", cfg.Registry.Branch)
+	assert.Equal(t, "/tmp/registry", cfg.Registry.Url)
+	require.Len(t, cfg.Auth.Tokens, 1)
+	assert.Equal(t, "secret", cfg.Auth.Tokens[0].Token)
+
+	var buf bytes.Buffer
+	require.NoError(t, Dump(&buf))
+	assert.Contains(t, buf.String(), "token: <redacted>")
+	assert.Contains(t, buf.String(), "branch: staging")
+	assert.NotContains(t, buf.String(), "secret")
+
+	// The overlay of a selected environment must exist.
+	setEnv(t, EnvVariable, "production")
+	_, _, err = readConfig()
+	assert.Error(t, err)
+}
@@ -0,0 +1,411 @@
+// Copyright (C) 2026 Toitware ApS. All rights reserved.
+// Use of this source code is governed by an MIT-style license that can be
+// found in the LICENSE file.
+
+package config
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-version"
+	"go.uber.org/zap/zapcore"
+)
+
+// toitVersionTimeout is the time 'toit version' may take during validation.
+const toitVersionTimeout = 10 * time.Second
+
+// ValidationError lists all problems of a configuration.
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// validator collects the problems of the configuration. Fields are named by
+// their keys in the config file.
+type validator struct {
+	problems []string
+	// probe enables the checks of the file system and the binaries.
+	// Without it, only the values are checked.
+	probe bool
+}
+
+func (v *validator) addf(key string, format string, args ...interface{}) {
+	v.problems = append(v.problems, key+": "+fmt.Sprintf(format, args...))
+}
+
+func (v *validator) required(key string, value string) bool {
+	if value == "" {
+		v.addf(key, "must be set")
+		return false
+	}
+	return true
+}
+
+func (v *validator) port(key string, port int) {
+	if port < 0 || port > 65535 {
+		v.addf(key, "%d is not a valid port", port)
+	}
+}
+
+func (v *validator) positive(key string, d time.Duration) {
+	if d <= 0 {
+		v.addf(key, "must be positive, got %s", d)
+	}
+}
+
+func (v *validator) notNegative(key string, d time.Duration) {
+	if d < 0 {
+		v.addf(key, "must not be negative, got %s", d)
+	}
+}
+
+// file checks that the path is an existing regular file.
+func (v *validator) file(key string, path string) {
+	if !v.probe {
+		return
+	}
+	stat, err := os.Stat(path)
+	if err != nil {
+		v.addf(key, "%v", err)
+	} else if stat.IsDir() {
+		v.addf(key, "'%s' is a directory", path)
+	}
+}
+
+// dir checks that the path is an existing directory.
+func (v *validator) dir(key string, path string) {
+	if !v.probe {
+		return
+	}
+	stat, err := os.Stat(path)
+	if err != nil {
+		v.addf(key, "%v", err)
+	} else if !stat.IsDir() {
+		v.addf(key, "'%s' is not a directory", path)
+	}
+}
+
+// writableDir checks that the directory can be created and written to.
+func (v *validator) writableDir(key string, dir string) {
+	if !v.probe {
+		return
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		v.addf(key, "%v", err)
+		return
+	}
+	f, err := ioutil.TempFile(dir, ".config-check-*")
+	if err != nil {
+		v.addf(key, "'%s' is not writable: %v", dir, err)
+		return
+	}
+	f.Close()
+	os.Remove(f.Name())
+}
+
+// Validate checks the values of all fields of the configuration. It doesn't
+// touch the file system, so it's cheap enough for every load and reload.
+func (c *Config) Validate() error {
+	return c.validate(&validator{})
+}
+
+// Check validates the configuration like Validate, and checks that the
+// configured paths and binaries of the server are usable. Creates missing
+// directories.
+func (c *Config) Check() error {
+	return c.validate(&validator{probe: true})
+}
+
+func (c *Config) validate(v *validator) error {
+	v.port("port", c.Port)
+	if c.DebugPort != nil {
+		v.port("debug_port", *c.DebugPort)
+	}
+	if c.WebPath != "" {
+		v.dir("web_path", c.WebPath)
+	}
+	if c.PublicURL != "" {
+		if u, err := url.Parse(c.PublicURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.RawQuery != "" {
+			v.addf("public_url", "'%s' is not an http(s) URL like 'https://pkg.toit.io'", c.PublicURL)
+		}
+	}
+
+	c.Logging.validate(v)
+	c.Registry.validate(v)
+	c.validateUpstreams(v)
+	c.Verifier.validate(v)
+	c.Policy.validate(v)
+	c.Names.validate(v)
+	c.Auth.validate(v)
+	c.Audit.validate(v)
+	c.Webhooks.validate(v)
+	c.CORS.validate(v)
+	c.Stats.validate(v)
+	c.Readmes.validate(v)
+	c.Toitdocs.validate(v)
+
+	if len(v.problems) > 0 {
+		return &ValidationError{Problems: v.problems}
+	}
+	return nil
+}
+
+func (l *Logging) validate(v *validator) {
+	if l.Backend != "" && l.Backend != "humio" {
+		v.addf("logging.backend", "unknown backend '%s', must be empty or 'humio'", l.Backend)
+	}
+	if l.Level != "" {
+		var level zapcore.Level
+		if err := level.UnmarshalText([]byte(l.Level)); err != nil {
+			v.addf("logging.level", "%v", err)
+		}
+	}
+}
+
+func (r *Registry) validate(v *validator) {
+	v.required("registry.name", r.Name)
+	v.required("registry.url", r.Url)
+	v.required("registry.branch", r.Branch)
+	if v.required("registry.cache_path", r.CachePath) {
+		v.writableDir("registry.cache_path", r.CachePath)
+	}
+	r.Git.validate(v, "registry", r.Url, r.SSHKeyFile, r.SSHKey)
+	v.notNegative("registry.sync_interval", r.SyncInterval)
+	v.notNegative("registry.min_sync_interval", r.MinSyncInterval)
+	if r.Signing.KeyFile != "" && r.Signing.Key == "" {
+		v.file("registry.signing.key_file", r.Signing.KeyFile)
+	}
+}
+
+func (c *Config) validateUpstreams(v *validator) {
+	names := map[string]bool{c.Registry.Name: true}
+	for i, u := range c.Upstreams {
+		key := fmt.Sprintf("upstreams[%d]", i)
+		if v.required(key+".name", u.Name) {
+			if names[u.Name] {
+				v.addf(key+".name", "duplicate registry name '%s'", u.Name)
+			}
+			names[u.Name] = true
+		}
+		if v.required(key+".url", u.Url) && u.Url == c.Registry.Url {
+			v.addf(key+".url", "'%s' is the url of the registry", u.Url)
+		}
+		u.Git.validate(v, key, u.Url, u.SSHKeyFile, "")
+	}
+}
+
+// validate checks the auth method of the repository at url, and that it
+// fits the scheme of the URL. The key is the section of the repository.
+func (g *Git) validate(v *validator, key string, url string, sshKeyFile string, sshKey string) {
+	auth := g.AuthMethod(url, sshKeyFile)
+	switch auth {
+	case GitAuthSSHKey:
+		if v.required(key+".ssh_key_file_path", sshKeyFile) && sshKey == "" {
+			// The file is written from the key, if it is given.
+			v.file(key+".ssh_key_file_path", sshKeyFile)
+		}
+	case GitAuthSSHAgent:
+		if os.Getenv("SSH_AUTH_SOCK") == "" {
+			v.addf(key+".git.auth", "'%s' requires SSH_AUTH_SOCK to be set", auth)
+		}
+	case GitAuthBasic:
+		v.required(key+".git.username", g.Username)
+		v.required(key+".git.password", g.Password)
+	case GitAuthToken:
+		v.required(key+".git.token", g.Token)
+	case GitAuthNone:
+	default:
+		v.addf(key+".git.auth", "unknown auth '%s', must be one of '%s', '%s', '%s', '%s' or '%s'",
+			auth, GitAuthSSHKey, GitAuthSSHAgent, GitAuthBasic, GitAuthToken, GitAuthNone)
+		return
+	}
+	if IsSSH(auth) {
+		for _, file := range filepath.SplitList(g.KnownHostsFile) {
+			v.file(key+".git.known_hosts_file", file)
+		}
+	}
+
+	if url == "" || filepath.IsAbs(url) {
+		return
+	}
+	remote := RemoteURL(url, auth)
+	scheme := remote[:strings.Index(remote, "://")]
+	switch scheme {
+	case "ssh":
+		if !IsSSH(auth) {
+			v.addf(key+".git.auth", "'%s' can't be used with the SSH URL '%s', use '%s' or '%s'", auth, remote, GitAuthSSHKey, GitAuthSSHAgent)
+		}
+	case "http", "https":
+		if IsSSH(auth) {
+			v.addf(key+".git.auth", "'%s' can't be used with the HTTP URL '%s'", auth, remote)
+		}
+	default:
+		if auth != GitAuthNone {
+			v.addf(key+".git.auth", "'%s' can't be used with the URL '%s'", auth, remote)
+		}
+	}
+}
+
+func (c *Verifier) validate(v *validator) {
+	v.notNegative("verifier.interval", c.Interval)
+	if c.ReportPath != "" {
+		v.writableDir("verifier.report_path", filepath.Dir(c.ReportPath))
+	}
+}
+
+func (p *Policy) validate(v *validator) {
+	for _, host := range p.AllowedHosts {
+		if host == "" || strings.Contains(host, "/") {
+			v.addf("policy.allowed_hosts", "'%s' is not a host", host)
+		}
+	}
+	for _, org := range p.AllowedOrganizations {
+		if strings.Count(org, "/") != 1 || strings.HasPrefix(org, "/") || strings.HasSuffix(org, "/") {
+			v.addf("policy.allowed_organizations", "'%s' is not of the form '<host>/<organization>'", org)
+		}
+	}
+	if p.MinSDK != "" {
+		if _, err := version.NewVersion(p.MinSDK); err != nil {
+			v.addf("policy.min_sdk", "'%s' is not a version: %v", p.MinSDK, err)
+		}
+	}
+}
+
+func (n *Names) validate(v *validator) {
+	if n.MaxDistance < 0 {
+		v.addf("names.max_distance", "must not be negative, got %d", n.MaxDistance)
+	}
+	if n.Action != "" && n.Action != "reject" && n.Action != "review" {
+		v.addf("names.action", "unknown action '%s', must be 'reject' or 'review'", n.Action)
+	}
+}
+
+func (a *Auth) validate(v *validator) {
+	tokens := map[string]bool{}
+	for i, t := range a.Tokens {
+		if t.Token == "" {
+			// Tokens without value are disabled.
+			continue
+		}
+		key := fmt.Sprintf("auth.tokens[%d]", i)
+		v.required(key+".identity", t.Identity)
+		if tokens[t.Token] {
+			v.addf(key+".token", "duplicate token")
+		}
+		tokens[t.Token] = true
+	}
+}
+
+func (a *Audit) validate(v *validator) {
+	if a.Path == "" {
+		return
+	}
+	v.writableDir("audit.path", filepath.Dir(a.Path))
+	if a.MaxSizeMB <= 0 {
+		v.addf("audit.max_size_mb", "must be positive, got %d", a.MaxSizeMB)
+	}
+	if a.MaxFiles < 0 {
+		v.addf("audit.max_files", "must not be negative, got %d", a.MaxFiles)
+	}
+}
+
+func (w *Webhooks) validate(v *validator) {
+	names := map[string]bool{}
+	for i, s := range w.Subscriptions {
+		key := fmt.Sprintf("webhooks.subscriptions[%d]", i)
+		if v.required(key+".name", s.Name) {
+			if names[s.Name] {
+				v.addf(key+".name", "duplicate subscription '%s'", s.Name)
+			}
+			names[s.Name] = true
+		}
+		if v.required(key+".url", s.URL) {
+			if u, err := url.Parse(s.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				v.addf(key+".url", "'%s' is not an http(s) URL", s.URL)
+			}
+		}
+	}
+	if len(w.Subscriptions) == 0 {
+		return
+	}
+	if v.required("webhooks.queue_path", w.QueuePath) {
+		v.writableDir("webhooks.queue_path", filepath.Dir(w.QueuePath))
+	}
+	if w.MaxAttempts <= 0 {
+		v.addf("webhooks.max_attempts", "must be positive, got %d", w.MaxAttempts)
+	}
+	v.positive("webhooks.initial_backoff", w.InitialBackoff)
+	v.positive("webhooks.max_backoff", w.MaxBackoff)
+	v.positive("webhooks.timeout", w.Timeout)
+	if w.HistorySize < 0 {
+		v.addf("webhooks.history_size", "must not be negative, got %d", w.HistorySize)
+	}
+}
+
+func (c *CORS) validate(v *validator) {
+	for _, origin := range c.AllowedOrigins {
+		if origin == "*" {
+			continue
+		}
+		if u, err := url.Parse(origin); err != nil || u.Scheme == "" || u.Host == "" || (u.Path != "" && u.Path != "/") {
+			v.addf("cors.allowed_origins", "'%s' is not an origin like 'https://example.com'", origin)
+		}
+	}
+}
+
+func (s *Stats) validate(v *validator) {
+	if s.Path == "" {
+		return
+	}
+	v.writableDir("stats.path", filepath.Dir(s.Path))
+	v.positive("stats.flush_interval", s.FlushInterval)
+}
+
+func (r *Readmes) validate(v *validator) {
+	if v.required("readmes.cache_path", r.CachePath) {
+		v.writableDir("readmes.cache_path", r.CachePath)
+	}
+	v.positive("readmes.download_timeout", r.DownloadTimeout)
+	if r.MaxDownloadsPerMinute < 0 {
+		v.addf("readmes.max_downloads_per_minute", "must not be negative, got %d", r.MaxDownloadsPerMinute)
+	}
+}
+
+func (t *Toitdocs) validate(v *validator) {
+	if v.required("toitdocs.cache_path", t.CachePath) {
+		v.writableDir("toitdocs.cache_path", t.CachePath)
+	}
+	// Only the server serves and generates docs. The commands don't need the
+	// viewer and the SDK.
+	if !v.probe {
+		return
+	}
+	if v.required("toitdocs.viewer_path", t.ViewerPath) {
+		v.file("toitdocs.viewer_path", filepath.Join(t.ViewerPath, "index.html"))
+	}
+
+	// The docs are generated with the toit binary of the SDK.
+	key := "toitdocs.sdk.path"
+	if t.SDK.ToitPath_ != "" {
+		key = "toitdocs.sdk.toit_path"
+	} else if !v.required(key, t.SDK.Path) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), toitVersionTimeout)
+	defer cancel()
+	toit := t.SDK.ToitPath()
+	if out, err := exec.CommandContext(ctx, toit, "version").CombinedOutput(); err != nil {
+		v.addf(key, "'%s version' failed: %v %s", toit, err, strings.TrimSpace(string(out)))
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright (C) 2026 Toitware ApS. All rights reserved.
+// Use of this source code is governed by an MIT-style license that can be
+// found in the LICENSE file.
+
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_validate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	toit := filepath.Join(dir, "toit")
+	require.NoError(t, ioutil.WriteFile(toit, []byte("#!/bin/sh\necho v2.0.0\n"), 0755))
+	viewer := filepath.Join(dir, "viewer")
+	require.NoError(t, os.MkdirAll(viewer, 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(viewer, "index.html"), nil, 0644))
+	key := filepath.Join(dir, "id")
+	require.NoError(t, ioutil.WriteFile(key, nil, 0600))
+
+	cfg := &Config{
+		Port:      8733,
+		PublicURL: "https://pkg.toit.io",
+		Registry: Registry{
+			Name:       "registry",
+			Url:        "github.com/toitware/registry",
+			Branch:     "main",
+			CachePath:  filepath.Join(dir, "registry"),
+			SSHKeyFile: key,
+		},
+		Names: Names{Action: "reject"},
+		Readmes: Readmes{
+			CachePath:       filepath.Join(dir, "readmes"),
+			DownloadTimeout: time.Minute,
+		},
+		Toitdocs: Toitdocs{
+			CachePath:  filepath.Join(dir, "toitdocs"),
+			ViewerPath: viewer,
+			SDK:        SDK{ToitPath_: toit},
+		},
+	}
+	require.NoError(t, cfg.Check())
+
+	cfg.PublicURL = "pkg.toit.io"
+	cfg.Registry.Url = ""
+	cfg.Registry.SyncInterval = -1
+	cfg.Names.Action = "ignore"
+	cfg.Toitdocs.SDK = SDK{Path: filepath.Join(dir, "sdk")}
+	err = cfg.Check()
+	require.IsType(t, &ValidationError{}, err)
+	problems := err.(*ValidationError).Problems
+	// All problems are reported together.
+	require.Len(t, problems, 5)
+	assert.Contains(t, problems[0], "public_url")
+	assert.Contains(t, problems[1], "registry.url")
+	assert.Contains(t, problems[2], "registry.sync_interval")
+	assert.Contains(t, problems[3], "names.action")
+	assert.Contains(t, problems[4], "toitdocs.sdk.path")
+
+	// Without probing, the SDK and the directories aren't checked.
+	err = cfg.Validate()
+	require.IsType(t, &ValidationError{}, err)
+	assert.Len(t, err.(*ValidationError).Problems, 4)
+	cfg.Toitdocs = Toitdocs{CachePath: filepath.Join(dir, "missing", "toitdocs")}
+	cfg.Validate()
+	_, err = os.Stat(filepath.Join(dir, "missing"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func Test_validateAuth(t *testing.T) {
+	auth := Auth{
+		Tokens: []Token{
+			{Identity: "admin", Token: "secret", Admin: true},
+			// Tokens without value are disabled and not checked.
+			{Identity: "", Token: ""},
+			{Identity: "", Token: "alice-token"},
+			{Identity: "bob", Token: "secret"},
+		},
+	}
+	v := &validator{}
+	auth.validate(v)
+	require.Len(t, v.problems, 2)
+	assert.Contains(t, v.problems[0], "auth.tokens[2].identity")
+	assert.Contains(t, v.problems[1], "auth.tokens[3].token: duplicate token")
+}
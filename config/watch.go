@@ -0,0 +1,251 @@
+// Copyright (C) 2026 Toitware ApS. All rights reserved.
+// Use of this source code is governed by an MIT-style license that can be
+// found in the LICENSE file.
+
+package config
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// LiveKeys are the settings that are applied without a restart. Changes of
+// other settings are only logged.
+var LiveKeys = []string{
+	"logging.level",
+	"registry.sync_interval",
+	"registry.min_sync_interval",
+	"registry.allow_rewrite",
+	"auth.tokens",
+	"ownership.open_unowned",
+	"cors.allowed_origins",
+}
+
+// Change is a reload of the configuration.
+type Change struct {
+	Old *Config
+	New *Config
+	// Keys are the changed settings, like 'registry.sync_interval'.
+	Keys []string
+}
+
+// Changed returns whether the setting, or any setting below it, changed.
+func (c *Change) Changed(key string) bool {
+	for _, k := range c.Keys {
+		if k == key || strings.HasPrefix(k, key+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// Watcher reloads the configuration when a config file changes or the
+// process receives SIGHUP, and notifies the subscribers of the changes.
+type Watcher struct {
+	logger *zap.Logger
+	// files are the config files that trigger a reload, including overlays
+	// that don't exist yet.
+	files []string
+
+	// applyMutex serializes the changes and the calls of the subscribers.
+	applyMutex  sync.Mutex
+	mutex       sync.Mutex
+	current     *Config
+	subscribers []func(*Change)
+
+	fileWatcher *fsnotify.Watcher
+	signals     chan os.Signal
+}
+
+func provideWatcher(lc fx.Lifecycle, v *viper.Viper, cfg *Config, logger *zap.Logger) *Watcher {
+	res := NewWatcher(cfg, logger)
+	env, local := overlayFiles(v.ConfigFileUsed())
+	res.files = []string{v.ConfigFileUsed(), local}
+	if env != "" {
+		res.files = append(res.files, env)
+	}
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			return res.start()
+		},
+		OnStop: func(ctx context.Context) error {
+			res.stop()
+			return nil
+		},
+	})
+	return res
+}
+
+// NewWatcher returns a watcher of the given configuration, which only
+// changes when Apply is called.
+func NewWatcher(cfg *Config, logger *zap.Logger) *Watcher {
+	return &Watcher{
+		logger:  logger,
+		current: cfg,
+	}
+}
+
+// Current returns the configuration that was applied last.
+func (w *Watcher) Current() *Config {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.current
+}
+
+// Subscribe calls f with every change of the configuration. The calls are
+// serialized.
+func (w *Watcher) Subscribe(f func(*Change)) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.subscribers = append(w.subscribers, f)
+}
+
+func (w *Watcher) start() error {
+	// The directory is watched, as editors and deployments replace the
+	// files, and overlays may be created later.
+	fileWatcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	if err := fileWatcher.Add(filepath.Dir(w.files[0])); err != nil {
+		fileWatcher.Close()
+		return err
+	}
+	w.fileWatcher = fileWatcher
+	go w.watchFiles()
+
+	w.signals = make(chan os.Signal, 1)
+	signal.Notify(w.signals, syscall.SIGHUP)
+	go func() {
+		for range w.signals {
+			w.reload("SIGHUP")
+		}
+	}()
+	return nil
+}
+
+func (w *Watcher) watchFiles() {
+	for {
+		select {
+		case e, ok := <-w.fileWatcher.Events:
+			if !ok {
+				return
+			}
+			if e.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Remove|fsnotify.Rename) != 0 && w.isConfigFile(e.Name) {
+				w.reload("file " + e.Name)
+			}
+		case err, ok := <-w.fileWatcher.Errors:
+			if !ok {
+				return
+			}
+			w.logger.Error("failed to watch the config files", zap.Error(err))
+		}
+	}
+}
+
+func (w *Watcher) isConfigFile(path string) bool {
+	for _, f := range w.files {
+		if filepath.Clean(path) == filepath.Clean(f) {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *Watcher) stop() {
+	w.fileWatcher.Close()
+	signal.Stop(w.signals)
+	close(w.signals)
+}
+
+// reload reads and validates the configuration again. An invalid
+// configuration is logged and ignored.
+func (w *Watcher) reload(reason string) {
+	w.logger.Info("reloading configuration", zap.String("reason", reason))
+	v, _, err := readConfig()
+	if err == nil {
+		var cfg *Config
+		if cfg, err = provideConfig(v); err == nil {
+			w.Apply(cfg)
+			return
+		}
+	}
+	w.logger.Error("failed to reload configuration, keeping the current one", zap.Error(err))
+}
+
+// Apply replaces the current configuration and notifies the subscribers if
+// any setting changed.
+func (w *Watcher) Apply(cfg *Config) {
+	w.applyMutex.Lock()
+	defer w.applyMutex.Unlock()
+
+	w.mutex.Lock()
+	old := w.current
+	w.current = cfg
+	subscribers := w.subscribers
+	w.mutex.Unlock()
+
+	change := &Change{
+		Old:  old,
+		New:  cfg,
+		Keys: changedKeys("", reflect.ValueOf(*old), reflect.ValueOf(*cfg)),
+	}
+	if len(change.Keys) == 0 {
+		w.logger.Info("configuration unchanged")
+		return
+	}
+
+	var live, restart []string
+	for _, key := range change.Keys {
+		if isLive(key) {
+			live = append(live, key)
+		} else {
+			restart = append(restart, key)
+		}
+	}
+	if len(live) > 0 {
+		w.logger.Info("applying configuration changes", zap.Strings("keys", live))
+	}
+	if len(restart) > 0 {
+		w.logger.Warn("configuration changes need a restart", zap.Strings("keys", restart))
+	}
+	for _, f := range subscribers {
+		f(change)
+	}
+}
+
+func isLive(key string) bool {
+	for _, k := range LiveKeys {
+		if key == k || strings.HasPrefix(key, k+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// changedKeys returns the keys of the settings that differ between the
+// structs a and b. Lists and maps are compared as a whole.
+func changedKeys(prefix string, a reflect.Value, b reflect.Value) []string {
+	var res []string
+	for i := 0; i < a.NumField(); i++ {
+		field := a.Type().Field(i)
+		key := prefix + field.Tag.Get("mapstructure")
+		if field.Type.Kind() == reflect.Struct {
+			res = append(res, changedKeys(key+".", a.Field(i), b.Field(i))...)
+		} else if !reflect.DeepEqual(a.Field(i).Interface(), b.Field(i).Interface()) {
+			res = append(res, key)
+		}
+	}
+	return res
+}
@@ -0,0 +1,50 @@
+// Copyright (C) 2026 Toitware ApS. All rights reserved.
+// Use of this source code is governed by an MIT-style license that can be
+// found in the LICENSE file.
+
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func Test_watcher(t *testing.T) {
+	old := &Config{
+		Port:     8733,
+		Registry: Registry{SyncInterval: 5 * time.Minute},
+		Auth:     Auth{Tokens: []Token{{Identity: "admin", Token: "secret"}}},
+	}
+	watcher := NewWatcher(old, zap.NewNop())
+
+	var changes []*Change
+	watcher.Subscribe(func(c *Change) {
+		changes = append(changes, c)
+	})
+
+	watcher.Apply(&Config{
+		Port:     8733,
+		Registry: Registry{SyncInterval: time.Minute},
+		Auth:     Auth{Tokens: []Token{{Identity: "admin", Token: "secret"}}},
+	})
+	assert.Len(t, changes, 1)
+	assert.Equal(t, []string{"registry.sync_interval"}, changes[0].Keys)
+	assert.True(t, changes[0].Changed("registry"))
+	assert.False(t, changes[0].Changed("auth"))
+	assert.Equal(t, old, changes[0].Old)
+	assert.Equal(t, time.Minute, watcher.Current().Registry.SyncInterval)
+
+	// Subscribers aren't notified if nothing changed.
+	watcher.Apply(watcher.Current())
+	assert.Len(t, changes, 1)
+
+	// Settings that need a restart are passed on as well.
+	watcher.Apply(&Config{Port: 8080})
+	assert.Len(t, changes, 2)
+	assert.Equal(t, []string{"port", "registry.sync_interval", "auth.tokens"}, changes[1].Keys)
+	assert.False(t, isLive("port"))
+	assert.True(t, isLive("auth.tokens"))
+}
@@ -0,0 +1,383 @@
+// Copyright (C) 2026 Toitware ApS. All rights reserved.
+// Use of this source code is governed by an MIT-style license that can be
+// found in the LICENSE file.
+
+package controllers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/toitware/tpkg/config"
+	"github.com/toitware/tpkg/pkg/auth"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultAuditPageSize = 50
+	maxAuditPageSize     = 1000
+)
+
+// AuditEvent is a single mutation of the registry.
+type AuditEvent struct {
+	ID         uint64            `json:"id"`
+	Time       time.Time         `json:"time"`
+	Identity   string            `json:"identity,omitempty"`
+	RemoteAddr string            `json:"remote_addr,omitempty"`
+	Operation  string            `json:"operation"`
+	URL        string            `json:"url,omitempty"`
+	Arguments  map[string]string `json:"arguments,omitempty"`
+	// Outcome is the gRPC code of the result, "OK" on success.
+	Outcome  string        `json:"outcome"`
+	Error    string        `json:"error,omitempty"`
+	Commit   string        `json:"commit,omitempty"`
+	Duration time.Duration `json:"duration_ns"`
+}
+
+// AuditFilter selects audit events. Zero values match everything.
+type AuditFilter struct {
+	URL   string
+	Since time.Time
+	Until time.Time
+}
+
+func (f AuditFilter) matches(e *AuditEvent) bool {
+	if f.URL != "" && e.URL != f.URL {
+		return false
+	}
+	if !f.Since.IsZero() && e.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !e.Time.Before(f.Until) {
+		return false
+	}
+	return true
+}
+
+type AuditLog interface {
+	Record(ctx context.Context, event *AuditEvent)
+	// List returns the matching events, newest first, and the token of the
+	// next page. The token is empty on the last page.
+	List(ctx context.Context, filter AuditFilter, pageSize int, pageToken string) ([]*AuditEvent, string, error)
+}
+
+func provideAuditLog(lc fx.Lifecycle, cfg *config.Config, logger *zap.Logger) (*auditLog, AuditLog, error) {
+	res, err := newAuditLog(cfg.Audit, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+	lc.Append(fx.Hook{
+		OnStop: func(ctx context.Context) error {
+			return res.Close()
+		},
+	})
+	return res, res, nil
+}
+
+// auditLog appends the events to a JSONL file. When the file grows beyond
+// the maximum size it's rotated to '<path>.1', '<path>.2', ...
+type auditLog struct {
+	logger   *zap.Logger
+	path     string
+	maxSize  int64
+	maxFiles int
+
+	mutex  sync.Mutex
+	file   *os.File
+	size   int64
+	lastID uint64
+	// rotated are the events of the rotated files, oldest first. They only
+	// change when the log is rotated, which resets them to nil.
+	rotated []*AuditEvent
+}
+
+// newAuditLog returns the audit log of the configuration. If no path is
+// configured, events are dropped.
+func newAuditLog(cfg config.Audit, logger *zap.Logger) (*auditLog, error) {
+	res := &auditLog{
+		logger:   logger,
+		path:     cfg.Path,
+		maxSize:  int64(cfg.MaxSizeMB) * 1024 * 1024,
+		maxFiles: cfg.MaxFiles,
+	}
+	if res.path == "" {
+		return res, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(res.path), 0755); err != nil {
+		return nil, err
+	}
+
+	rotated, err := res.readRotated()
+	if err != nil {
+		return nil, err
+	}
+	current, err := readAuditFile(res.path)
+	if err != nil {
+		return nil, err
+	}
+	res.rotated = rotated
+	for _, e := range append(rotated, current...) {
+		if e.ID > res.lastID {
+			res.lastID = e.ID
+		}
+	}
+	if err := res.open(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (a *auditLog) open() error {
+	f, err := os.OpenFile(a.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	a.file = f
+	a.size = stat.Size()
+	return nil
+}
+
+func (a *auditLog) Close() error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.file == nil {
+		return nil
+	}
+	err := a.file.Close()
+	a.file = nil
+	return err
+}
+
+func (a *auditLog) Record(ctx context.Context, event *AuditEvent) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.file == nil {
+		return
+	}
+
+	a.lastID++
+	event.ID = a.lastID
+	line, err := json.Marshal(event)
+	if err != nil {
+		a.logger.Error("failed to encode audit event", zap.Error(err))
+		return
+	}
+	line = append(line, '\n')
+
+	if a.maxSize > 0 && a.size > 0 && a.size+int64(len(line)) > a.maxSize {
+		if err := a.rotate(); err != nil {
+			a.logger.Error("failed to rotate audit log", zap.Error(err))
+		}
+	}
+	n, err := a.file.Write(line)
+	a.size += int64(n)
+	if err != nil {
+		a.logger.Error("failed to write audit event", zap.Error(err), zap.String("operation", event.Operation))
+	}
+}
+
+// rotate moves the current file to '<path>.1', shifting the older files and
+// dropping the ones beyond the maximum number of files.
+func (a *auditLog) rotate() error {
+	if err := a.file.Close(); err != nil {
+		return err
+	}
+	a.rotated = nil
+	if a.maxFiles > 0 {
+		os.Remove(a.rotatedPath(a.maxFiles))
+		for i := a.maxFiles - 1; i >= 1; i-- {
+			if err := os.Rename(a.rotatedPath(i), a.rotatedPath(i+1)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		if err := os.Rename(a.path, a.rotatedPath(1)); err != nil {
+			return err
+		}
+	} else if err := os.Remove(a.path); err != nil {
+		return err
+	}
+	return a.open()
+}
+
+func (a *auditLog) rotatedPath(i int) string {
+	return fmt.Sprintf("%s.%d", a.path, i)
+}
+
+// readRotated returns the events of the rotated files, oldest first.
+func (a *auditLog) readRotated() ([]*AuditEvent, error) {
+	var res []*AuditEvent
+	for i := a.maxFiles; i >= 1; i-- {
+		events, err := readAuditFile(a.rotatedPath(i))
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, events...)
+	}
+	return res, nil
+}
+
+// events returns all events, oldest first. Only the current file is read,
+// the events of the rotated files are cached until the next rotation.
+func (a *auditLog) events() ([]*AuditEvent, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.rotated == nil {
+		rotated, err := a.readRotated()
+		if err != nil {
+			return nil, err
+		}
+		a.rotated = rotated
+	}
+	current, err := readAuditFile(a.path)
+	if err != nil {
+		return nil, err
+	}
+	// The cached slice is never appended to, so the events can be joined
+	// without copying.
+	return append(a.rotated[:len(a.rotated):len(a.rotated)], current...), nil
+}
+
+func readAuditFile(path string) ([]*AuditEvent, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var res []*AuditEvent
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var e AuditEvent
+		// Skip partially written lines.
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		res = append(res, &e)
+	}
+	return res, scanner.Err()
+}
+
+func (a *auditLog) List(ctx context.Context, filter AuditFilter, pageSize int, pageToken string) ([]*AuditEvent, string, error) {
+	if a.path == "" {
+		return nil, "", status.Errorf(codes.FailedPrecondition, "the audit log is disabled")
+	}
+	if pageSize <= 0 {
+		pageSize = defaultAuditPageSize
+	} else if pageSize > maxAuditPageSize {
+		pageSize = maxAuditPageSize
+	}
+	// The page token is the ID of the last returned event.
+	var before uint64
+	if pageToken != "" {
+		var err error
+		if before, err = strconv.ParseUint(pageToken, 10, 64); err != nil {
+			return nil, "", status.Errorf(codes.InvalidArgument, "invalid page token '%s'", pageToken)
+		}
+	}
+
+	events, err := a.events()
+	if err != nil {
+		return nil, "", err
+	}
+
+	var res []*AuditEvent
+	for i := len(events) - 1; i >= 0; i-- {
+		e := events[i]
+		if before != 0 && e.ID >= before {
+			continue
+		}
+		if !filter.matches(e) {
+			continue
+		}
+		if len(res) == pageSize {
+			return res, strconv.FormatUint(res[len(res)-1].ID, 10), nil
+		}
+		res = append(res, e)
+	}
+	return res, "", nil
+}
+
+type auditEventKey struct{}
+
+// auditEventFromContext returns the event of the operation in progress, or nil.
+func auditEventFromContext(ctx context.Context) *AuditEvent {
+	event, _ := ctx.Value(auditEventKey{}).(*AuditEvent)
+	return event
+}
+
+// startAudit starts an audit event for the operation. The returned function
+// records the event with the outcome of the operation.
+// Operations that commit to the registry record the commit hash in the event
+// of the context.
+func startAudit(ctx context.Context, log AuditLog, operation string, url string, args map[string]string) (context.Context, func(err error)) {
+	event := &AuditEvent{
+		Time:       time.Now(),
+		Identity:   auth.FromContext(ctx).Name,
+		RemoteAddr: remoteAddress(ctx),
+		Operation:  operation,
+		URL:        url,
+		Arguments:  args,
+	}
+	return context.WithValue(ctx, auditEventKey{}, event), func(err error) {
+		event.Duration = time.Since(event.Time)
+		event.Outcome = status.Code(err).String()
+		if err != nil {
+			event.Error = err.Error()
+		}
+		log.Record(ctx, event)
+	}
+}
+
+// remoteAddress returns the address of the caller.
+// Requests through the HTTP gateway come from the loopback interface, and the
+// gateway appends the address of the HTTP client to the 'x-forwarded-for'
+// metadata. The earlier entries are set by the client, so only the last one
+// is trusted.
+func remoteAddress(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	if !isLoopback(p.Addr) {
+		return p.Addr.String()
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("x-forwarded-for"); len(values) > 0 {
+			hops := strings.Split(values[len(values)-1], ",")
+			if hop := strings.TrimSpace(hops[len(hops)-1]); hop != "" {
+				return hop
+			}
+		}
+	}
+	return p.Addr.String()
+}
+
+func isLoopback(addr net.Addr) bool {
+	tcp, ok := addr.(*net.TCPAddr)
+	return ok && tcp.IP.IsLoopback()
+}
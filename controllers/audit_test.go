@@ -0,0 +1,111 @@
+// Copyright (C) 2026 Toitware ApS. All rights reserved.
+// Use of this source code is governed by an MIT-style license that can be
+// found in the LICENSE file.
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/toitware/tpkg/config"
+	"github.com/toitware/tpkg/pkg/auth"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+func Test_auditLog(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "audit", "audit.jsonl")
+	log, err := newAuditLog(config.Audit{Path: path, MaxFiles: 2}, zap.NewNop())
+	require.NoError(t, err)
+	// Rotate after every event.
+	log.maxSize = 1
+
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		url := "github.com/toitware/toit-morse"
+		if i%2 == 1 {
+			url = "github.com/toitware/ubx-message"
+		}
+		_, done := startAudit(auth.NewContext(ctx, &auth.Identity{Name: "alice"}), log, "register", url, nil)
+		done(nil)
+	}
+	_, done := startAudit(ctx, log, "sync", "", nil)
+	done(status.Error(codes.Unavailable, "offline"))
+	require.NoError(t, log.Close())
+
+	// Only the current file and two rotated files are kept.
+	_, err = os.Stat(path + ".3")
+	assert.True(t, os.IsNotExist(err))
+
+	// The IDs continue after a restart.
+	log, err = newAuditLog(config.Audit{Path: path, MaxFiles: 2}, zap.NewNop())
+	require.NoError(t, err)
+	defer log.Close()
+	log.Record(ctx, &AuditEvent{Time: time.Now(), Operation: "sync", Outcome: "OK"})
+
+	events, next, err := log.List(ctx, AuditFilter{}, 2, "")
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, uint64(7), events[0].ID)
+	assert.Equal(t, uint64(6), events[1].ID)
+	assert.Equal(t, "Unavailable", events[1].Outcome)
+	assert.Equal(t, "rpc error: code = Unavailable desc = offline", events[1].Error)
+	assert.Equal(t, "6", next)
+
+	// The oldest events were rotated away.
+	events, next, err = log.List(ctx, AuditFilter{}, 2, next)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, uint64(5), events[0].ID)
+	assert.Equal(t, uint64(4), events[1].ID)
+	assert.Equal(t, "alice", events[0].Identity)
+	assert.Equal(t, "OK", events[0].Outcome)
+	assert.Empty(t, next)
+
+	events, _, err = log.List(ctx, AuditFilter{URL: "github.com/toitware/toit-morse", Since: start}, 10, "")
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, uint64(5), events[0].ID)
+
+	_, _, err = log.List(ctx, AuditFilter{}, 10, "invalid")
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func Test_auditLogDisabled(t *testing.T) {
+	log, err := newAuditLog(config.Audit{}, zap.NewNop())
+	require.NoError(t, err)
+	_, done := startAudit(context.Background(), log, "sync", "", nil)
+	done(errors.New("failed"))
+	_, _, err = log.List(context.Background(), AuditFilter{}, 10, "")
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
+
+func Test_remoteAddress(t *testing.T) {
+	withPeer := func(addr string, forwarded ...string) context.Context {
+		ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP(addr), Port: 1234}})
+		if len(forwarded) > 0 {
+			ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("x-forwarded-for", forwarded[0]))
+		}
+		return ctx
+	}
+	assert.Equal(t, "", remoteAddress(context.Background()))
+	assert.Equal(t, "10.0.0.1:1234", remoteAddress(withPeer("10.0.0.1")))
+	// Only the gateway on the loopback interface may forward addresses.
+	assert.Equal(t, "10.0.0.1:1234", remoteAddress(withPeer("10.0.0.1", "1.2.3.4")))
+	assert.Equal(t, "10.0.0.2", remoteAddress(withPeer("127.0.0.1", "10.0.0.2")))
+	// The client can't forge the address the gateway appended.
+	assert.Equal(t, "10.0.0.2", remoteAddress(withPeer("127.0.0.1", "1.2.3.4, 10.0.0.2")))
+	assert.Equal(t, "127.0.0.1:1234", remoteAddress(withPeer("127.0.0.1")))
+}
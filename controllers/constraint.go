@@ -0,0 +1,110 @@
+// Copyright (C) 2026 Toitware ApS. All rights reserved.
+// Use of this source code is governed by an MIT-style license that can be
+// found in the LICENSE file.
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/go-version"
+	"github.com/toitlang/tpkg/pkg/tpkg"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// parseConstraint parses a dependency constraint the way tpkg does.
+// tpkg only exports its parser through solver dependencies, which hide the
+// parsed constraints. They are used to reject the constraints tpkg rejects,
+// and the accepted ones are expanded the same way tpkg does:
+// In addition to the go-version syntax, '^version' accepts all versions that
+// are semver compatible: '^1.2.3' is '>=1.2.3,<2.0.0' and '^0.1.2' is
+// '>=0.1.2,<0.2.0'. An empty constraint accepts all versions.
+// Test_parseConstraint compares the result with tpkg's solver.
+func parseConstraint(str string) (version.Constraints, error) {
+	if _, err := tpkg.NewSolverDep("", str); err != nil {
+		return nil, err
+	}
+	if str == "" {
+		return version.Constraints{}, nil
+	}
+	if !strings.Contains(str, "^") {
+		return version.NewConstraint(str)
+	}
+
+	var res version.Constraints
+	for _, p := range strings.Split(str, ",") {
+		p = strings.TrimSpace(p)
+		if !strings.HasPrefix(p, "^") {
+			cs, err := version.NewConstraint(p)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, cs...)
+			continue
+		}
+
+		v, err := version.NewVersion(strings.TrimPrefix(p, "^"))
+		if err != nil {
+			return nil, err
+		}
+		segments := v.Segments()
+		reset := false
+		for i, segment := range segments {
+			if reset {
+				segments[i] = 0
+			} else if segment != 0 {
+				segments[i] = segment + 1
+				reset = true
+			}
+		}
+		upper := make([]string, len(segments))
+		for i, segment := range segments {
+			upper[i] = fmt.Sprint(segment)
+		}
+		cs, err := version.NewConstraint(">=" + strings.TrimPrefix(p, "^") + ",<" + strings.Join(upper, "."))
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, cs...)
+	}
+	return res, nil
+}
+
+// Match is the result of matching a constraint against the versions of a
+// package.
+type Match struct {
+	Package *Package
+	// Versions are all versions that satisfy the constraint, sorted
+	// ascending.
+	Versions []*tpkg.Desc
+	// Best is the highest version that satisfies the constraint and isn't
+	// yanked. It is nil if there is no such version.
+	Best *tpkg.Desc
+}
+
+func (r *registry) Match(ctx context.Context, url string, constraint string) (*Match, error) {
+	constraints, err := parseConstraint(constraint)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid constraint '%s': %v", constraint, err)
+	}
+	pkg, err := r.Package(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &Match{Package: pkg}
+	for _, d := range pkg.Descriptions {
+		v, err := version.NewVersion(d.Version)
+		if err != nil || !constraints.Check(v) {
+			continue
+		}
+		res.Versions = append(res.Versions, d)
+		if !pkg.IsYanked(d.Version) {
+			res.Best = d
+		}
+	}
+	return res, nil
+}
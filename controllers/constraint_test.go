@@ -0,0 +1,118 @@
+// Copyright (C) 2026 Toitware ApS. All rights reserved.
+// Use of this source code is governed by an MIT-style license that can be
+// found in the LICENSE file.
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/go-version"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/toitlang/tpkg/pkg/tpkg"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func Test_Match(t *testing.T) {
+	ctx := context.Background()
+	var descs []*tpkg.Desc
+	for _, v := range []string{"0.1.0", "0.1.5", "0.2.0", "1.0.0", "1.2.0", "1.2.3", "1.3.0", "2.0.0"} {
+		descs = append(descs, tpkg.NewDesc("morse", "", "github.com/toitware/toit-morse", v, "", "MIT", "", nil))
+	}
+	packages, lookup := buildPackageStructure(descs)
+	lookup["github.com/toitware/toit-morse"].Yanked["1.3.0"] = "broken"
+	r := &registry{packages: packages, lookup: lookup}
+
+	versions := func(constraint string) ([]string, string) {
+		match, err := r.Match(ctx, "github.com/toitware/toit-morse", constraint)
+		require.NoError(t, err)
+		var res []string
+		for _, d := range match.Versions {
+			res = append(res, d.Version)
+		}
+		best := ""
+		if match.Best != nil {
+			best = match.Best.Version
+		}
+		return res, best
+	}
+
+	res, best := versions("^1.2.0")
+	assert.Equal(t, []string{"1.2.0", "1.2.3", "1.3.0"}, res)
+	// Yanked versions match, but are never the best version.
+	assert.Equal(t, "1.2.3", best)
+	res, best = versions("^0.1.0")
+	assert.Equal(t, []string{"0.1.0", "0.1.5"}, res)
+	assert.Equal(t, "0.1.5", best)
+	res, best = versions(">=1.0.0, <1.2.3")
+	assert.Equal(t, []string{"1.0.0", "1.2.0"}, res)
+	assert.Equal(t, "1.2.0", best)
+	res, best = versions("^1.3.0")
+	assert.Equal(t, []string{"1.3.0"}, res)
+	assert.Empty(t, best)
+
+	_, err := r.Match(ctx, "github.com/toitware/toit-morse", "^a.b")
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = r.Match(ctx, "github.com/toitware/unknown", "^1.0.0")
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+// entriesRegistry is a registry with the given entries for tpkg's solver.
+type entriesRegistry struct {
+	tpkg.Registry
+	entries []*tpkg.Desc
+}
+
+func (r entriesRegistry) Entries() []*tpkg.Desc {
+	return r.entries
+}
+
+// tpkgAccepts returns whether tpkg's solver accepts the version for the
+// constraint.
+func tpkgAccepts(t *testing.T, constraint string, v string) bool {
+	url := "github.com/toitware/toit-morse"
+	desc := tpkg.NewDesc("morse", "", url, v, "", "MIT", "", nil)
+	solver, err := tpkg.NewSolver(tpkg.Registries{entriesRegistry{entries: []*tpkg.Desc{desc}}}, nil, tpkg.FmtUI)
+	require.NoError(t, err)
+	dep, err := tpkg.NewSolverDep(url, constraint)
+	require.NoError(t, err)
+	return solver.Solve(nil, []tpkg.SolverDep{dep}) != nil
+}
+
+func Test_parseConstraint(t *testing.T) {
+	versions := []string{"0.0.1", "0.0.2", "0.1.0", "0.1.5", "0.2.0", "1.0.0", "1.2.0", "1.2.3", "1.3.0", "2.0.0", "2.0.0-beta.1", "10.0.0"}
+	for _, constraint := range []string{
+		"",
+		"1.2.3",
+		"=1.2.0",
+		"!=1.2.0",
+		">=1.2.0",
+		">1.0.0, <2.0.0",
+		"~>1.2",
+		"~>1.2.0",
+		"^1.2.0",
+		"^0.1.0",
+		"^0.0.1",
+		"^1",
+		"^1.2.0, !=1.2.3",
+		">=0.1.0,^1.0.0",
+	} {
+		constraints, err := parseConstraint(constraint)
+		require.NoError(t, err, constraint)
+		for _, v := range versions {
+			parsed, err := version.NewVersion(v)
+			require.NoError(t, err)
+			assert.Equal(t, tpkgAccepts(t, constraint, v), constraints.Check(parsed), "'%s' with %s", constraint, v)
+		}
+	}
+
+	for _, constraint := range []string{"^a.b", "^", ">>1.0.0", "1.0.0 || 2.0.0"} {
+		_, err := parseConstraint(constraint)
+		_, tpkgErr := tpkg.NewSolverDep("", constraint)
+		assert.Equal(t, tpkgErr != nil, err != nil, constraint)
+		assert.Error(t, err, constraint)
+	}
+}
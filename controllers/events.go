@@ -0,0 +1,165 @@
+// Copyright (C) 2026 Toitware ApS. All rights reserved.
+// Use of this source code is governed by an MIT-style license that can be
+// found in the LICENSE file.
+
+package controllers
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/toitlang/tpkg/pkg/tpkg"
+	"go.uber.org/zap"
+)
+
+type ChangeKind string
+
+const (
+	ChangePackageAdded   ChangeKind = "package_added"
+	ChangePackageRemoved ChangeKind = "package_removed"
+	ChangeVersionAdded   ChangeKind = "version_added"
+	ChangeVersionRemoved ChangeKind = "version_removed"
+	ChangeVersionYanked  ChangeKind = "version_yanked"
+)
+
+// watchBufferSize is the number of events buffered per watcher. Watchers
+// that fall further behind are disconnected.
+const watchBufferSize = 256
+
+// ChangeEvent is a change of the package set, detected by a sync.
+type ChangeEvent struct {
+	Kind    ChangeKind `json:"kind"`
+	URL     string     `json:"url"`
+	Name    string     `json:"name,omitempty"`
+	Version string     `json:"version,omitempty"`
+	// Reason is the yank reason of ChangeVersionYanked events.
+	Reason string    `json:"reason,omitempty"`
+	Time   time.Time `json:"time"`
+}
+
+// diffPackages returns the changes from the old to the new packages, sorted
+// by URL.
+func diffPackages(old map[string]*Package, new map[string]*Package, now time.Time) []*ChangeEvent {
+	var res []*ChangeEvent
+	add := func(kind ChangeKind, url string, desc *tpkg.Desc, reason string) {
+		res = append(res, &ChangeEvent{
+			Kind:    kind,
+			URL:     url,
+			Name:    desc.Name,
+			Version: desc.Version,
+			Reason:  reason,
+			Time:    now,
+		})
+	}
+
+	for url, newPkg := range new {
+		oldPkg, ok := old[url]
+		if !ok {
+			res = append(res, &ChangeEvent{
+				Kind: ChangePackageAdded,
+				URL:  url,
+				Name: newPkg.Latest().Name,
+				Time: now,
+			})
+			oldPkg = &Package{}
+		}
+		for _, desc := range newPkg.Descriptions {
+			if _, ok := oldPkg.Lookup[desc.Version]; !ok {
+				add(ChangeVersionAdded, url, desc, "")
+			}
+			if newPkg.IsYanked(desc.Version) && !oldPkg.IsYanked(desc.Version) {
+				add(ChangeVersionYanked, url, desc, newPkg.Yanked[desc.Version])
+			}
+		}
+		for _, desc := range oldPkg.Descriptions {
+			if _, ok := newPkg.Lookup[desc.Version]; !ok {
+				add(ChangeVersionRemoved, url, desc, "")
+			}
+		}
+	}
+	for url, oldPkg := range old {
+		if _, ok := new[url]; !ok {
+			res = append(res, &ChangeEvent{
+				Kind: ChangePackageRemoved,
+				URL:  url,
+				Name: oldPkg.Latest().Name,
+				Time: now,
+			})
+		}
+	}
+
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].URL < res[j].URL
+	})
+	return res
+}
+
+// broadcaster fans change events out to the watchers.
+type broadcaster struct {
+	logger *zap.Logger
+
+	mutex sync.Mutex
+	// watchers maps the channels of the watchers to a channel that is closed
+	// when they are removed.
+	watchers map[chan *ChangeEvent]chan struct{}
+}
+
+func newBroadcaster(logger *zap.Logger) *broadcaster {
+	return &broadcaster{
+		logger:   logger,
+		watchers: map[chan *ChangeEvent]chan struct{}{},
+	}
+}
+
+// watch returns a channel that receives all future events. The channel is
+// closed when the context is done, or when the watcher falls behind.
+func (b *broadcaster) watch(ctx context.Context) <-chan *ChangeEvent {
+	ch := make(chan *ChangeEvent, watchBufferSize)
+	removed := make(chan struct{})
+	b.mutex.Lock()
+	b.watchers[ch] = removed
+	b.mutex.Unlock()
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			b.mutex.Lock()
+			b.remove(ch)
+			b.mutex.Unlock()
+		case <-removed:
+		}
+	}()
+	return ch
+}
+
+// remove closes the channel of the watcher. Must be called with the mutex
+// held.
+func (b *broadcaster) remove(ch chan *ChangeEvent) {
+	if removed, ok := b.watchers[ch]; ok {
+		delete(b.watchers, ch)
+		close(ch)
+		close(removed)
+	}
+}
+
+func (b *broadcaster) publish(events []*ChangeEvent) {
+	if len(events) == 0 {
+		return
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for ch := range b.watchers {
+	sendLoop:
+		for _, e := range events {
+			select {
+			case ch <- e:
+			default:
+				b.logger.Warn("disconnecting slow watcher")
+				b.remove(ch)
+				break sendLoop
+			}
+		}
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright (C) 2026 Toitware ApS. All rights reserved.
+// Use of this source code is governed by an MIT-style license that can be
+// found in the LICENSE file.
+
+package controllers
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/toitlang/tpkg/pkg/tpkg"
+	"github.com/toitware/tpkg/pkg/auth"
+	"go.uber.org/zap"
+)
+
+func Test_diffPackages(t *testing.T) {
+	_, old := buildPackageStructure([]*tpkg.Desc{
+		{Name: "morse", URL: "github.com/toitware/toit-morse", Version: "1.0.5"},
+		{Name: "morse", URL: "github.com/toitware/toit-morse", Version: "1.0.6"},
+		{Name: "ubx_message", URL: "github.com/toitware/ubx-message", Version: "2.1.1"},
+	})
+	_, new := buildPackageStructure([]*tpkg.Desc{
+		{Name: "morse", URL: "github.com/toitware/toit-morse", Version: "1.0.6"},
+		{Name: "morse", URL: "github.com/toitware/toit-morse", Version: "1.1.0"},
+		{Name: "pixel_display", URL: "github.com/toitware/toit-pixel-display", Version: "1.0.0"},
+	})
+	new["github.com/toitware/toit-morse"].Yanked = map[string]string{"1.0.6": "broken"}
+
+	now := time.Now()
+	kinds := map[ChangeKind][]string{}
+	for _, e := range diffPackages(old, new, now) {
+		assert.Equal(t, now, e.Time)
+		kinds[e.Kind] = append(kinds[e.Kind], e.URL+"@"+e.Version)
+	}
+	assert.Equal(t, map[ChangeKind][]string{
+		ChangePackageAdded:   {"github.com/toitware/toit-pixel-display@"},
+		ChangePackageRemoved: {"github.com/toitware/ubx-message@"},
+		ChangeVersionAdded:   {"github.com/toitware/toit-morse@1.1.0", "github.com/toitware/toit-pixel-display@1.0.0"},
+		ChangeVersionRemoved: {"github.com/toitware/toit-morse@1.0.5"},
+		ChangeVersionYanked:  {"github.com/toitware/toit-morse@1.0.6"},
+	}, kinds)
+
+	assert.Empty(t, diffPackages(new, new, now))
+}
+
+func Test_broadcaster(t *testing.T) {
+	goroutines := runtime.NumGoroutine()
+	b := newBroadcaster(zap.NewNop())
+	ctx, cancel := context.WithCancel(context.Background())
+	events := b.watch(ctx)
+	slow := b.watch(context.Background())
+
+	e := &ChangeEvent{Kind: ChangeVersionAdded, URL: "github.com/toitware/toit-morse", Version: "1.1.0"}
+	b.publish([]*ChangeEvent{e})
+	assert.Equal(t, e, <-events)
+
+	// Watchers that don't keep up are disconnected.
+	for i := 0; i < watchBufferSize; i++ {
+		b.publish([]*ChangeEvent{e})
+	}
+	for range slow {
+	}
+	// The watcher of the slow channel stops, although its context is never
+	// done.
+	// Eventually runs the condition in another goroutine, so poll instead.
+	for deadline := time.Now().Add(time.Second); runtime.NumGoroutine() > goroutines+1 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.LessOrEqual(t, runtime.NumGoroutine(), goroutines+1)
+
+	// Watchers are removed when their context is done.
+	cancel()
+	for range events {
+	}
+	require.Eventually(t, func() bool {
+		b.mutex.Lock()
+		defer b.mutex.Unlock()
+		return len(b.watchers) == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func Test_syncEvents(t *testing.T) {
+	withRegistry(t, func(ctx context.Context, registry *registry) {
+		alice := auth.NewContext(ctx, &auth.Identity{Name: "alice"})
+		commitDesc := func(version string) {
+			desc := tpkg.NewDesc("morse", "Morse code", "github.com/toitware/toit-morse", version, "", "MIT", "1234", nil)
+			err := registry.commit(alice, "Add morse", func(dir string) ([]string, error) {
+				path, err := desc.WriteInDir(dir)
+				return []string{path}, err
+			})
+			require.NoError(t, err)
+		}
+		commitDesc("1.0.0")
+		checkoutMasterOnSync(t, registry)
+
+		watchCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		events := registry.Watch(watchCtx)
+		// The initial load doesn't publish the existing packages.
+		require.NoError(t, registry.sync(ctx))
+		assert.Empty(t, events)
+
+		commitDesc("1.1.0")
+		require.NoError(t, registry.sync(ctx))
+		require.Len(t, events, 1)
+		e := <-events
+		assert.Equal(t, ChangeVersionAdded, e.Kind)
+		assert.Equal(t, "1.1.0", e.Version)
+	})
+}
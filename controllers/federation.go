@@ -0,0 +1,234 @@
+// Copyright (C) 2026 Toitware ApS. All rights reserved.
+// Use of this source code is governed by an MIT-style license that can be
+// found in the LICENSE file.
+
+package controllers
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/toitlang/tpkg/pkg/tpkg"
+	"github.com/toitware/tpkg/config"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Source is a registry that packages are served from.
+type Source struct {
+	Name     string
+	URL      string
+	Branch   string
+	Priority int
+	// Primary is the registry that packages are registered with. The other
+	// sources are read-only upstreams.
+	Primary bool
+	// Packages is the number of packages served from the source. Packages
+	// that are shadowed by a source with a higher priority aren't counted.
+	Packages int
+	// Error is the error of the last sync, if it failed.
+	Error string
+}
+
+// upstream is a read-only registry whose packages are served together with
+// the ones of the registry.
+type upstream struct {
+	config   config.Upstream
+	registry tpkg.Registry
+	// err is the error of the last sync. Guarded by the syncMutex.
+	err error
+}
+
+// upstreams are the upstream registries, in the order of the configuration.
+type upstreams []*upstream
+
+func provideUpstreams(cfg *config.Config, cache tpkg.Cache) (upstreams, error) {
+	var res upstreams
+	for _, u := range cfg.Upstreams {
+		r, err := newGitRegistry(u.Name, u.Url, u.Branch, u.Git, u.SSHKeyFile, cache)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, &upstream{
+			config:   u,
+			registry: r,
+		})
+	}
+	return res, nil
+}
+
+// source is a registry during a sync.
+type source struct {
+	name     string
+	priority int
+	// dir is the checkout of the registry. Empty if it was never synced.
+	dir     string
+	entries []*tpkg.Desc
+}
+
+// syncUpstreams loads the upstream registries. Upstreams that fail to sync
+// keep their previous packages, so an unreachable upstream doesn't take its
+// packages offline.
+func (r *registry) syncUpstreams(ctx context.Context) []error {
+	res := make([]error, len(r.upstreams))
+	for i, u := range r.upstreams {
+		if err := u.registry.Load(ctx, true, r.cache, r.ui); err != nil {
+			r.logger.Error("failed to sync upstream registry", zap.String("registry", u.config.Name), zap.Error(err))
+			res[i] = err
+		}
+	}
+	return res
+}
+
+// federate returns the packages of the registry and its upstreams. A
+// package is served by the source with the highest priority that has it.
+func (r *registry) federate(entries []*tpkg.Desc) ([]*Package, map[string]*Package, error) {
+	dir, err := r.registryPath()
+	if err != nil {
+		return nil, nil, err
+	}
+	sources := []*source{{
+		name:     r.remoteRegistryConfig.Name,
+		priority: r.remoteRegistryConfig.Priority,
+		dir:      dir,
+		entries:  entries,
+	}}
+	for _, u := range r.upstreams {
+		dir, err := r.cache.FindRegistry(u.config.Url)
+		if err != nil {
+			return nil, nil, err
+		}
+		sources = append(sources, &source{
+			name:     u.config.Name,
+			priority: u.config.Priority,
+			dir:      dir,
+			entries:  u.registry.Entries(),
+		})
+	}
+	// The registry comes first, so it wins ties.
+	sort.SliceStable(sources, func(i, j int) bool {
+		return sources[i].priority > sources[j].priority
+	})
+
+	owners := map[string]*source{}
+	var all []*tpkg.Desc
+	for _, s := range sources {
+		for _, e := range s.entries {
+			if owner, ok := owners[e.URL]; ok && owner != s {
+				continue
+			}
+			owners[e.URL] = s
+			all = append(all, e)
+		}
+	}
+
+	packages, lookup := buildPackageStructure(all)
+	bySource := map[*source][]*Package{}
+	for _, p := range packages {
+		s := owners[p.Descriptions[0].URL]
+		p.Source = s.name
+		bySource[s] = append(bySource[s], p)
+	}
+	for s, ps := range bySource {
+		if s.dir == "" {
+			continue
+		}
+		if err := loadYanks(s.dir, ps); err != nil {
+			return nil, nil, err
+		}
+	}
+	return packages, lookup, nil
+}
+
+// readUpstreamHeads returns the checked out commits of the upstreams, or the
+// empty string if there are no upstreams.
+func (r *registry) readUpstreamHeads() string {
+	var heads []string
+	for _, u := range r.upstreams {
+		head := ""
+		if dir, err := r.cache.FindRegistry(u.config.Url); err == nil && dir != "" {
+			if repository, err := git.PlainOpen(dir); err == nil {
+				if ref, err := repository.Head(); err == nil {
+					head = ref.Hash().String()
+				}
+			}
+		}
+		heads = append(heads, u.config.Name+"="+head)
+	}
+	return strings.Join(heads, ",")
+}
+
+// isPrimary returns whether the package is served from the registry, and
+// not from an upstream.
+func (r *registry) isPrimary(pkg *Package) bool {
+	return pkg.Source == r.remoteRegistryConfig.Name
+}
+
+// checkPrimary returns an error if the package is served from an upstream,
+// which can't be modified.
+func (r *registry) checkPrimary(pkg *Package) error {
+	if r.isPrimary(pkg) {
+		return nil
+	}
+	return status.Errorf(codes.FailedPrecondition, "package '%s' is served from the upstream registry '%s' and can't be modified here", pkg.Descriptions[0].URL, pkg.Source)
+}
+
+// primaryPackage returns the package, if it is served from the registry.
+func (r *registry) primaryPackage(ctx context.Context, url string) (*Package, error) {
+	pkg, err := r.Package(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.checkPrimary(pkg); err != nil {
+		return nil, err
+	}
+	return pkg, nil
+}
+
+// sourceDir returns the checkout of the registry that serves the package.
+func (r *registry) sourceDir(pkg *Package) (string, error) {
+	for _, u := range r.upstreams {
+		if u.config.Name == pkg.Source {
+			return r.cache.FindRegistry(u.config.Url)
+		}
+	}
+	return r.registryPath()
+}
+
+func (r *registry) Sources(ctx context.Context) ([]*Source, error) {
+	r.syncMutex.Lock()
+	defer r.syncMutex.Unlock()
+
+	counts := map[string]int{}
+	for _, p := range r.packages {
+		counts[p.Source]++
+	}
+	res := []*Source{{
+		Name:     r.remoteRegistryConfig.Name,
+		URL:      r.remoteRegistryConfig.Url,
+		Branch:   r.remoteRegistryConfig.Branch,
+		Priority: r.remoteRegistryConfig.Priority,
+		Primary:  true,
+		Packages: counts[r.remoteRegistryConfig.Name],
+	}}
+	for _, u := range r.upstreams {
+		s := &Source{
+			Name:     u.config.Name,
+			URL:      u.config.Url,
+			Branch:   u.config.Branch,
+			Priority: u.config.Priority,
+			Packages: counts[u.config.Name],
+		}
+		if u.err != nil {
+			s.Error = u.err.Error()
+		}
+		res = append(res, s)
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].Priority > res[j].Priority
+	})
+	return res, nil
+}
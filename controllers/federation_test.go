@@ -0,0 +1,115 @@
+// Copyright (C) 2026 Toitware ApS. All rights reserved.
+// Use of this source code is governed by an MIT-style license that can be
+// found in the LICENSE file.
+
+package controllers
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/toitlang/tpkg/pkg/tpkg"
+	"github.com/toitware/tpkg/config"
+	"github.com/toitware/tpkg/pkg/auth"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// commitToUpstream commits the descriptions to the checked out branch of the
+// repository at dir.
+func commitToUpstream(t *testing.T, dir string, descs ...*tpkg.Desc) {
+	r, err := git.PlainOpen(dir)
+	require.NoError(t, err)
+	w, err := r.Worktree()
+	require.NoError(t, err)
+	for _, desc := range descs {
+		_, err := desc.WriteInDir(dir)
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.AddGlob(tpkg.PackageDescriptionDir))
+	_, err = w.Commit("Add packages", &git.CommitOptions{
+		Author: &object.Signature{
+			Name:  "John Doe",
+			Email: "john@example.com",
+			When:  time.Now(),
+		},
+	})
+	require.NoError(t, err)
+}
+
+func Test_federate(t *testing.T) {
+	withRegistry(t, func(ctx context.Context, registry *registry) {
+		registry.remoteRegistryConfig.Name = "primary"
+		alice := auth.NewContext(ctx, &auth.Identity{Name: "alice"})
+		morse := tpkg.NewDesc("morse", "Morse code", "github.com/toitware/toit-morse", "1.0.0", "", "MIT", "1234", nil)
+		err := registry.commit(alice, "Add morse", func(dir string) ([]string, error) {
+			path, err := morse.WriteInDir(dir)
+			return []string{path}, err
+		})
+		require.NoError(t, err)
+		checkoutMasterOnSync(t, registry)
+
+		upstreamPath := createFileRegistry(t)
+		defer os.RemoveAll(upstreamPath)
+		commitToUpstream(t, upstreamPath,
+			tpkg.NewDesc("morse", "Morse code", "github.com/toitware/toit-morse", "2.0.0", "", "MIT", "5678", nil),
+			tpkg.NewDesc("host", "Host", "github.com/toitware/toit-host", "1.0.0", "", "MIT", "9abc", nil))
+		upstreams, err := provideUpstreams(&config.Config{
+			Upstreams: []config.Upstream{{
+				Name:     "upstream",
+				Url:      upstreamPath,
+				Branch:   "testing",
+				Priority: -1,
+			}},
+		}, registry.cache)
+		require.NoError(t, err)
+		registry.upstreams = upstreams
+
+		require.NoError(t, registry.sync(ctx))
+		pkg, err := registry.Package(ctx, "github.com/toitware/toit-morse")
+		require.NoError(t, err)
+		// The registry has the higher priority, so the upstream versions are
+		// shadowed.
+		assert.Equal(t, "primary", pkg.Source)
+		require.Len(t, pkg.Descriptions, 1)
+		assert.Equal(t, "1.0.0", pkg.Descriptions[0].Version)
+
+		host, err := registry.Package(ctx, "github.com/toitware/toit-host")
+		require.NoError(t, err)
+		assert.Equal(t, "upstream", host.Source)
+		// Upstream packages are read-only.
+		err = registry.YankPackage(ctx, "github.com/toitware/toit-host", "1.0.0", "broken")
+		assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+		sources, err := registry.Sources(ctx)
+		require.NoError(t, err)
+		require.Len(t, sources, 2)
+		assert.Equal(t, "primary", sources[0].Name)
+		assert.True(t, sources[0].Primary)
+		assert.Equal(t, 1, sources[0].Packages)
+		assert.Equal(t, "upstream", sources[1].Name)
+		assert.Equal(t, 1, sources[1].Packages)
+		assert.Empty(t, sources[1].Error)
+		assert.NotEqual(t, registry.history.head.String(), registry.Generation(ctx))
+
+		snapshot, err := registry.Snapshot(ctx)
+		require.NoError(t, err)
+		require.Len(t, snapshot.Packages, 1)
+		assert.Equal(t, "github.com/toitware/toit-morse", snapshot.Packages[0].URL)
+
+		// With a higher priority, the upstream serves the package.
+		upstreams[0].config.Priority = 1
+		require.NoError(t, registry.sync(ctx))
+		pkg, err = registry.Package(ctx, "github.com/toitware/toit-morse")
+		require.NoError(t, err)
+		assert.Equal(t, "upstream", pkg.Source)
+		require.Len(t, pkg.Descriptions, 1)
+		assert.Equal(t, "2.0.0", pkg.Descriptions[0].Version)
+	})
+}
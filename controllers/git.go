@@ -0,0 +1,165 @@
+// Copyright (C) 2026 Toitware ApS. All rights reserved.
+// Use of this source code is governed by an MIT-style license that can be
+// found in the LICENSE file.
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/toitlang/tpkg/pkg/tpkg"
+	"github.com/toitware/tpkg/config"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// newAuthMethod returns the auth for the repository at url. Returns nil if
+// the repository is accessed anonymously.
+func newAuthMethod(cfg config.Git, url string, sshKeyFile string) (transport.AuthMethod, error) {
+	switch auth := cfg.AuthMethod(url, sshKeyFile); auth {
+	case config.GitAuthSSHKey:
+		keys, err := ssh.NewPublicKeysFromFile(cfg.User(), sshKeyFile, "")
+		if err != nil {
+			return nil, fmt.Errorf("Failed to load SSH key from path: '%s': %v", sshKeyFile, err)
+		}
+		if err := setHostKeyCallback(&keys.HostKeyCallbackHelper, cfg); err != nil {
+			return nil, err
+		}
+		return keys, nil
+	case config.GitAuthSSHAgent:
+		agent, err := ssh.NewSSHAgentAuth(cfg.User())
+		if err != nil {
+			return nil, fmt.Errorf("Failed to connect to the SSH agent: %v", err)
+		}
+		if err := setHostKeyCallback(&agent.HostKeyCallbackHelper, cfg); err != nil {
+			return nil, err
+		}
+		return agent, nil
+	case config.GitAuthBasic:
+		return &http.BasicAuth{Username: cfg.Username, Password: cfg.Password}, nil
+	case config.GitAuthToken:
+		// Git servers take access tokens as the password of basic auth.
+		return &http.BasicAuth{Username: cfg.User(), Password: cfg.Token}, nil
+	case config.GitAuthNone:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown git auth '%s'", auth)
+	}
+}
+
+// setHostKeyCallback configures how SSH hosts are verified. Without
+// configuration, go-git uses the files of SSH_KNOWN_HOSTS, or the default
+// known_hosts files.
+func setHostKeyCallback(helper *ssh.HostKeyCallbackHelper, cfg config.Git) error {
+	if cfg.InsecureIgnoreHostKey {
+		helper.HostKeyCallback = gossh.InsecureIgnoreHostKey()
+		return nil
+	}
+	if cfg.KnownHostsFile == "" {
+		return nil
+	}
+	callback, err := ssh.NewKnownHostsCallback(filepath.SplitList(cfg.KnownHostsFile)...)
+	if err != nil {
+		return fmt.Errorf("Failed to load known hosts from path: '%s': %v", cfg.KnownHostsFile, err)
+	}
+	helper.HostKeyCallback = callback
+	return nil
+}
+
+// gitRegistry is a registry that is synced from a git repository with any
+// of the configured auth methods. The checkout is in the cache, where
+// cache.FindRegistry finds it.
+type gitRegistry struct {
+	tpkg.Registry
+	url    string
+	remote string
+	branch string
+	auth   transport.AuthMethod
+	path   string
+}
+
+// newGitRegistry returns the registry of the repository at url. The branch
+// defaults to the default branch of the repository.
+func newGitRegistry(name string, url string, branch string, cfg config.Git, sshKeyFile string, cache tpkg.Cache) (*gitRegistry, error) {
+	auth, err := newAuthMethod(cfg, url, sshKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	path, err := cache.FindRegistry(url)
+	if err != nil {
+		return nil, err
+	}
+	if path == "" {
+		path = cache.PreferredRegistryPath(url)
+	}
+	return &gitRegistry{
+		Registry: tpkg.NewLocalRegistry(name, path),
+		url:      url,
+		remote:   config.RemoteURL(url, cfg.AuthMethod(url, sshKeyFile)),
+		branch:   branch,
+		auth:     auth,
+		path:     path,
+	}, nil
+}
+
+func (r *gitRegistry) Describe() string {
+	return fmt.Sprintf("%s: %s", r.Name(), r.url)
+}
+
+func (r *gitRegistry) Load(ctx context.Context, sync bool, cache tpkg.Cache, ui tpkg.UI) error {
+	if sync {
+		if err := r.fetch(ctx); err != nil {
+			return err
+		}
+	}
+	return r.Registry.Load(ctx, sync, cache, ui)
+}
+
+// fetch clones the repository, or pulls it if it was cloned before.
+func (r *gitRegistry) fetch(ctx context.Context) error {
+	var reference plumbing.ReferenceName
+	if r.branch != "" {
+		reference = plumbing.NewBranchReferenceName(r.branch)
+	}
+
+	repository, err := git.PlainOpen(r.path)
+	if err == git.ErrRepositoryNotExists {
+		_, err := git.PlainCloneContext(ctx, r.path, false, &git.CloneOptions{
+			URL:           r.remote,
+			SingleBranch:  true,
+			ReferenceName: reference,
+			Auth:          r.auth,
+		})
+		if err != nil {
+			// Don't leave a partial checkout behind.
+			os.RemoveAll(r.path)
+		}
+		return err
+	} else if err != nil {
+		return err
+	}
+
+	wt, err := repository.Worktree()
+	if err != nil {
+		return err
+	}
+	err = wt.PullContext(ctx, &git.PullOptions{
+		// The remote may have been reconfigured since the clone.
+		RemoteURL:     r.remote,
+		ReferenceName: reference,
+		SingleBranch:  true,
+		Auth:          r.auth,
+		Force:         true,
+	})
+	if err != nil && err != git.NoErrAlreadyUpToDate {
+		return err
+	}
+	return nil
+}
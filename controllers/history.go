@@ -0,0 +1,154 @@
+// Copyright (C) 2026 Toitware ApS. All rights reserved.
+// Use of this source code is governed by an MIT-style license that can be
+// found in the LICENSE file.
+
+package controllers
+
+import (
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+	"github.com/go-git/go-git/v5/utils/merkletrie"
+	"github.com/toitlang/tpkg/pkg/tpkg"
+)
+
+// Release is the registration of a version, derived from the registry
+// history.
+type Release struct {
+	// Time is the commit time of the registration.
+	Time time.Time
+	// Commit is the hash of the registry commit that added the description.
+	Commit string
+	// Committer is the identity that registered the version: the author of
+	// the commit.
+	Committer string
+}
+
+// releaseHistory maps the package directories of the registry to the
+// commits that added their description.
+type releaseHistory struct {
+	head     plumbing.Hash
+	releases map[string]*Release
+}
+
+// update returns the history of the registry checkout at dir. It only walks
+// the commits that were added since the history was built.
+// The receiver isn't modified, as it may be in use by readers.
+func (h *releaseHistory) update(dir string) (*releaseHistory, error) {
+	repository, err := git.PlainOpen(dir)
+	if err != nil {
+		return nil, err
+	}
+	head, err := repository.Head()
+	if err != nil {
+		return nil, err
+	}
+
+	res := &releaseHistory{
+		head:     head.Hash(),
+		releases: map[string]*Release{},
+	}
+	var oldHead plumbing.Hash
+	if h != nil {
+		oldHead = h.head
+		for k, v := range h.releases {
+			res.releases[k] = v
+		}
+	}
+	if res.head == oldHead {
+		return res, nil
+	}
+
+	commits, err := repository.Log(&git.LogOptions{From: res.head})
+	if err != nil {
+		return nil, err
+	}
+	// The log is newest first. The newest addition of a description wins.
+	added := map[string]bool{}
+	err = commits.ForEach(func(c *object.Commit) error {
+		if c.Hash == oldHead {
+			return storer.ErrStop
+		}
+		dirs, err := addedDescriptions(c)
+		if err != nil {
+			return err
+		}
+		for _, d := range dirs {
+			if added[d] {
+				continue
+			}
+			added[d] = true
+			res.releases[d] = &Release{
+				Time:      c.Committer.When,
+				Commit:    c.Hash.String(),
+				Committer: c.Author.Name,
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// addedDescriptions returns the package directories whose description was
+// added by the commit, compared to its first parent.
+func addedDescriptions(c *object.Commit) ([]string, error) {
+	tree, err := c.Tree()
+	if err != nil {
+		return nil, err
+	}
+	var parentTree *object.Tree
+	if c.NumParents() > 0 {
+		parent, err := c.Parent(0)
+		if err != nil {
+			return nil, err
+		}
+		if parentTree, err = parent.Tree(); err != nil {
+			return nil, err
+		}
+	}
+	changes, err := object.DiffTree(parentTree, tree)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []string
+	for _, change := range changes {
+		action, err := change.Action()
+		if err != nil {
+			return nil, err
+		}
+		if action != merkletrie.Insert || path.Base(change.To.Name) != tpkg.DescriptionFileName {
+			continue
+		}
+		res = append(res, path.Dir(change.To.Name))
+	}
+	return res, nil
+}
+
+// loadReleases updates the history and fills in the releases of the packages.
+func (r *registry) loadReleases(dir string, packages []*Package) (*releaseHistory, error) {
+	r.syncMutex.Lock()
+	history := r.history
+	r.syncMutex.Unlock()
+
+	history, err := history.update(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range packages {
+		for _, d := range p.Descriptions {
+			if release, ok := history.releases[filepath.ToSlash(d.PackageDir())]; ok {
+				p.Releases[d.Version] = release
+			}
+		}
+	}
+	return history, nil
+}
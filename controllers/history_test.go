@@ -0,0 +1,69 @@
+// Copyright (C) 2026 Toitware ApS. All rights reserved.
+// Use of this source code is governed by an MIT-style license that can be
+// found in the LICENSE file.
+
+package controllers
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_releaseHistory(t *testing.T) {
+	dir := t.TempDir()
+	repository, err := git.PlainInit(dir, false)
+	require.NoError(t, err)
+	wt, err := repository.Worktree()
+	require.NoError(t, err)
+
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	commit := func(day int, files ...string) string {
+		for _, f := range files {
+			path := filepath.Join(dir, f)
+			require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+			require.NoError(t, ioutil.WriteFile(path, []byte(time.Now().String()), 0644))
+			_, err := wt.Add(f)
+			require.NoError(t, err)
+		}
+		hash, err := wt.Commit("commit", &git.CommitOptions{
+			Author: &object.Signature{Name: "test", When: start.AddDate(0, 0, day)},
+		})
+		require.NoError(t, err)
+		return hash.String()
+	}
+
+	first := commit(0,
+		"packages/github.com/toitware/toit-morse/1.0.5/desc.yaml",
+		"README.md")
+	second := commit(1,
+		"packages/github.com/toitware/toit-morse/1.0.6/desc.yaml",
+		"packages/github.com/toitware/ubx-message/2.1.1/desc.yaml")
+
+	history, err := (*releaseHistory)(nil).update(dir)
+	require.NoError(t, err)
+	assert.Len(t, history.releases, 3)
+	assert.Equal(t, first, history.releases["packages/github.com/toitware/toit-morse/1.0.5"].Commit)
+	assert.True(t, start.Equal(history.releases["packages/github.com/toitware/toit-morse/1.0.5"].Time))
+	assert.Equal(t, "test", history.releases["packages/github.com/toitware/toit-morse/1.0.5"].Committer)
+	assert.Equal(t, second, history.releases["packages/github.com/toitware/ubx-message/2.1.1"].Commit)
+	assert.True(t, start.AddDate(0, 0, 1).Equal(history.releases["packages/github.com/toitware/toit-morse/1.0.6"].Time))
+
+	// Modifications don't change the release, and updates only add the new
+	// releases without touching the old history.
+	commit(2, "packages/github.com/toitware/toit-morse/1.0.5/desc.yaml")
+	third := commit(3, "packages/github.com/toitware/toit-morse/1.1.0/desc.yaml")
+	updated, err := history.update(dir)
+	require.NoError(t, err)
+	assert.Len(t, history.releases, 3)
+	assert.Len(t, updated.releases, 4)
+	assert.Equal(t, first, updated.releases["packages/github.com/toitware/toit-morse/1.0.5"].Commit)
+	assert.Equal(t, third, updated.releases["packages/github.com/toitware/toit-morse/1.1.0"].Commit)
+}
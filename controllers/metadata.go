@@ -0,0 +1,45 @@
+// Copyright (C) 2026 Toitware ApS. All rights reserved.
+// Use of this source code is governed by an MIT-style license that can be
+// found in the LICENSE file.
+
+package controllers
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// metadataDir is the directory in the registry repository that contains
+// the data of the registry server. It is hidden, so tpkg ignores it.
+const metadataDir = ".registry"
+
+// readMetadata decodes the given metadata file of the registry checkout into
+// v. Leaves v untouched if the file doesn't exist.
+func readMetadata(registryDir string, name string, v interface{}) error {
+	content, err := ioutil.ReadFile(filepath.Join(registryDir, metadataDir, name))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return json.Unmarshal(content, v)
+}
+
+// writeMetadata stores v in the given metadata file of the registry checkout
+// and returns the path of the file.
+func writeMetadata(registryDir string, name string, v interface{}) (string, error) {
+	content, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(registryDir, metadataDir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+	if err := ioutil.WriteFile(path, append(content, '\n'), 0644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
@@ -12,10 +12,19 @@ var Module = fx.Options(
 	fx.Provide(
 		provideRegistry,
 		provideTpkgRegistry,
+		provideUpstreams,
 		provideToitdoc,
+		provideReadme,
 		provideManager,
+		provideVerifier,
+		provideAuditLog,
+		provideWebhooks,
+		provideStats,
 	),
 	fx.Invoke(
 		initRegistry,
+		initVerifier,
+		initWebhooks,
+		initStats,
 	),
 )
@@ -0,0 +1,366 @@
+// Copyright (C) 2026 Toitware ApS. All rights reserved.
+// Use of this source code is governed by an MIT-style license that can be
+// found in the LICENSE file.
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/toitlang/tpkg/pkg/tpkg"
+	"github.com/toitware/tpkg/config"
+	"github.com/toitware/tpkg/pkg/auth"
+	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	namesFileName = "names.json"
+
+	NameActionReject = "reject"
+	NameActionReview = "review"
+)
+
+// NameConflict describes why the name of a package is suspicious.
+type NameConflict struct {
+	Name string `json:"name"`
+	// URL of the existing package with a similar name. Empty for reserved
+	// names.
+	URL    string `json:"url,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// NameReview is a registration that waits for an administrator, because its
+// name is suspicious.
+type NameReview struct {
+	URL         string          `json:"url"`
+	Version     string          `json:"version"`
+	Name        string          `json:"name"`
+	Conflicts   []*NameConflict `json:"conflicts"`
+	RequestedBy string          `json:"requested_by,omitempty"`
+	RequestedAt time.Time       `json:"requested_at"`
+}
+
+// names is the name-check data that is stored in the registry repository.
+type names struct {
+	// Allowed contains the URLs of packages that are exempt from the checks.
+	Allowed []string      `json:"allowed"`
+	Pending []*NameReview `json:"pending"`
+}
+
+func (n *names) isAllowed(url string) bool {
+	for _, allowed := range n.Allowed {
+		if allowed == url {
+			return true
+		}
+	}
+	return false
+}
+
+func (n *names) pending(url string, version string) (int, *NameReview) {
+	for i, review := range n.Pending {
+		if review.URL == url && review.Version == version {
+			return i, review
+		}
+	}
+	return -1, nil
+}
+
+func loadNames(registryDir string) (*names, error) {
+	res := &names{}
+	if err := readMetadata(registryDir, namesFileName, res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// write stores the names in the given registry checkout and returns the
+// path of the written file.
+func (n *names) write(registryDir string) (string, error) {
+	sort.Strings(n.Allowed)
+	return writeMetadata(registryDir, namesFileName, n)
+}
+
+type nameChecker struct {
+	maxDistance int
+	reserved    map[string]string // Original names by normalized name.
+	action      string
+}
+
+func newNameChecker(cfg config.Names) (*nameChecker, error) {
+	action := cfg.Action
+	if action == "" {
+		action = NameActionReject
+	}
+	if action != NameActionReject && action != NameActionReview {
+		return nil, fmt.Errorf("invalid names action: '%s'", cfg.Action)
+	}
+	res := &nameChecker{
+		maxDistance: cfg.MaxDistance,
+		reserved:    map[string]string{},
+		action:      action,
+	}
+	for _, name := range cfg.Reserved {
+		res.reserved[normalizeName(name)] = name
+	}
+	return res, nil
+}
+
+// Check returns the conflicts of the name of the description with reserved
+// names and the names of other packages in the registry.
+func (c *nameChecker) Check(desc *tpkg.Desc, lookup map[string]*Package) []*NameConflict {
+	if pkg, ok := lookup[desc.URL]; ok && pkg.Latest().Name == desc.Name {
+		// A new version of an existing package.
+		return nil
+	}
+
+	normalized := normalizeName(desc.Name)
+	var res []*NameConflict
+	if reserved, ok := c.reserved[normalized]; ok {
+		res = append(res, &NameConflict{
+			Name:   reserved,
+			Reason: fmt.Sprintf("'%s' is a reserved name", reserved),
+		})
+	}
+
+	urls := make([]string, 0, len(lookup))
+	for url := range lookup {
+		urls = append(urls, url)
+	}
+	sort.Strings(urls)
+	for _, url := range urls {
+		if url == desc.URL {
+			continue
+		}
+		name := lookup[url].Latest().Name
+		if name == desc.Name {
+			res = append(res, &NameConflict{
+				Name:   name,
+				URL:    url,
+				Reason: fmt.Sprintf("'%s' is already used by %s", name, url),
+			})
+		} else if d := levenshtein(normalized, normalizeName(name)); d <= c.maxDistance {
+			res = append(res, &NameConflict{
+				Name:   name,
+				URL:    url,
+				Reason: fmt.Sprintf("'%s' is too similar to '%s' of %s", desc.Name, name, url),
+			})
+		}
+	}
+	return res
+}
+
+func nameError(url string, version string, conflicts []*NameConflict, pending bool) error {
+	msgs := make([]string, len(conflicts))
+	details := &errdetails.PreconditionFailure{}
+	for i, c := range conflicts {
+		msgs[i] = c.Reason
+		details.Violations = append(details.Violations, &errdetails.PreconditionFailure_Violation{
+			Type:        "name",
+			Subject:     url + "@" + version,
+			Description: c.Reason,
+		})
+	}
+	format := "Package %s version %s has a suspicious name: %s"
+	if pending {
+		format = "Package %s version %s is waiting for a manual review of its name: %s"
+	}
+	st := status.Newf(codes.FailedPrecondition, format, url, version, strings.Join(msgs, "; "))
+	if withDetails, err := st.WithDetails(details); err == nil {
+		st = withDetails
+	}
+	return st.Err()
+}
+
+// normalizeName ignores case and treats '-' and '_' the same.
+func normalizeName(name string) string {
+	return strings.ReplaceAll(strings.ToLower(name), "-", "_")
+}
+
+func levenshtein(a string, b string) int {
+	ra := []rune(a)
+	rb := []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+func minInt(values ...int) int {
+	res := values[0]
+	for _, v := range values[1:] {
+		if v < res {
+			res = v
+		}
+	}
+	return res
+}
+
+func (r *registry) NameAllowList(ctx context.Context) ([]string, error) {
+	r.syncMutex.Lock()
+	defer r.syncMutex.Unlock()
+	return r.names.Allowed, nil
+}
+
+func (r *registry) UpdateNameAllowList(ctx context.Context, add []string, remove []string) (err error) {
+	ctx, done := startAudit(ctx, r.audit, "update_name_allow_list", "", map[string]string{
+		"add":    strings.Join(add, ","),
+		"remove": strings.Join(remove, ","),
+	})
+	defer func() { done(err) }()
+
+	return r.updateNames(ctx, "Update name allow-list", func(n *names) error {
+		removed := map[string]bool{}
+		for _, url := range remove {
+			removed[url] = true
+		}
+		var allowed []string
+		for _, url := range n.Allowed {
+			if !removed[url] {
+				allowed = append(allowed, url)
+			}
+		}
+		for _, url := range add {
+			if !n.isAllowed(url) && !removed[url] {
+				allowed = append(allowed, url)
+			}
+		}
+		n.Allowed = allowed
+		return nil
+	})
+}
+
+func (r *registry) NameReviews(ctx context.Context) ([]*NameReview, error) {
+	r.syncMutex.Lock()
+	defer r.syncMutex.Unlock()
+	return r.names.Pending, nil
+}
+
+func (r *registry) ResolveNameReview(ctx context.Context, url string, version string, approve bool) (err error) {
+	ctx, done := startAudit(ctx, r.audit, "resolve_name_review", url, map[string]string{
+		"version": version,
+		"approve": strconv.FormatBool(approve),
+	})
+	defer func() { done(err) }()
+
+	if !approve {
+		return r.updateNames(ctx, fmt.Sprintf("Reject name of %s version %s", url, version), func(n *names) error {
+			i, _ := n.pending(url, version)
+			if i < 0 {
+				return status.Errorf(codes.NotFound, "no pending review for package '%s' version '%s'", url, version)
+			}
+			n.Pending = append(n.Pending[:i], n.Pending[i+1:]...)
+			return nil
+		})
+	}
+
+	// The package must be allowed before it's registered, but the review is
+	// only removed once the registration succeeded. Otherwise it would be
+	// lost if the registration fails.
+	var requestedBy string
+	wasAllowed := false
+	err = r.updateNames(ctx, fmt.Sprintf("Approve name of %s version %s", url, version), func(n *names) error {
+		_, review := n.pending(url, version)
+		if review == nil {
+			return status.Errorf(codes.NotFound, "no pending review for package '%s' version '%s'", url, version)
+		}
+		requestedBy = review.RequestedBy
+		if wasAllowed = n.isAllowed(url); !wasAllowed {
+			n.Allowed = append(n.Allowed, url)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// Register on behalf of the requester, so it becomes the owner of the
+	// package.
+	requester := auth.Anonymous
+	if requestedBy != "" {
+		requester = &auth.Identity{Name: requestedBy}
+	}
+	if _, err := r.RegisterPackage(auth.NewContext(ctx, requester), url, versionTag(version), false); err != nil {
+		if !wasAllowed {
+			restoreErr := r.updateNames(ctx, fmt.Sprintf("Restore name check of %s", url), func(n *names) error {
+				var allowed []string
+				for _, u := range n.Allowed {
+					if u != url {
+						allowed = append(allowed, u)
+					}
+				}
+				n.Allowed = allowed
+				return nil
+			})
+			if restoreErr != nil {
+				r.logger.Error("failed to restore the name check", zap.String("url", url), zap.Error(restoreErr))
+			}
+		}
+		return err
+	}
+	return r.updateNames(ctx, fmt.Sprintf("Resolve name review of %s version %s", url, version), func(n *names) error {
+		if i, _ := n.pending(url, version); i >= 0 {
+			n.Pending = append(n.Pending[:i], n.Pending[i+1:]...)
+		}
+		return nil
+	})
+}
+
+func (r *registry) requestNameReview(ctx context.Context, desc *tpkg.Desc, conflicts []*NameConflict) error {
+	return r.updateNames(ctx, fmt.Sprintf("Request name review of %s version %s", desc.URL, desc.Version), func(n *names) error {
+		if i, _ := n.pending(desc.URL, desc.Version); i >= 0 {
+			return nil
+		}
+		n.Pending = append(n.Pending, &NameReview{
+			URL:         desc.URL,
+			Version:     desc.Version,
+			Name:        desc.Name,
+			Conflicts:   conflicts,
+			RequestedBy: auth.FromContext(ctx).Name,
+			RequestedAt: time.Now(),
+		})
+		return nil
+	})
+}
+
+// updateNames commits the modification of the name-check data and syncs the
+// registry.
+func (r *registry) updateNames(ctx context.Context, message string, update func(n *names) error) error {
+	err := r.commit(ctx, message, func(dir string) ([]string, error) {
+		n, err := loadNames(dir)
+		if err != nil {
+			return nil, err
+		}
+		if err := update(n); err != nil {
+			return nil, err
+		}
+		path, err := n.write(dir)
+		if err != nil {
+			return nil, err
+		}
+		return []string{path}, nil
+	})
+	if err != nil {
+		return err
+	}
+	return r.sync(ctx)
+}
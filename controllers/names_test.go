@@ -0,0 +1,97 @@
+// Copyright (C) 2026 Toitware ApS. All rights reserved.
+// Use of this source code is governed by an MIT-style license that can be
+// found in the LICENSE file.
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/toitlang/tpkg/pkg/tpkg"
+	"github.com/toitware/tpkg/config"
+	"github.com/toitware/tpkg/pkg/auth"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func Test_levenshtein(t *testing.T) {
+	assert.Equal(t, 0, levenshtein("morse", "morse"))
+	assert.Equal(t, 1, levenshtein("morse", "morze"))
+	assert.Equal(t, 1, levenshtein("morse", "morses"))
+	assert.Equal(t, 2, levenshtein("morse", "mrose"))
+	assert.Equal(t, 5, levenshtein("", "morse"))
+}
+
+func Test_nameChecker(t *testing.T) {
+	c, err := newNameChecker(config.Names{
+		MaxDistance: 1,
+		Reserved:    []string{"toit"},
+	})
+	require.NoError(t, err)
+
+	_, lookup := buildPackageStructure([]*tpkg.Desc{
+		{Name: "morse", URL: "github.com/toitware/toit-morse", Version: "1.0.6"},
+		{Name: "ubx_message", URL: "github.com/toitware/ubx-message", Version: "2.1.1"},
+	})
+
+	check := func(name string, url string) []*NameConflict {
+		return c.Check(&tpkg.Desc{Name: name, URL: url, Version: "1.0.0"}, lookup)
+	}
+
+	// New versions of existing packages are fine.
+	assert.Empty(t, check("morse", "github.com/toitware/toit-morse"))
+	assert.Empty(t, check("location", "github.com/someone/location"))
+
+	conflicts := check("morse", "gitlab.com/someone/morse")
+	require.Len(t, conflicts, 1)
+	assert.Equal(t, "github.com/toitware/toit-morse", conflicts[0].URL)
+
+	assert.Len(t, check("Morze", "github.com/someone/morze"), 1)
+	assert.Len(t, check("UBX-Message", "github.com/someone/ubx"), 1)
+
+	conflicts = check("Toit", "github.com/someone/toit")
+	require.Len(t, conflicts, 1)
+	assert.Equal(t, "", conflicts[0].URL)
+}
+
+func Test_resolveNameReview(t *testing.T) {
+	withRegistry(t, func(ctx context.Context, registry *registry) {
+		admin := auth.NewContext(ctx, &auth.Identity{Name: "admin", Admin: true})
+		url := filepath.Join(t.TempDir(), "missing")
+		desc := &tpkg.Desc{Name: "morse", URL: url, Version: "1.0.0"}
+		conflicts := []*NameConflict{{Name: "morse", URL: "github.com/toitware/toit-morse", Reason: "similar name"}}
+		require.NoError(t, registry.requestNameReview(admin, desc, conflicts))
+		checkoutMasterOnSync(t, registry)
+		require.NoError(t, registry.sync(ctx))
+
+		// The registration fails, as the repository doesn't exist. The review
+		// must stay pending.
+		err := registry.ResolveNameReview(admin, url, "1.0.0", true)
+		require.Error(t, err)
+		require.NoError(t, registry.sync(ctx))
+		reviews, err := registry.NameReviews(ctx)
+		require.NoError(t, err)
+		require.Len(t, reviews, 1)
+		assert.False(t, registry.names.isAllowed(url))
+
+		err = registry.ResolveNameReview(admin, url, "2.0.0", true)
+		assert.Equal(t, codes.NotFound, status.Code(err))
+
+		require.NoError(t, registry.ResolveNameReview(admin, url, "1.0.0", false))
+		require.NoError(t, registry.sync(ctx))
+		reviews, err = registry.NameReviews(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, reviews)
+	})
+}
+
+func Test_nameConflictJSON(t *testing.T) {
+	encoded, err := json.Marshal(&NameConflict{Name: "toit", Reason: "reserved"})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"name":"toit","reason":"reserved"}`, string(encoded))
+}
@@ -0,0 +1,303 @@
+// Copyright (C) 2026 Toitware ApS. All rights reserved.
+// Use of this source code is governed by an MIT-style license that can be
+// found in the LICENSE file.
+
+package controllers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"github.com/toitware/tpkg/config"
+	"github.com/toitware/tpkg/pkg/auth"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	ownersFileName = "owners.json"
+
+	// OwnershipChallengeFile is the file in the root of a package repository
+	// that must contain the challenge token to claim ownership.
+	OwnershipChallengeFile = ".tpkg-registry-challenge"
+
+	OwnerMethodRegistration = "registration"
+	OwnerMethodChallenge    = "challenge"
+	OwnerMethodInvitation   = "invitation"
+)
+
+type Owner struct {
+	Identity string `json:"identity"`
+	// Method describes how the identity became an owner.
+	Method  string    `json:"method"`
+	AddedBy string    `json:"added_by,omitempty"`
+	AddedAt time.Time `json:"added_at"`
+}
+
+// owners are the owners of the packages, keyed by package URL.
+type owners map[string][]*Owner
+
+func loadOwners(registryDir string) (owners, error) {
+	res := owners{}
+	if err := readMetadata(registryDir, ownersFileName, &res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (o owners) isOwner(url string, identity string) bool {
+	for _, owner := range o[url] {
+		if owner.Identity == identity {
+			return true
+		}
+	}
+	return false
+}
+
+// checkOwner returns an error if the caller may not modify the existing
+// package. See checkManager.
+func (o owners) checkOwner(ctx context.Context, url string) error {
+	return o.checkManager(auth.FromContext(ctx), url)
+}
+
+// checkRegistrant returns an error if the caller may not register new
+// versions of the existing package. If openUnowned is true, everybody may
+// register versions of packages without owners. See checkOwner.
+func (o owners) checkRegistrant(ctx context.Context, url string, openUnowned bool) error {
+	if openUnowned && len(o[url]) == 0 {
+		return nil
+	}
+	return o.checkOwner(ctx, url)
+}
+
+// checkManager returns an error if the identity may not modify the package
+// or change its owners. Administrators may modify all packages, and owners
+// their packages. Packages without owners can only be modified by
+// administrators. Everybody else must claim them with a challenge first.
+func (o owners) checkManager(identity *auth.Identity, url string) error {
+	if identity.Admin {
+		return nil
+	}
+	if identity.IsAnonymous() {
+		return status.Error(codes.Unauthenticated, "authentication required")
+	}
+	if !o.isOwner(url, identity.Name) {
+		return status.Errorf(codes.PermissionDenied, "'%s' is not an owner of package '%s'", identity.Name, url)
+	}
+	return nil
+}
+
+type challenger struct {
+	secret []byte
+}
+
+func newChallenger(cfg config.Ownership) (*challenger, error) {
+	secret := []byte(cfg.ChallengeSecret)
+	if len(secret) == 0 {
+		// Challenges don't survive a restart without a configured secret.
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+	}
+	return &challenger{secret: secret}, nil
+}
+
+// token returns the challenge token of the identity for the package.
+func (c *challenger) token(url string, identity string) string {
+	mac := hmac.New(sha256.New, c.secret)
+	fmt.Fprintf(mac, "%s\n%s", url, identity)
+	return "tpkg-challenge-" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// fetchRepositoryFile returns the content of the file at the given path in the
+// default branch of the package repository.
+func fetchRepositoryFile(ctx context.Context, url string, path string) ([]byte, error) {
+	repository, err := git.CloneContext(ctx, memory.NewStorage(), nil, &git.CloneOptions{
+		URL:          packageRemoteURL(url),
+		Depth:        1,
+		SingleBranch: true,
+		NoCheckout:   true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	head, err := repository.Head()
+	if err != nil {
+		return nil, err
+	}
+	commit, err := repository.CommitObject(head.Hash())
+	if err != nil {
+		return nil, err
+	}
+	file, err := commit.File(path)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := file.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return ioutil.ReadAll(reader)
+}
+
+func (r *registry) Owners(ctx context.Context, url string) ([]*Owner, error) {
+	r.syncMutex.Lock()
+	defer r.syncMutex.Unlock()
+	if _, ok := r.lookup[url]; !ok {
+		return nil, status.Errorf(codes.NotFound, "package '%s' did not exist", url)
+	}
+	return r.owners[url], nil
+}
+
+func (r *registry) AddOwner(ctx context.Context, url string, identity string) (err error) {
+	ctx, done := startAudit(ctx, r.audit, "add_owner", url, map[string]string{"identity": identity})
+	defer func() { done(err) }()
+
+	if identity == "" {
+		return status.Errorf(codes.InvalidArgument, "missing identity")
+	}
+	if _, err := r.primaryPackage(ctx, url); err != nil {
+		return err
+	}
+	caller := auth.FromContext(ctx)
+	return r.updateOwners(ctx, fmt.Sprintf("Add owner %s to %s", identity, url), func(o owners) error {
+		if err := o.checkManager(caller, url); err != nil {
+			return err
+		}
+		if o.isOwner(url, identity) {
+			return status.Errorf(codes.AlreadyExists, "'%s' is already an owner of package '%s'", identity, url)
+		}
+		o[url] = append(o[url], &Owner{
+			Identity: identity,
+			Method:   OwnerMethodInvitation,
+			AddedBy:  caller.Name,
+			AddedAt:  time.Now(),
+		})
+		return nil
+	})
+}
+
+func (r *registry) RemoveOwner(ctx context.Context, url string, identity string) (err error) {
+	ctx, done := startAudit(ctx, r.audit, "remove_owner", url, map[string]string{"identity": identity})
+	defer func() { done(err) }()
+
+	if _, err := r.primaryPackage(ctx, url); err != nil {
+		return err
+	}
+	caller := auth.FromContext(ctx)
+	return r.updateOwners(ctx, fmt.Sprintf("Remove owner %s from %s", identity, url), func(o owners) error {
+		if err := o.checkManager(caller, url); err != nil {
+			return err
+		}
+		var remaining []*Owner
+		for _, owner := range o[url] {
+			if owner.Identity != identity {
+				remaining = append(remaining, owner)
+			}
+		}
+		if len(remaining) == len(o[url]) {
+			return status.Errorf(codes.NotFound, "'%s' is not an owner of package '%s'", identity, url)
+		}
+		if len(remaining) == 0 && !caller.Admin {
+			return status.Errorf(codes.FailedPrecondition, "can't remove the last owner of package '%s'", url)
+		}
+		if len(remaining) == 0 {
+			delete(o, url)
+		} else {
+			o[url] = remaining
+		}
+		return nil
+	})
+}
+
+func (r *registry) OwnershipChallenge(ctx context.Context, url string) (string, error) {
+	identity := auth.FromContext(ctx)
+	if identity.IsAnonymous() {
+		return "", status.Error(codes.Unauthenticated, "authentication required")
+	}
+	if _, err := r.primaryPackage(ctx, url); err != nil {
+		return "", err
+	}
+	return r.challenger.token(url, identity.Name), nil
+}
+
+func (r *registry) VerifyOwnershipChallenge(ctx context.Context, url string) (err error) {
+	ctx, done := startAudit(ctx, r.audit, "verify_ownership_challenge", url, nil)
+	defer func() { done(err) }()
+
+	identity := auth.FromContext(ctx)
+	if identity.IsAnonymous() {
+		return status.Error(codes.Unauthenticated, "authentication required")
+	}
+	if _, err := r.primaryPackage(ctx, url); err != nil {
+		return err
+	}
+
+	content, err := fetchRepositoryFile(ctx, url, OwnershipChallengeFile)
+	if err != nil {
+		return status.Errorf(codes.FailedPrecondition, "failed to read '%s' from '%s': %v", OwnershipChallengeFile, url, err)
+	}
+	token := r.challenger.token(url, identity.Name)
+	found := false
+	for _, line := range strings.Split(string(content), "\n") {
+		if hmac.Equal([]byte(strings.TrimSpace(line)), []byte(token)) {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return status.Errorf(codes.PermissionDenied, "'%s' doesn't contain the challenge token of '%s'", OwnershipChallengeFile, identity.Name)
+	}
+
+	return r.updateOwners(ctx, fmt.Sprintf("Add owner %s to %s", identity.Name, url), func(o owners) error {
+		if o.isOwner(url, identity.Name) {
+			return nil
+		}
+		o[url] = append(o[url], &Owner{
+			Identity: identity.Name,
+			Method:   OwnerMethodChallenge,
+			AddedAt:  time.Now(),
+		})
+		return nil
+	})
+}
+
+func (r *registry) checkOwner(ctx context.Context, url string) error {
+	r.syncMutex.Lock()
+	owners := r.owners
+	r.syncMutex.Unlock()
+	return owners.checkOwner(ctx, url)
+}
+
+// updateOwners commits the modification of the owners and syncs the registry.
+func (r *registry) updateOwners(ctx context.Context, message string, update func(o owners) error) error {
+	err := r.commit(ctx, message, func(dir string) ([]string, error) {
+		o, err := loadOwners(dir)
+		if err != nil {
+			return nil, err
+		}
+		if err := update(o); err != nil {
+			return nil, err
+		}
+		path, err := writeMetadata(dir, ownersFileName, o)
+		if err != nil {
+			return nil, err
+		}
+		return []string{path}, nil
+	})
+	if err != nil {
+		return err
+	}
+	return r.sync(ctx)
+}
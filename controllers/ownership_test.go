@@ -0,0 +1,83 @@
+// Copyright (C) 2026 Toitware ApS. All rights reserved.
+// Use of this source code is governed by an MIT-style license that can be
+// found in the LICENSE file.
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/toitware/tpkg/config"
+	"github.com/toitware/tpkg/pkg/auth"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func Test_checkOwner(t *testing.T) {
+	o := owners{
+		"github.com/toitware/toit-morse": {{Identity: "alice", Method: OwnerMethodRegistration}},
+	}
+
+	as := func(identity *auth.Identity) context.Context {
+		return auth.NewContext(context.Background(), identity)
+	}
+	code := func(err error) codes.Code {
+		return status.Code(err)
+	}
+
+	alice := &auth.Identity{Name: "alice"}
+	bob := &auth.Identity{Name: "bob"}
+	admin := &auth.Identity{Name: "admin", Admin: true}
+
+	assert.NoError(t, o.checkOwner(as(alice), "github.com/toitware/toit-morse"))
+	assert.NoError(t, o.checkOwner(as(admin), "github.com/toitware/toit-morse"))
+	assert.Equal(t, codes.PermissionDenied, code(o.checkOwner(as(bob), "github.com/toitware/toit-morse")))
+	assert.Equal(t, codes.Unauthenticated, code(o.checkOwner(as(auth.Anonymous), "github.com/toitware/toit-morse")))
+
+	// Packages without owners can only be modified by administrators.
+	assert.NoError(t, o.checkOwner(as(admin), "github.com/toitware/ubx-message"))
+	assert.Equal(t, codes.PermissionDenied, code(o.checkOwner(as(bob), "github.com/toitware/ubx-message")))
+	assert.Equal(t, codes.Unauthenticated, code(o.checkOwner(as(auth.Anonymous), "github.com/toitware/ubx-message")))
+
+	// Open packages without owners accept new versions from everybody, but
+	// only while nobody owns them.
+	assert.NoError(t, o.checkRegistrant(as(auth.Anonymous), "github.com/toitware/ubx-message", true))
+	assert.NoError(t, o.checkRegistrant(as(bob), "github.com/toitware/ubx-message", true))
+	assert.Equal(t, codes.Unauthenticated, code(o.checkRegistrant(as(auth.Anonymous), "github.com/toitware/ubx-message", false)))
+	assert.Equal(t, codes.PermissionDenied, code(o.checkRegistrant(as(bob), "github.com/toitware/toit-morse", true)))
+	assert.NoError(t, o.checkRegistrant(as(alice), "github.com/toitware/toit-morse", true))
+
+	assert.NoError(t, o.checkManager(admin, "github.com/toitware/ubx-message"))
+	assert.Equal(t, codes.PermissionDenied, code(o.checkManager(bob, "github.com/toitware/ubx-message")))
+	assert.NoError(t, o.checkManager(alice, "github.com/toitware/toit-morse"))
+}
+
+func Test_challengerToken(t *testing.T) {
+	c := &challenger{secret: []byte("secret")}
+	token := c.token("github.com/toitware/toit-morse", "alice")
+	assert.Equal(t, token, c.token("github.com/toitware/toit-morse", "alice"))
+	assert.NotEqual(t, token, c.token("github.com/toitware/toit-morse", "bob"))
+	assert.NotEqual(t, token, c.token("github.com/toitware/ubx-message", "alice"))
+	assert.NotEqual(t, token, (&challenger{secret: []byte("other")}).token("github.com/toitware/toit-morse", "alice"))
+}
+
+func Test_openUnowned(t *testing.T) {
+	withRegistry(t, func(ctx context.Context, registry *registry) {
+		assert.False(t, registry.openUnowned())
+		registry.applyConfig(&config.Change{
+			Old:  &config.Config{},
+			New:  &config.Config{Ownership: config.Ownership{OpenUnowned: true}},
+			Keys: []string{"ownership.open_unowned"},
+		})
+		assert.True(t, registry.openUnowned())
+
+		// Claiming an open package closes it.
+		o := owners{}
+		assert.NoError(t, o.checkRegistrant(ctx, "github.com/toitware/toit-morse", registry.openUnowned()))
+		o["github.com/toitware/toit-morse"] = []*Owner{{Identity: "alice", Method: OwnerMethodChallenge}}
+		err := o.checkRegistrant(ctx, "github.com/toitware/toit-morse", registry.openUnowned())
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	})
+}
@@ -0,0 +1,228 @@
+// Copyright (C) 2026 Toitware ApS. All rights reserved.
+// Use of this source code is governed by an MIT-style license that can be
+// found in the LICENSE file.
+
+package controllers
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/hashicorp/go-version"
+	"github.com/toitlang/tpkg/pkg/tpkg"
+	"github.com/toitware/tpkg/config"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// PolicyViolation is a failed rule of the registration policy.
+type PolicyViolation struct {
+	Rule    string
+	Message string
+}
+
+// policyRule returns a non-empty message if the description violates the rule.
+// The lookup contains the packages of the registry, keyed by URL.
+type policyRule struct {
+	name  string
+	check func(desc *tpkg.Desc, lookup map[string]*Package) string
+}
+
+type policy struct {
+	rules []policyRule
+}
+
+func newPolicy(cfg config.Policy) (*policy, error) {
+	res := &policy{}
+	if cfg.RequireLicense {
+		res.rules = append(res.rules, policyRule{"license", checkLicense})
+	}
+	if cfg.RequireDescription {
+		res.rules = append(res.rules, policyRule{"description", checkDescription})
+	}
+	if len(cfg.AllowedHosts) > 0 || len(cfg.AllowedOrganizations) > 0 {
+		res.rules = append(res.rules, policyRule{"url", allowedURLs(cfg.AllowedHosts, cfg.AllowedOrganizations)})
+	}
+	if cfg.RegistryDependenciesOnly {
+		res.rules = append(res.rules, policyRule{"dependencies", checkDependencies})
+	}
+	if cfg.MinSDK != "" {
+		minSDK, err := version.NewVersion(cfg.MinSDK)
+		if err != nil {
+			return nil, fmt.Errorf("invalid policy min_sdk '%s': %v", cfg.MinSDK, err)
+		}
+		res.rules = append(res.rules, policyRule{"sdk", checkMinSDK(minSDK)})
+	}
+	return res, nil
+}
+
+// Check returns all rules the description violates.
+func (p *policy) Check(desc *tpkg.Desc, lookup map[string]*Package) []*PolicyViolation {
+	var res []*PolicyViolation
+	for _, rule := range p.rules {
+		if msg := rule.check(desc, lookup); msg != "" {
+			res = append(res, &PolicyViolation{Rule: rule.name, Message: msg})
+		}
+	}
+	return res
+}
+
+// policyError returns a FailedPrecondition error listing all violations.
+func policyError(url string, version string, violations []*PolicyViolation) error {
+	msgs := make([]string, len(violations))
+	details := &errdetails.PreconditionFailure{}
+	for i, v := range violations {
+		msgs[i] = fmt.Sprintf("%s: %s", v.Rule, v.Message)
+		details.Violations = append(details.Violations, &errdetails.PreconditionFailure_Violation{
+			Type:        v.Rule,
+			Subject:     url + "@" + version,
+			Description: v.Message,
+		})
+	}
+	st := status.Newf(codes.FailedPrecondition, "Package %s version %s violates the registry policy: %s", url, version, strings.Join(msgs, "; "))
+	if withDetails, err := st.WithDetails(details); err == nil {
+		st = withDetails
+	}
+	return st.Err()
+}
+
+func checkLicense(desc *tpkg.Desc, _ map[string]*Package) string {
+	if desc.License == "" {
+		return "missing license"
+	}
+	if !isValidLicenseExpression(desc.License) {
+		return fmt.Sprintf("'%s' is not a valid SPDX license expression", desc.License)
+	}
+	return ""
+}
+
+var (
+	// spdxFoldedLicenseIDs are the spdxLicenseIDs in lower case. SPDX license
+	// identifiers are case-insensitive.
+	spdxFoldedLicenseIDs = func() map[string]bool {
+		res := map[string]bool{}
+		for id := range spdxLicenseIDs {
+			res[strings.ToLower(id)] = true
+		}
+		return res
+	}()
+	// spdxLicenseRef matches user defined licenses, like 'LicenseRef-Toit' or
+	// 'DocumentRef-spdx-tool-1.2:LicenseRef-MIT-Style-2'.
+	spdxLicenseRef = regexp.MustCompile(`(?i)^(DocumentRef-[a-z0-9.-]+:)?LicenseRef-[a-z0-9.-]+$`)
+)
+
+// isLicenseID returns whether the token is an SPDX license identifier or a
+// user defined LicenseRef.
+func isLicenseID(token string) bool {
+	return spdxFoldedLicenseIDs[strings.ToLower(token)] || spdxLicenseRef.MatchString(token)
+}
+
+// isValidLicenseExpression returns whether the given string is a valid SPDX
+// license expression, like 'MIT' or '(MIT OR Apache-2.0)'. License identifiers
+// are compared case-insensitively.
+// License exceptions ('WITH ...') are not validated.
+func isValidLicenseExpression(expr string) bool {
+	expr = strings.NewReplacer("(", " ( ", ")", " ) ").Replace(expr)
+	expectID := true
+	depth := 0
+	skipException := false
+	for _, token := range strings.Fields(expr) {
+		switch {
+		case skipException:
+			skipException = false
+			expectID = false
+		case token == "(":
+			if !expectID {
+				return false
+			}
+			depth++
+		case token == ")":
+			if expectID || depth == 0 {
+				return false
+			}
+			depth--
+		case token == "AND" || token == "OR":
+			if expectID {
+				return false
+			}
+			expectID = true
+		case token == "WITH":
+			if expectID {
+				return false
+			}
+			skipException = true
+		default:
+			if !expectID || !isLicenseID(token) {
+				return false
+			}
+			expectID = false
+		}
+	}
+	return !expectID && depth == 0 && !skipException
+}
+
+func checkDescription(desc *tpkg.Desc, _ map[string]*Package) string {
+	if strings.TrimSpace(desc.Description) == "" {
+		return "missing description"
+	}
+	return ""
+}
+
+func allowedURLs(hosts []string, organizations []string) func(*tpkg.Desc, map[string]*Package) string {
+	return func(desc *tpkg.Desc, _ map[string]*Package) string {
+		url := strings.ToLower(desc.URL)
+		host := strings.SplitN(url, "/", 2)[0]
+		for _, h := range hosts {
+			if host == strings.ToLower(h) {
+				return ""
+			}
+		}
+		for _, o := range organizations {
+			if strings.HasPrefix(url, strings.ToLower(strings.TrimSuffix(o, "/"))+"/") {
+				return ""
+			}
+		}
+		return fmt.Sprintf("'%s' is not in an allowed host or organization", desc.URL)
+	}
+}
+
+func checkDependencies(desc *tpkg.Desc, lookup map[string]*Package) string {
+	var missing []string
+	for _, dep := range desc.Deps {
+		if _, ok := lookup[dep.URL]; !ok {
+			missing = append(missing, dep.URL)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Sprintf("dependencies are not in the registry: %s", strings.Join(missing, ", "))
+	}
+	return ""
+}
+
+func checkMinSDK(minSDK *version.Version) func(*tpkg.Desc, map[string]*Package) string {
+	return func(desc *tpkg.Desc, _ map[string]*Package) string {
+		sdk := desc.Environment.SDK
+		if sdk == "" {
+			return fmt.Sprintf("missing SDK constraint, must require at least %s", minSDK.Original())
+		}
+		lower, err := sdkMinVersion(sdk)
+		if err != nil {
+			return fmt.Sprintf("invalid SDK constraint '%s', must be like '^%s'", sdk, minSDK.Original())
+		}
+		if lower.LessThan(minSDK) {
+			return fmt.Sprintf("SDK constraint '%s' must require at least %s", sdk, minSDK.Original())
+		}
+		return ""
+	}
+}
+
+// sdkMinVersion returns the minimal SDK version of the constraint. Like tpkg,
+// it only accepts constraints of the form '^version'.
+func sdkMinVersion(constraint string) (*version.Version, error) {
+	if !strings.HasPrefix(constraint, "^") {
+		return nil, fmt.Errorf("unexpected sdk constraint: '%s'", constraint)
+	}
+	return version.NewVersion(constraint[1:])
+}
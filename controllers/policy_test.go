@@ -0,0 +1,92 @@
+// Copyright (C) 2026 Toitware ApS. All rights reserved.
+// Use of this source code is governed by an MIT-style license that can be
+// found in the LICENSE file.
+
+package controllers
+
+import (
+	"testing"
+
+	"github.com/hashicorp/go-version"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/toitlang/tpkg/pkg/tpkg"
+	"github.com/toitware/tpkg/config"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func Test_isValidLicenseExpression(t *testing.T) {
+	valid := []string{"MIT", "Apache-2.0", "MIT OR Apache-2.0", "(MIT AND BSD-3-Clause) OR LGPL-2.1-only", "GPL-2.0-only WITH Classpath-exception-2.0",
+		"mit", "apache-2.0", "gpl-2.0+", "LicenseRef-Toit", "MIT OR licenseref-my.license-2", "DocumentRef-spdx-tool-1.2:LicenseRef-MIT-Style-2"}
+	for _, expr := range valid {
+		assert.True(t, isValidLicenseExpression(expr), expr)
+	}
+	invalid := []string{"", "Foo", "MIT OR", "OR MIT", "(MIT", "MIT)", "MIT Apache-2.0", "MIT WITH", "LicenseRef-", "LicenseRef-a_b", "DocumentRef-:LicenseRef-a"}
+	for _, expr := range invalid {
+		assert.False(t, isValidLicenseExpression(expr), expr)
+	}
+}
+
+func Test_policy(t *testing.T) {
+	p, err := newPolicy(config.Policy{
+		RequireLicense:           true,
+		RequireDescription:       true,
+		AllowedHosts:             []string{"gitlab.com"},
+		AllowedOrganizations:     []string{"github.com/toitware"},
+		RegistryDependenciesOnly: true,
+		MinSDK:                   "2.0.0-alpha.100",
+	})
+	require.NoError(t, err)
+
+	existing, lookup := buildPackageStructure([]*tpkg.Desc{
+		{URL: "github.com/toitware/toit-morse", Version: "1.0.6"},
+	})
+	require.Len(t, existing, 1)
+
+	good := &tpkg.Desc{
+		Name:        "foo",
+		Description: "Foo",
+		License:     "MIT",
+		URL:         "github.com/toitware/foo",
+		Version:     "1.0.0",
+		Environment: tpkg.DescEnvironment{SDK: "^2.0.0-alpha.120"},
+	}
+	assert.Empty(t, p.Check(good, lookup))
+
+	gitlab := *good
+	gitlab.URL = "gitlab.com/someone/foo"
+	assert.Empty(t, p.Check(&gitlab, lookup))
+
+	bad := &tpkg.Desc{
+		Name:        "foo",
+		License:     "Foo",
+		URL:         "github.com/someone/foo",
+		Version:     "1.0.0",
+		Environment: tpkg.DescEnvironment{SDK: "^1.6.0"},
+	}
+	violations := p.Check(bad, lookup)
+	rules := []string{}
+	for _, v := range violations {
+		rules = append(rules, v.Rule)
+	}
+	assert.Equal(t, []string{"license", "description", "url", "sdk"}, rules)
+
+	err = policyError(bad.URL, "v1.0.0", violations)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	assert.Len(t, status.Convert(err).Details(), 1)
+}
+
+func Test_checkMinSDK(t *testing.T) {
+	check := checkMinSDK(version.Must(version.NewVersion("1.2.0")))
+	message := func(sdk string) string {
+		return check(&tpkg.Desc{Environment: tpkg.DescEnvironment{SDK: sdk}}, nil)
+	}
+	for _, sdk := range []string{"^1.2.0", "^1.3", "^2.0.0-alpha.1"} {
+		assert.Empty(t, message(sdk), sdk)
+	}
+	// tpkg only accepts '^version' constraints.
+	for _, sdk := range []string{"", "^1.0.0", "^1.2.0-alpha", ">=1.2.0", "1.2.0", "^a.b", "^"} {
+		assert.NotEmpty(t, message(sdk), sdk)
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright (C) 2026 Toitware ApS. All rights reserved.
+// Use of this source code is governed by an MIT-style license that can be
+// found in the LICENSE file.
+
+package controllers
+
+import (
+	"context"
+	"encoding/base64"
+	"sort"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type PackageSort int
+
+const (
+	SortByURL PackageSort = iota
+	// SortByName sorts by name, then URL.
+	SortByName
+	// SortByUpdated sorts the most recently released packages first.
+	SortByUpdated
+	// SortByDependents sorts the packages with the most dependents first.
+	SortByDependents
+	// SortByPopularity sorts the packages with the most accesses in the last
+	// PopularityDays first.
+	SortByPopularity
+)
+
+// PackageQuery selects a page of packages. Zero values match everything.
+type PackageQuery struct {
+	Sort PackageSort
+	// License matches the license of the latest version, ignoring case.
+	License string
+	// Host matches the host of the package URL.
+	Host      string
+	URLPrefix string
+	// HasDocs only matches packages whose latest version has generated docs.
+	HasDocs bool
+	// Registry matches the name of the registry the package is served from.
+	Registry string
+	// PageSize is the maximum number of packages. All packages are returned
+	// if 0.
+	PageSize  int
+	PageToken string
+}
+
+func (q *PackageQuery) matches(p *Package, docsBuilt func(*Package) bool) bool {
+	latest := p.Latest()
+	if q.License != "" && !strings.EqualFold(latest.License, q.License) {
+		return false
+	}
+	if q.Host != "" && strings.SplitN(latest.URL, "/", 2)[0] != q.Host {
+		return false
+	}
+	if q.URLPrefix != "" && !strings.HasPrefix(latest.URL, q.URLPrefix) {
+		return false
+	}
+	if q.HasDocs && !docsBuilt(p) {
+		return false
+	}
+	if q.Registry != "" && p.Source != q.Registry {
+		return false
+	}
+	return true
+}
+
+func (r *registry) QueryPackages(ctx context.Context, q *PackageQuery) ([]*Package, string, error) {
+	if q.PageSize < 0 {
+		return nil, "", status.Errorf(codes.InvalidArgument, "invalid page size %d", q.PageSize)
+	}
+	offset, err := decodePageToken(q.PageToken)
+	if err != nil {
+		return nil, "", err
+	}
+
+	packages, err := r.Packages(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	docsBuilt := func(p *Package) bool {
+		return r.toitdoc != nil && r.toitdoc.Built(p.Latest())
+	}
+	var res []*Package
+	for _, p := range packages {
+		if q.matches(p, docsBuilt) {
+			res = append(res, p)
+		}
+	}
+
+	// The packages are sorted by URL. Sorting stably keeps that order for
+	// equal keys.
+	switch q.Sort {
+	case SortByName:
+		sort.SliceStable(res, func(i, j int) bool {
+			return res[i].Latest().Name < res[j].Latest().Name
+		})
+	case SortByURL:
+	case SortByUpdated:
+		sort.SliceStable(res, func(i, j int) bool {
+			return res[i].UpdatedAt().After(res[j].UpdatedAt())
+		})
+	case SortByDependents:
+		sort.SliceStable(res, func(i, j int) bool {
+			return res[i].Dependents > res[j].Dependents
+		})
+	case SortByPopularity:
+		popularity := map[string]int64{}
+		if r.stats != nil {
+			if popularity, err = r.stats.Popularity(ctx, PopularityDays); err != nil {
+				return nil, "", err
+			}
+		}
+		sort.SliceStable(res, func(i, j int) bool {
+			return popularity[res[i].Latest().URL] > popularity[res[j].Latest().URL]
+		})
+	default:
+		return nil, "", status.Errorf(codes.InvalidArgument, "invalid sort %d", q.Sort)
+	}
+
+	if offset > len(res) {
+		offset = len(res)
+	}
+	res = res[offset:]
+	if q.PageSize == 0 || len(res) <= q.PageSize {
+		return res, "", nil
+	}
+	return res[:q.PageSize], encodePageToken(offset + q.PageSize), nil
+}
+
+// The page tokens are opaque offsets into the result.
+
+func encodePageToken(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(offset)))
+}
+
+func decodePageToken(token string) (int, error) {
+	if token == "" {
+		return 0, nil
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return 0, status.Errorf(codes.InvalidArgument, "invalid page token '%s'", token)
+	}
+	offset, err := strconv.Atoi(string(decoded))
+	if err != nil || offset < 0 {
+		return 0, status.Errorf(codes.InvalidArgument, "invalid page token '%s'", token)
+	}
+	return offset, nil
+}
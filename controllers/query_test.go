@@ -0,0 +1,78 @@
+// Copyright (C) 2026 Toitware ApS. All rights reserved.
+// Use of this source code is governed by an MIT-style license that can be
+// found in the LICENSE file.
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/toitlang/tpkg/pkg/tpkg"
+)
+
+func Test_QueryPackages(t *testing.T) {
+	ctx := context.Background()
+	var descs []*tpkg.Desc
+	for _, d := range []string{
+		`{"name":"morse","url":"github.com/toitware/toit-morse","version":"1.0.0","license":"MIT"}`,
+		`{"name":"location","url":"gitlab.com/someone/location","version":"1.0.0","license":"mit",
+		  "dependencies":[{"url":"github.com/toitware/toit-morse","version":"^1.0.0"}]}`,
+		`{"name":"location","url":"gitlab.com/someone/location","version":"1.1.0","license":"mit",
+		  "dependencies":[{"url":"github.com/toitware/toit-morse","version":"^1.0.0"}]}`,
+		`{"name":"ubx","url":"github.com/toitware/ubx-message","version":"2.1.1","license":"Apache-2.0",
+		  "dependencies":[{"url":"github.com/toitware/toit-morse","version":"^1.0.0"}]}`,
+	} {
+		var desc tpkg.Desc
+		require.NoError(t, json.Unmarshal([]byte(d), &desc))
+		descs = append(descs, &desc)
+	}
+	packages, lookup := buildPackageStructure(descs)
+	assert.Equal(t, 2, lookup["github.com/toitware/toit-morse"].Dependents)
+	assert.Equal(t, 0, lookup["gitlab.com/someone/location"].Dependents)
+	lookup["github.com/toitware/ubx-message"].Releases["2.1.1"] = &Release{Time: time.Now()}
+
+	r := &registry{packages: packages, lookup: lookup}
+	names := func(q *PackageQuery) ([]string, string) {
+		res, next, err := r.QueryPackages(ctx, q)
+		require.NoError(t, err)
+		var names []string
+		for _, p := range res {
+			names = append(names, p.Latest().Name)
+		}
+		return names, next
+	}
+
+	res, next := names(&PackageQuery{})
+	assert.Equal(t, []string{"morse", "ubx", "location"}, res)
+	assert.Empty(t, next)
+	res, _ = names(&PackageQuery{Sort: SortByName})
+	assert.Equal(t, []string{"location", "morse", "ubx"}, res)
+	res, _ = names(&PackageQuery{Sort: SortByUpdated})
+	assert.Equal(t, []string{"ubx", "morse", "location"}, res)
+	res, _ = names(&PackageQuery{Sort: SortByDependents})
+	assert.Equal(t, []string{"morse", "ubx", "location"}, res)
+
+	res, _ = names(&PackageQuery{License: "MIT"})
+	assert.Equal(t, []string{"morse", "location"}, res)
+	res, _ = names(&PackageQuery{Host: "github.com"})
+	assert.Equal(t, []string{"morse", "ubx"}, res)
+	res, _ = names(&PackageQuery{URLPrefix: "github.com/toitware/toit-"})
+	assert.Equal(t, []string{"morse"}, res)
+	res, _ = names(&PackageQuery{HasDocs: true})
+	assert.Empty(t, res)
+
+	res, next = names(&PackageQuery{Sort: SortByName, PageSize: 2})
+	assert.Equal(t, []string{"location", "morse"}, res)
+	require.NotEmpty(t, next)
+	res, next = names(&PackageQuery{Sort: SortByName, PageSize: 2, PageToken: next})
+	assert.Equal(t, []string{"ubx"}, res)
+	assert.Empty(t, next)
+
+	_, _, err := r.QueryPackages(ctx, &PackageQuery{PageToken: "invalid"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,44 @@
+// Copyright (C) 2026 Toitware ApS. All rights reserved.
+// Use of this source code is governed by an MIT-style license that can be
+// found in the LICENSE file.
+
+package controllers
+
+import (
+	"context"
+	"errors"
+
+	"github.com/toitlang/tpkg/pkg/tpkg"
+	"github.com/toitware/tpkg/pkg/readme"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func provideReadme(logger *zap.Logger, manager readme.Manager) (*readmeCtrl, Readme) {
+	res := &readmeCtrl{
+		logger:  logger,
+		manager: manager,
+	}
+	return res, res
+}
+
+type Readme interface {
+	// Load returns the README and CHANGELOG of the package version.
+	// Returns ResourceExhausted if they have to be downloaded, but too many
+	// downloads happened recently.
+	Load(ctx context.Context, desc *tpkg.Desc) (*readme.Readme, error)
+}
+
+type readmeCtrl struct {
+	logger  *zap.Logger
+	manager readme.Manager
+}
+
+func (r *readmeCtrl) Load(ctx context.Context, desc *tpkg.Desc) (*readme.Readme, error) {
+	res, err := r.manager.Get(ctx, desc)
+	if errors.Is(err, readme.ErrRateLimited) {
+		return nil, status.Errorf(codes.ResourceExhausted, "the readme of '%s@%s' isn't available yet, try again later", desc.URL, desc.Version)
+	}
+	return res, err
+}
@@ -6,11 +6,15 @@ package controllers
 
 import (
 	"context"
+	"crypto/sha1"
+	"encoding/hex"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -18,9 +22,9 @@ import (
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/go-git/go-git/v5/plumbing/transport"
-	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
 	"github.com/toitlang/tpkg/pkg/tpkg"
 	"github.com/toitware/tpkg/config"
+	"github.com/toitware/tpkg/pkg/auth"
 	"go.uber.org/fx"
 	"go.uber.org/ratelimit"
 	"go.uber.org/zap"
@@ -28,16 +32,32 @@ import (
 	"google.golang.org/grpc/status"
 )
 
-func provideRegistry(config *config.Config, cache tpkg.Cache, logger *zap.Logger, ui tpkg.UI, r tpkg.Registry) (*registry, Registry, error) {
+func provideRegistry(config *config.Config, cache tpkg.Cache, logger *zap.Logger, ui tpkg.UI, r tpkg.Registry, upstreams upstreams, audit AuditLog, toitdoc Toitdoc, stats Stats) (*registry, Registry, error) {
 	if err := populateSSHKeyFile(config); err != nil {
 		return nil, nil, err
 	}
 
-	if _, err := os.Stat(config.Registry.SSHKeyFile); os.IsNotExist(err) {
-		return nil, nil, fmt.Errorf("Failed to load SSH key from path: '%s'", config.Registry.SSHKeyFile)
+	authMethod, err := newAuthMethod(config.Registry.Git, config.Registry.Url, config.Registry.SSHKeyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	signer, err := newSigner(config.Registry.Signing)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	policy, err := newPolicy(config.Policy)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	nameChecker, err := newNameChecker(config.Names)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	authMethod, err := ssh.NewPublicKeysFromFile("git", config.Registry.SSHKeyFile, "")
+	challenger, err := newChallenger(config.Ownership)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -48,16 +68,31 @@ func provideRegistry(config *config.Config, cache tpkg.Cache, logger *zap.Logger
 		packages:             []*Package{},
 		remoteRegistry:       r,
 		remoteRegistryConfig: config.Registry,
+		ownershipConfig:      config.Ownership,
+		upstreams:            upstreams,
 		authMethod:           authMethod,
+		readOnly:             authMethod == nil && !filepath.IsAbs(config.Registry.Url),
+		signer:               signer,
+		policy:               policy,
+		nameChecker:          nameChecker,
+		names:                &names{},
+		owners:               owners{},
+		challenger:           challenger,
+		audit:                audit,
+		changes:              newBroadcaster(logger),
+		toitdoc:              toitdoc,
+		stats:                stats,
 		cache:                cache,
-		syncLimit:            ratelimit.New(1, ratelimit.Per(5*time.Second), ratelimit.WithoutSlack),
+		syncLimit:            newSyncLimit(config.Registry.MinSyncInterval),
+		syncIntervalChanged:  make(chan struct{}, 1),
 		ui:                   ui,
 	}
 
 	return res, res, nil
 }
 
-func initRegistry(lc fx.Lifecycle, registry *registry) {
+func initRegistry(lc fx.Lifecycle, registry *registry, watcher *config.Watcher) {
+	watcher.Subscribe(registry.applyConfig)
 	lc.Append((fx.Hook{
 		OnStart: func(ctx context.Context) error {
 			if err := registry.sync(ctx); err != nil {
@@ -71,43 +106,253 @@ func initRegistry(lc fx.Lifecycle, registry *registry) {
 
 type Registry interface {
 	Packages(ctx context.Context) ([]*Package, error)
+	// QueryPackages returns a page of the matching packages and the token of
+	// the next page. The token is empty on the last page.
+	QueryPackages(ctx context.Context, query *PackageQuery) ([]*Package, string, error)
 	Package(ctx context.Context, url string) (*Package, error)
+	// Version returns the given version of the package, or its latest
+	// version if version is LatestVersion.
+	Version(ctx context.Context, url string, version string) (*VersionInfo, error)
+	// Match returns the versions of the package that satisfy the constraint,
+	// using the constraint syntax of package dependencies.
+	Match(ctx context.Context, url string, constraint string) (*Match, error)
 	Sync(ctx context.Context) error
-	RegisterPackage(ctx context.Context, url string, version string) error
+	// Generation identifies the synced state of the registry: the hash of
+	// the registry commit, combined with the commits of the upstreams if
+	// there are any. It is empty before the first sync.
+	Generation(ctx context.Context) string
+	// Sources returns the registry and its upstreams, sorted by descending
+	// priority.
+	Sources(ctx context.Context) ([]*Source, error)
+	// Watch returns a channel that receives the changes of the package set
+	// detected by future syncs. The channel is closed when the context is
+	// done, or when the receiver can't keep up.
+	Watch(ctx context.Context) <-chan *ChangeEvent
+	// RegisterPackage adds the given version of the package to the registry.
+	// If version is empty, adds the newest version tag of the repository.
+	// If dryRun is true, only runs the checks and doesn't commit anything.
+	RegisterPackage(ctx context.Context, url string, version string, dryRun bool) (*tpkg.Desc, error)
+	// ValidatePackage runs the registration checks on the package checkout at
+	// dir, as if it was registered with the given URL and version. The
+	// version is optional.
+	ValidatePackage(ctx context.Context, dir string, url string, version string) (*tpkg.Desc, error)
+	YankPackage(ctx context.Context, url string, version string, reason string) error
+	// Signature returns the detached signature of the description of the
+	// given version.
+	Signature(ctx context.Context, url string, version string) (*Signature, error)
+	// SigningKey returns the public key of the registry in authorized_keys
+	// format.
+	SigningKey(ctx context.Context) (string, error)
+
+	// NameAllowList returns the URLs of the packages that are exempt from the
+	// name checks.
+	NameAllowList(ctx context.Context) ([]string, error)
+	UpdateNameAllowList(ctx context.Context, add []string, remove []string) error
+	// NameReviews returns the registrations that wait for a manual review
+	// of their name.
+	NameReviews(ctx context.Context) ([]*NameReview, error)
+	// ResolveNameReview registers the pending version if approve is true,
+	// and allows its package to use the name. Otherwise drops the request.
+	ResolveNameReview(ctx context.Context, url string, version string, approve bool) error
+
+	Owners(ctx context.Context, url string) ([]*Owner, error)
+	AddOwner(ctx context.Context, url string, identity string) error
+	RemoveOwner(ctx context.Context, url string, identity string) error
+	// OwnershipChallenge returns the token the caller must commit to the
+	// OwnershipChallengeFile of the package repository to become an owner.
+	OwnershipChallenge(ctx context.Context, url string) (string, error)
+	// VerifyOwnershipChallenge adds the caller as owner if the package
+	// repository contains the caller's challenge token.
+	VerifyOwnershipChallenge(ctx context.Context, url string) error
+
+	// Snapshot returns the state of the registry as of the last sync.
+	Snapshot(ctx context.Context) (*Snapshot, error)
+	// ImportSnapshot commits the snapshot to the remote registry, which must
+	// not contain any packages yet, and syncs the registry.
+	ImportSnapshot(ctx context.Context, snapshot *Snapshot) error
+}
+
+// LatestVersion is the version that refers to the latest version of a
+// package.
+const LatestVersion = "latest"
+
+// VersionInfo is a version of a package with the metadata that isn't part of
+// its description.
+type VersionInfo struct {
+	Package *Package
+	Desc    *tpkg.Desc
+	// Raw is the content of the description file.
+	Raw []byte
+	// DocsBuilt is true if the docs of the version have been generated.
+	DocsBuilt bool
+}
+
+type Signature struct {
+	// Description is the signed content of the description file.
+	Description []byte
+	// Signature is the armored SSH signature of the description.
+	Signature []byte
+	Namespace string
 }
 
 type Package struct {
 	Lookup       map[string]*tpkg.Desc
-	Descriptions []*tpkg.Desc // Descriptions sorted by semver.
+	Descriptions []*tpkg.Desc      // Descriptions sorted by semver.
+	Yanked       map[string]string // Yank reasons by version.
+	Releases     map[string]*Release
+	// Dependents is the number of other packages that depend on some
+	// version of this package.
+	Dependents int
+	// Source is the name of the registry the package is served from.
+	Source string
 }
 
+// Latest returns the newest version that isn't yanked.
+// If all versions are yanked, returns the newest version.
 func (p *Package) Latest() *tpkg.Desc {
+	for i := len(p.Descriptions) - 1; i >= 0; i-- {
+		if !p.IsYanked(p.Descriptions[i].Version) {
+			return p.Descriptions[i]
+		}
+	}
 	return p.Descriptions[len(p.Descriptions)-1]
 }
 
+// UpdatedAt returns the time of the most recent release, or the zero time if
+// no release is known.
+func (p *Package) UpdatedAt() time.Time {
+	var res time.Time
+	for _, r := range p.Releases {
+		if r.Time.After(res) {
+			res = r.Time
+		}
+	}
+	return res
+}
+
+func (p *Package) IsYanked(version string) bool {
+	_, ok := p.Yanked[version]
+	return ok
+}
+
+// yankFileName is the name of the file that marks a version as yanked.
+// It is stored next to the description file and contains the reason.
+// It must not have a '.yaml' extension, as tpkg would try to parse it as
+// a description.
+const yankFileName = "YANKED"
+
+// registryCommitterName is the committer of all registry commits.
+const registryCommitterName = "Toit package registry"
+
 type registry struct {
 	lookup   map[string]*Package
 	packages []*Package // Packages sorted by name.
+	names    *names
+	owners   owners
+	history  *releaseHistory
 
 	logger               *zap.Logger
 	remoteRegistry       tpkg.Registry
 	remoteRegistryConfig config.Registry
+	ownershipConfig      config.Ownership
+	upstreams            upstreams
 	authMethod           transport.AuthMethod
+	signer               *signer
+	policy               *policy
+	nameChecker          *nameChecker
+	challenger           *challenger
+	audit                AuditLog
+	changes              *broadcaster
+	toitdoc              Toitdoc
+	stats                Stats
 	cache                tpkg.Cache
 	ui                   tpkg.UI
 	syncLimit            ratelimit.Limiter
+	syncIntervalChanged  chan struct{}
 	syncMutex            sync.Mutex
+	// configMutex guards the settings of remoteRegistryConfig and
+	// ownershipConfig that change without a restart, and the syncLimit.
+	configMutex sync.Mutex
+	// upstreamHeads are the synced commits of the upstreams. Guarded by the
+	// syncMutex.
+	upstreamHeads string
+	// readOnly is set for remote registries that are accessed anonymously.
+	readOnly bool
 }
 
-func (r *registry) autoSync() {
-	if r.remoteRegistryConfig.SyncInterval == 0 {
-		return
+// newSyncLimit limits the syncs on request to one per interval. Syncs aren't
+// limited if the interval is 0.
+func newSyncLimit(interval time.Duration) ratelimit.Limiter {
+	if interval <= 0 {
+		return ratelimit.NewUnlimited()
+	}
+	return ratelimit.New(1, ratelimit.Per(interval), ratelimit.WithoutSlack)
+}
+
+// applyConfig applies the changes of the registry settings that don't need a
+// restart.
+func (r *registry) applyConfig(change *config.Change) {
+	cfg := change.New.Registry
+	r.configMutex.Lock()
+	r.remoteRegistryConfig.AllowRewrite = cfg.AllowRewrite
+	r.remoteRegistryConfig.SyncInterval = cfg.SyncInterval
+	if change.Changed("registry.min_sync_interval") {
+		r.remoteRegistryConfig.MinSyncInterval = cfg.MinSyncInterval
+		r.syncLimit = newSyncLimit(cfg.MinSyncInterval)
+	}
+	r.ownershipConfig.OpenUnowned = change.New.Ownership.OpenUnowned
+	r.configMutex.Unlock()
+
+	if change.Changed("registry.sync_interval") {
+		select {
+		case r.syncIntervalChanged <- struct{}{}:
+		default:
+			// A change is pending already.
+		}
 	}
+}
+
+func (r *registry) allowRewrite() bool {
+	r.configMutex.Lock()
+	defer r.configMutex.Unlock()
+	return r.remoteRegistryConfig.AllowRewrite
+}
+
+func (r *registry) openUnowned() bool {
+	r.configMutex.Lock()
+	defer r.configMutex.Unlock()
+	return r.ownershipConfig.OpenUnowned
+}
+
+func (r *registry) syncInterval() time.Duration {
+	r.configMutex.Lock()
+	defer r.configMutex.Unlock()
+	return r.remoteRegistryConfig.SyncInterval
+}
 
-	ticker := time.NewTicker(r.remoteRegistryConfig.SyncInterval)
-	defer ticker.Stop()
+// autoSync syncs the registry at the configured interval, if any. Restarts
+// the interval when it changes.
+func (r *registry) autoSync() {
+	var ticker *time.Ticker
+	var tick <-chan time.Time
+	reset := func() {
+		if ticker != nil {
+			ticker.Stop()
+			ticker, tick = nil, nil
+		}
+		if interval := r.syncInterval(); interval > 0 {
+			ticker = time.NewTicker(interval)
+			tick = ticker.C
+		}
+	}
+	reset()
 	for {
-		<-ticker.C
+		select {
+		case <-r.syncIntervalChanged:
+			reset()
+			continue
+		case <-tick:
+		}
 		ctx, cancel := context.WithCancel(context.Background())
 		if err := r.sync(ctx); err != nil {
 			r.logger.Error("failed to auto sync registry", zap.Error(err))
@@ -134,8 +379,14 @@ func (r *registry) Package(ctx context.Context, url string) (*Package, error) {
 	return p, nil
 }
 
-func (r *registry) Sync(ctx context.Context) error {
-	r.syncLimit.Take()
+func (r *registry) Sync(ctx context.Context) (err error) {
+	ctx, done := startAudit(ctx, r.audit, "sync", "", nil)
+	defer func() { done(err) }()
+
+	r.configMutex.Lock()
+	limit := r.syncLimit
+	r.configMutex.Unlock()
+	limit.Take()
 	return r.sync(ctx)
 }
 
@@ -143,16 +394,73 @@ func (r *registry) sync(ctx context.Context) error {
 	if err := r.remoteRegistry.Load(ctx, true, r.cache, r.ui); err != nil {
 		return err
 	}
-	entries := r.remoteRegistry.Entries()
-	packages, packagesLookup := buildPackageStructure(entries)
+	upstreamErrors := r.syncUpstreams(ctx)
+	packages, packagesLookup, err := r.federate(r.remoteRegistry.Entries())
+	if err != nil {
+		return err
+	}
+	dir, err := r.registryPath()
+	if err != nil {
+		return err
+	}
+	// The history of upstreams isn't loaded.
+	var primary []*Package
+	for _, p := range packages {
+		if r.isPrimary(p) {
+			primary = append(primary, p)
+		}
+	}
+	history, err := r.loadReleases(dir, primary)
+	if err != nil {
+		return err
+	}
+	upstreamHeads := r.readUpstreamHeads()
+	names, err := loadNames(dir)
+	if err != nil {
+		return err
+	}
+	owners, err := loadOwners(dir)
+	if err != nil {
+		return err
+	}
 
 	r.syncMutex.Lock()
 	defer r.syncMutex.Unlock()
+	// Publish while holding the lock, so concurrent syncs don't reorder
+	// the events. The initial load isn't a change, the packages existed
+	// before the server started.
+	if r.history != nil {
+		r.changes.publish(diffPackages(r.lookup, packagesLookup, time.Now()))
+	}
 	r.packages = packages
 	r.lookup = packagesLookup
+	r.names = names
+	r.owners = owners
+	r.history = history
+	r.upstreamHeads = upstreamHeads
+	for i, u := range r.upstreams {
+		u.err = upstreamErrors[i]
+	}
 	return nil
 }
 
+func (r *registry) Generation(ctx context.Context) string {
+	r.syncMutex.Lock()
+	defer r.syncMutex.Unlock()
+	if r.history == nil {
+		return ""
+	}
+	if r.upstreamHeads == "" {
+		return r.history.head.String()
+	}
+	sum := sha1.Sum([]byte(r.history.head.String() + "," + r.upstreamHeads))
+	return hex.EncodeToString(sum[:])
+}
+
+func (r *registry) Watch(ctx context.Context) <-chan *ChangeEvent {
+	return r.changes.watch(ctx)
+}
+
 func buildPackageStructure(entries []*tpkg.Desc) ([]*Package, map[string]*Package) {
 	packagesLookup := map[string]*Package{}
 	packages := []*Package{}
@@ -162,6 +470,8 @@ func buildPackageStructure(entries []*tpkg.Desc) ([]*Package, map[string]*Packag
 			pkg := &Package{
 				Lookup:       map[string]*tpkg.Desc{},
 				Descriptions: []*tpkg.Desc{},
+				Yanked:       map[string]string{},
+				Releases:     map[string]*Release{},
 			}
 			packagesLookup[e.URL] = pkg
 			packages = append(packages, pkg)
@@ -175,6 +485,21 @@ func buildPackageStructure(entries []*tpkg.Desc) ([]*Package, map[string]*Packag
 		sort.Slice(p.Descriptions, func(i, j int) bool {
 			return p.Descriptions[i].IDCompare(p.Descriptions[j]) < 0
 		})
+
+		url := p.Descriptions[0].URL
+		dependencies := map[string]bool{}
+		for _, d := range p.Descriptions {
+			for _, dep := range d.Deps {
+				if dep.URL != url {
+					dependencies[dep.URL] = true
+				}
+			}
+		}
+		for dep := range dependencies {
+			if pkg, ok := packagesLookup[dep]; ok {
+				pkg.Dependents++
+			}
+		}
 	}
 	sort.Slice(packages, func(i, j int) bool {
 		return packages[i].Descriptions[0].IDCompare(packages[j].Descriptions[0]) < 0
@@ -182,76 +507,385 @@ func buildPackageStructure(entries []*tpkg.Desc) ([]*Package, map[string]*Packag
 	return packages, packagesLookup
 }
 
-func (r *registry) RegisterPackage(ctx context.Context, url string, version string) error {
+// registryPath returns the path of the local checkout of the remote registry.
+func (r *registry) registryPath() (string, error) {
+	return r.cache.FindRegistry(r.remoteRegistryConfig.Url)
+}
+
+// loadYanks sets the yanked versions of the packages from the registry
+// checkout at dir.
+func loadYanks(dir string, packages []*Package) error {
+	for _, p := range packages {
+		for _, d := range p.Descriptions {
+			content, err := ioutil.ReadFile(filepath.Join(dir, d.PackageDir(), yankFileName))
+			if os.IsNotExist(err) {
+				continue
+			} else if err != nil {
+				return err
+			}
+			p.Yanked[d.Version] = strings.TrimSpace(string(content))
+		}
+	}
+	return nil
+}
+
+func (r *registry) RegisterPackage(ctx context.Context, url string, version string, dryRun bool) (_ *tpkg.Desc, err error) {
+	if version == "" {
+		if version, err = latestVersionTag(ctx, url); err != nil {
+			return nil, err
+		}
+	}
+	ctx, done := startAudit(ctx, r.audit, "register", url, map[string]string{
+		"version": version,
+		"dry_run": strconv.FormatBool(dryRun),
+	})
+	defer func() { done(err) }()
 
 	desc, err := tpkg.ScrapeDescriptionGit(ctx, url, version, tpkg.DisallowLocalDeps, false, r.ui)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	dir, err := ioutil.TempDir("", "tmp")
-	if err != nil {
-		return err
+	r.syncMutex.Lock()
+	lookup := r.lookup
+	names := r.names
+	owners := r.owners
+	r.syncMutex.Unlock()
+
+	if pkg, ok := lookup[desc.URL]; ok {
+		if err := r.checkPrimary(pkg); err != nil {
+			return nil, err
+		}
+	}
+	// Everybody may register new packages, but only the owners may add
+	// versions to existing ones, unless unowned packages are open.
+	if _, ok := lookup[desc.URL]; ok || len(owners[desc.URL]) > 0 {
+		if err := owners.checkRegistrant(ctx, desc.URL, r.openUnowned()); err != nil {
+			return nil, err
+		}
 	}
-	defer os.RemoveAll(dir)
 
-	registryUrl := r.remoteRegistryConfig.Url
-	if !filepath.IsAbs(registryUrl) {
-		registryUrl = "ssh://" + registryUrl
+	if violations := r.policy.Check(desc, lookup); len(violations) > 0 {
+		return nil, policyError(url, version, violations)
 	}
-	branch := r.remoteRegistryConfig.Branch
-	repository, err := git.PlainCloneContext(ctx, dir, false, &git.CloneOptions{
-		URL:           registryUrl,
-		SingleBranch:  true,
-		ReferenceName: plumbing.NewBranchReferenceName(branch),
-		Auth:          r.authMethod,
+
+	if conflicts := r.nameChecker.Check(desc, lookup); len(conflicts) > 0 && !names.isAllowed(desc.URL) {
+		if r.nameChecker.action == NameActionReview && !dryRun {
+			if err := r.requestNameReview(ctx, desc, conflicts); err != nil {
+				return nil, err
+			}
+			return nil, nameError(url, version, conflicts, true)
+		}
+		return nil, nameError(url, version, conflicts, false)
+	}
+
+	if dryRun {
+		if pkg, ok := lookup[desc.URL]; ok && !r.allowRewrite() {
+			if _, ok := pkg.Lookup[desc.Version]; ok {
+				return nil, status.Errorf(codes.AlreadyExists, "Package %s version %s already exists", url, version)
+			}
+		}
+		return desc, nil
+	}
+
+	err = r.commit(ctx, fmt.Sprintf("Add %s version %s", url, version), func(dir string) ([]string, error) {
+		path, err := filepath.Abs(filepath.Join(dir, desc.PackageDir(), tpkg.DescriptionFileName))
+		if err != nil {
+			return nil, err
+		}
+
+		if !r.allowRewrite() {
+			if _, err := os.Stat(path); err == nil {
+				return nil, status.Errorf(codes.AlreadyExists, "Package %s version %s already exists", url, version)
+			}
+		}
+
+		// Check again, in case the package or its owners changed since the
+		// last sync.
+		owners, err := loadOwners(dir)
+		if err != nil {
+			return nil, err
+		}
+		_, err = os.Stat(filepath.Dir(filepath.Dir(path)))
+		if exists := err == nil; exists || len(owners[desc.URL]) > 0 {
+			if err := owners.checkRegistrant(ctx, desc.URL, r.openUnowned()); err != nil {
+				return nil, err
+			}
+		}
+
+		descPath, err := desc.WriteInDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		paths := []string{descPath}
+
+		// The identity that first registers a package becomes its owner.
+		identity := auth.FromContext(ctx)
+		if _, exists := lookup[desc.URL]; !exists && len(owners[desc.URL]) == 0 && !identity.IsAnonymous() {
+			owners[desc.URL] = []*Owner{{
+				Identity: identity.Name,
+				Method:   OwnerMethodRegistration,
+				AddedAt:  time.Now(),
+			}}
+			ownersPath, err := writeMetadata(dir, ownersFileName, owners)
+			if err != nil {
+				return nil, err
+			}
+			paths = append(paths, ownersPath)
+		}
+		if r.signer != nil && r.signer.detached {
+			sigPath, err := r.signer.signDescription(descPath)
+			if err != nil {
+				return nil, err
+			}
+			paths = append(paths, sigPath)
+		}
+		return paths, nil
 	})
 	if err != nil {
-		return err
+		return nil, err
 	}
+	return desc, nil
+}
 
-	path, err := filepath.Abs(filepath.Join(dir, desc.PackageDir(), tpkg.DescriptionFileName))
+func (r *registry) ValidatePackage(ctx context.Context, dir string, url string, version string) (*tpkg.Desc, error) {
+	desc, err := tpkg.ScrapeDescriptionAt(dir, tpkg.DisallowLocalDeps, false, r.ui)
 	if err != nil {
+		return nil, err
+	}
+	desc.URL = url
+	desc.Version = strings.TrimPrefix(version, "v")
+
+	r.syncMutex.Lock()
+	lookup := r.lookup
+	names := r.names
+	r.syncMutex.Unlock()
+
+	if pkg, ok := lookup[desc.URL]; ok {
+		if err := r.checkPrimary(pkg); err != nil {
+			return nil, err
+		}
+	}
+	if violations := r.policy.Check(desc, lookup); len(violations) > 0 {
+		return nil, policyError(url, version, violations)
+	}
+	if conflicts := r.nameChecker.Check(desc, lookup); len(conflicts) > 0 && !names.isAllowed(desc.URL) {
+		return nil, nameError(url, version, conflicts, false)
+	}
+	if pkg, ok := lookup[desc.URL]; ok && desc.Version != "" && !r.allowRewrite() {
+		if _, ok := pkg.Lookup[desc.Version]; ok {
+			return nil, status.Errorf(codes.AlreadyExists, "Package %s version %s already exists", url, version)
+		}
+	}
+	return desc, nil
+}
+
+func (r *registry) YankPackage(ctx context.Context, url string, version string, reason string) (err error) {
+	ctx, done := startAudit(ctx, r.audit, "yank", url, map[string]string{
+		"version": version,
+		"reason":  reason,
+	})
+	defer func() { done(err) }()
+
+	pkg, err := r.primaryPackage(ctx, url)
+	if err != nil {
+		return err
+	}
+	desc, ok := pkg.Lookup[version]
+	if !ok {
+		return status.Errorf(codes.NotFound, "package '%s' did not have a version '%s'", url, version)
+	}
+	if pkg.IsYanked(version) {
+		return status.Errorf(codes.AlreadyExists, "Package %s version %s is already yanked", url, version)
+	}
+	if err := r.checkOwner(ctx, url); err != nil {
 		return err
 	}
 
-	if !r.remoteRegistryConfig.AllowRewrite {
-		if _, err := os.Stat(path); err == nil {
-			return status.Errorf(codes.AlreadyExists, "Package %s version %s already exists", url, version)
+	return r.commit(ctx, fmt.Sprintf("Yank %s version %s", url, version), func(dir string) ([]string, error) {
+		path := filepath.Join(dir, desc.PackageDir(), yankFileName)
+		if err := ioutil.WriteFile(path, []byte(reason+"\n"), 0644); err != nil {
+			return nil, err
+		}
+		return []string{path}, nil
+	})
+}
+
+func (r *registry) Version(ctx context.Context, url string, version string) (*VersionInfo, error) {
+	pkg, err := r.Package(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	desc := pkg.Latest()
+	if version != LatestVersion {
+		var ok bool
+		if desc, ok = pkg.Lookup[version]; !ok {
+			return nil, status.Errorf(codes.NotFound, "package '%s' did not have a version '%s'", url, version)
 		}
 	}
 
-	descPath, err := desc.WriteInDir(dir)
+	dir, err := r.sourceDir(pkg)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := ioutil.ReadFile(filepath.Join(dir, desc.PackageDir(), tpkg.DescriptionFileName))
+	if err != nil {
+		return nil, err
+	}
+	return &VersionInfo{
+		Package:   pkg,
+		Desc:      desc,
+		Raw:       raw,
+		DocsBuilt: r.toitdoc != nil && r.toitdoc.Built(desc),
+	}, nil
+}
+
+func (r *registry) Signature(ctx context.Context, url string, version string) (*Signature, error) {
+	pkg, err := r.Package(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	desc, ok := pkg.Lookup[version]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "package '%s' did not have a version '%s'", url, version)
+	}
+
+	dir, err := r.sourceDir(pkg)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := ioutil.ReadFile(filepath.Join(dir, desc.PackageDir(), signatureFileName))
+	if os.IsNotExist(err) {
+		return nil, status.Errorf(codes.NotFound, "package '%s' version '%s' is not signed", url, version)
+	} else if err != nil {
+		return nil, err
+	}
+	description, err := ioutil.ReadFile(filepath.Join(dir, desc.PackageDir(), tpkg.DescriptionFileName))
+	if err != nil {
+		return nil, err
+	}
+	return &Signature{
+		Description: description,
+		Signature:   signature,
+		Namespace:   DescriptionSignatureNamespace,
+	}, nil
+}
+
+func (r *registry) SigningKey(ctx context.Context) (string, error) {
+	if r.signer == nil {
+		return "", status.Errorf(codes.NotFound, "the registry is not signed")
+	}
+	return r.signer.PublicKey(), nil
+}
+
+// commit clones the remote registry, lets 'update' modify the checkout and
+// pushes the files it returns as a single commit.
+func (r *registry) commit(ctx context.Context, message string, update func(dir string) ([]string, error)) error {
+	dir, err := ioutil.TempDir("", "tmp")
 	if err != nil {
 		return err
 	}
+	defer os.RemoveAll(dir)
 
-	relDescPath, err := filepath.Rel(dir, descPath)
+	repository, err := r.clone(ctx, dir)
 	if err != nil {
 		return err
 	}
 
-	wt, err := repository.Worktree()
+	paths, err := update(dir)
 	if err != nil {
 		return err
 	}
 
-	if err := wt.AddWithOptions(&git.AddOptions{Path: relDescPath}); err != nil {
+	// The caller is the author, so the history records who made the change.
+	if err := r.commitFiles(repository, dir, message, authorFromContext(ctx, time.Now()), paths); err != nil {
 		return err
 	}
+	return r.push(ctx, repository)
+}
 
-	if _, err := wt.Commit(fmt.Sprintf("Add %s version %s", url, version), &git.CommitOptions{
-		Author: &object.Signature{
-			Name: "Toit package registry",
-			When: time.Now(),
-		},
+// remoteURL returns the URL of the remote registry repository.
+func (r *registry) remoteURL() string {
+	cfg := r.remoteRegistryConfig
+	return config.RemoteURL(cfg.Url, cfg.Git.AuthMethod(cfg.Url, cfg.SSHKeyFile))
+}
+
+// clone checks out the branch of the remote registry in dir, to change it.
+func (r *registry) clone(ctx context.Context, dir string) (*git.Repository, error) {
+	if r.readOnly {
+		return nil, status.Errorf(codes.FailedPrecondition, "the registry is read-only, as it is accessed without auth")
+	}
+	return git.PlainCloneContext(ctx, dir, false, &git.CloneOptions{
+		URL:           r.remoteURL(),
+		SingleBranch:  true,
+		ReferenceName: plumbing.NewBranchReferenceName(r.remoteRegistryConfig.Branch),
+		Auth:          r.authMethod,
+	})
+}
+
+// authorFromContext returns the identity of the caller as commit signature.
+// Anonymous callers are recorded as the registry.
+func authorFromContext(ctx context.Context, when time.Time) *object.Signature {
+	if identity := auth.FromContext(ctx); !identity.IsAnonymous() {
+		return &object.Signature{
+			Name: identity.Name,
+			When: when,
+		}
+	}
+	return &object.Signature{
+		Name: registryCommitterName,
+		When: when,
+	}
+}
+
+// commitFiles commits the given files of the checkout at dir. The registry
+// is the committer, with the time of the author.
+func (r *registry) commitFiles(repository *git.Repository, dir string, message string, author *object.Signature, paths []string) error {
+	wt, err := repository.Worktree()
+	if err != nil {
+		return err
+	}
+
+	for _, path := range paths {
+		relPath, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if err := wt.AddWithOptions(&git.AddOptions{Path: relPath}); err != nil {
+			return err
+		}
+	}
+
+	committer := &object.Signature{
+		Name: registryCommitterName,
+		When: author.When,
+	}
+	if _, err := wt.Commit(message, &git.CommitOptions{
+		Author:    author,
+		Committer: committer,
 	}); err != nil {
 		return err
 	}
 
+	if r.signer != nil && r.signer.commits {
+		return r.signer.signHead(repository)
+	}
+	return nil
+}
+
+// push pushes the commits of the checkout to the remote registry, and
+// records the new head in the audit event of the context.
+func (r *registry) push(ctx context.Context, repository *git.Repository) error {
 	if err := repository.Push(&git.PushOptions{Auth: r.authMethod}); err != nil {
 		return err
 	}
 
+	if event := auditEventFromContext(ctx); event != nil {
+		head, err := repository.Head()
+		if err != nil {
+			return err
+		}
+		event.Commit = head.Hash().String()
+	}
 	return nil
 }
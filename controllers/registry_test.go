@@ -21,7 +21,10 @@ import (
 	"github.com/stretchr/testify/require"
 	"github.com/toitlang/tpkg/pkg/tpkg"
 	"github.com/toitware/tpkg/config"
+	"github.com/toitware/tpkg/pkg/auth"
 	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 func createFileRegistry(t *testing.T) string {
@@ -88,6 +91,16 @@ func checkPkgExists(t *testing.T, registry *registry, pkg, version string) {
 	require.NoError(t, err)
 }
 
+// checkoutMasterOnSync points the HEAD of the remote registry to the master
+// branch, so that syncing the registry clones it.
+func checkoutMasterOnSync(t *testing.T, registry *registry) {
+	r, err := git.PlainOpen(registry.remoteRegistryConfig.Url)
+	require.NoError(t, err)
+
+	ref := plumbing.NewSymbolicReference(plumbing.HEAD, plumbing.ReferenceName("refs/heads/master"))
+	require.NoError(t, r.Storer.SetReference(ref))
+}
+
 func withRegistry(t *testing.T, f func(context.Context, *registry)) {
 	ctx := context.Background()
 
@@ -116,6 +129,13 @@ func withRegistry(t *testing.T, f func(context.Context, *registry)) {
 		packages:             []*Package{},
 		remoteRegistry:       remoteRegistry,
 		remoteRegistryConfig: remoteRegistryConfig,
+		policy:               &policy{},
+		nameChecker:          &nameChecker{action: NameActionReject},
+		names:                &names{},
+		owners:               owners{},
+		challenger:           &challenger{secret: []byte("secret")},
+		audit:                &auditLog{logger: logger},
+		changes:              newBroadcaster(logger),
 		cache:                cache,
 		ui:                   ui,
 	}
@@ -125,7 +145,7 @@ func withRegistry(t *testing.T, f func(context.Context, *registry)) {
 
 func Test_register(t *testing.T) {
 	withRegistry(t, func(ctx context.Context, registry *registry) {
-		err := registry.RegisterPackage(ctx, "github.com/toitware/toit-morse", "v1.0.6")
+		_, err := registry.RegisterPackage(ctx, "github.com/toitware/toit-morse", "v1.0.6", false)
 		assert.NoError(t, err)
 
 		// Expect the file to be committed to the remote registry.
@@ -135,7 +155,7 @@ func Test_register(t *testing.T) {
 
 func Test_registerHttps(t *testing.T) {
 	withRegistry(t, func(ctx context.Context, registry *registry) {
-		err := registry.RegisterPackage(ctx, "https://github.com/toitware/toit-morse", "v1.0.6")
+		_, err := registry.RegisterPackage(ctx, "https://github.com/toitware/toit-morse", "v1.0.6", false)
 		assert.NoError(t, err)
 
 		// Expect the file to be committed to the remote registry.
@@ -147,7 +167,108 @@ func Test_registerNoName(t *testing.T) {
 	// Test that it is an error now if the package doesn't have a name/description in the
 	// package.yaml file.
 	withRegistry(t, func(ctx context.Context, registry *registry) {
-		err := registry.RegisterPackage(ctx, "github.com/toitware/toit-morse", "v1.0.0")
+		_, err := registry.RegisterPackage(ctx, "github.com/toitware/toit-morse", "v1.0.0", false)
 		assert.Error(t, err)
 	})
 }
+
+func Test_yank(t *testing.T) {
+	withRegistry(t, func(ctx context.Context, registry *registry) {
+		desc := tpkg.NewDesc("morse", "Morse code", "github.com/toitware/toit-morse", "1.0.6", "", "MIT", "1234", nil)
+		alice := auth.NewContext(ctx, &auth.Identity{Name: "alice"})
+		err := registry.commit(alice, "Add morse", func(dir string) ([]string, error) {
+			path, err := desc.WriteInDir(dir)
+			return []string{path}, err
+		})
+		require.NoError(t, err)
+		checkoutMasterOnSync(t, registry)
+		require.NoError(t, registry.sync(ctx))
+
+		pkg, err := registry.Package(ctx, "github.com/toitware/toit-morse")
+		require.NoError(t, err)
+		assert.False(t, pkg.IsYanked("1.0.6"))
+		// The history records who registered the version.
+		require.Contains(t, pkg.Releases, "1.0.6")
+		assert.Equal(t, "alice", pkg.Releases["1.0.6"].Committer)
+
+		// The package has no owners, so only administrators may yank it.
+		err = registry.YankPackage(ctx, "github.com/toitware/toit-morse", "1.0.6", "broken")
+		assert.Equal(t, codes.Unauthenticated, status.Code(err))
+		err = registry.YankPackage(alice, "github.com/toitware/toit-morse", "1.0.6", "broken")
+		assert.Equal(t, codes.PermissionDenied, status.Code(err))
+		admin := auth.NewContext(ctx, &auth.Identity{Name: "admin", Admin: true})
+		err = registry.YankPackage(admin, "github.com/toitware/toit-morse", "1.0.6", "broken")
+		require.NoError(t, err)
+		require.NoError(t, registry.sync(ctx))
+
+		pkg, err = registry.Package(ctx, "github.com/toitware/toit-morse")
+		require.NoError(t, err)
+		assert.True(t, pkg.IsYanked("1.0.6"))
+		assert.Equal(t, "broken", pkg.Yanked["1.0.6"])
+	})
+}
+
+func Test_version(t *testing.T) {
+	withRegistry(t, func(ctx context.Context, registry *registry) {
+		err := registry.commit(ctx, "Add morse", func(dir string) ([]string, error) {
+			var paths []string
+			for _, version := range []string{"1.0.5", "1.0.6"} {
+				desc := tpkg.NewDesc("morse", "Morse code", "github.com/toitware/toit-morse", version, "^1.0.0", "MIT", "1234", nil)
+				path, err := desc.WriteInDir(dir)
+				if err != nil {
+					return nil, err
+				}
+				paths = append(paths, path)
+			}
+			return paths, nil
+		})
+		require.NoError(t, err)
+		checkoutMasterOnSync(t, registry)
+		require.NoError(t, registry.sync(ctx))
+
+		info, err := registry.Version(ctx, "github.com/toitware/toit-morse", "1.0.5")
+		require.NoError(t, err)
+		assert.Equal(t, "1.0.5", info.Desc.Version)
+		assert.Equal(t, "^1.0.0", info.Desc.Environment.SDK)
+		assert.Contains(t, string(info.Raw), "version: 1.0.5")
+		assert.False(t, info.DocsBuilt)
+
+		info, err = registry.Version(ctx, "github.com/toitware/toit-morse", LatestVersion)
+		require.NoError(t, err)
+		assert.Equal(t, "1.0.6", info.Desc.Version)
+
+		_, err = registry.Version(ctx, "github.com/toitware/toit-morse", "2.0.0")
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	})
+}
+
+func Test_validate(t *testing.T) {
+	withRegistry(t, func(ctx context.Context, registry *registry) {
+		desc := tpkg.NewDesc("morse", "Morse code", "github.com/toitware/toit-morse", "1.0.6", "", "MIT", "1234", nil)
+		err := registry.commit(ctx, "Add morse", func(dir string) ([]string, error) {
+			path, err := desc.WriteInDir(dir)
+			return []string{path}, err
+		})
+		require.NoError(t, err)
+		checkoutMasterOnSync(t, registry)
+		require.NoError(t, registry.sync(ctx))
+
+		dir, err := ioutil.TempDir("", "tmp")
+		require.NoError(t, err)
+		defer os.RemoveAll(dir)
+		err = ioutil.WriteFile(filepath.Join(dir, "package.yaml"), []byte("name: morse\ndescription: Morse code\nlicense: MIT\n"), 0644)
+		require.NoError(t, err)
+		require.NoError(t, os.Mkdir(filepath.Join(dir, "src"), 0755))
+
+		validated, err := registry.ValidatePackage(ctx, dir, "github.com/toitware/toit-morse", "v1.0.7")
+		require.NoError(t, err)
+		assert.Equal(t, "1.0.7", validated.Version)
+
+		_, err = registry.ValidatePackage(ctx, dir, "github.com/toitware/toit-morse", "v1.0.6")
+		assert.Equal(t, codes.AlreadyExists, status.Code(err))
+
+		// Another package can't take the name.
+		_, err = registry.ValidatePackage(ctx, dir, "github.com/someone/morse", "")
+		assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	})
+}
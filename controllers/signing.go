@@ -0,0 +1,196 @@
+// Copyright (C) 2026 Toitware ApS. All rights reserved.
+// Use of this source code is governed by an MIT-style license that can be
+// found in the LICENSE file.
+
+package controllers
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/toitware/tpkg/config"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// signatureFileName is the name of the detached signature that is stored
+	// next to the description file.
+	signatureFileName = "desc.yaml.sig"
+
+	// DescriptionSignatureNamespace is the SSH signature namespace of
+	// description signatures. Verify with:
+	//   ssh-keygen -Y check-novalidate -n tpkg-registry -f key.pub -s desc.yaml.sig < desc.yaml
+	DescriptionSignatureNamespace = "tpkg-registry"
+
+	// commitSignatureNamespace is the namespace git uses for SSH signed commits.
+	commitSignatureNamespace = "git"
+
+	sshSignatureMagic   = "SSHSIG"
+	sshSignatureVersion = 1
+	sshSignatureHash    = "sha512"
+)
+
+type signer struct {
+	signer   ssh.Signer
+	detached bool
+	commits  bool
+}
+
+// newSigner returns the signer for the given configuration, or nil if
+// signing is disabled.
+func newSigner(cfg config.Signing) (*signer, error) {
+	key := []byte(cfg.Key)
+	if len(key) == 0 {
+		if cfg.KeyFile == "" {
+			return nil, nil
+		}
+		var err error
+		key, err = ioutil.ReadFile(cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to load signing key from path: '%s'", cfg.KeyFile)
+		}
+	}
+
+	s, err := ssh.ParsePrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse signing key: %v", err)
+	}
+	return &signer{
+		signer:   s,
+		detached: cfg.Detached,
+		commits:  cfg.Commits,
+	}, nil
+}
+
+// PublicKey returns the public key in authorized_keys format.
+func (s *signer) PublicKey() string {
+	return string(bytes.TrimSpace(ssh.MarshalAuthorizedKey(s.signer.PublicKey())))
+}
+
+// sign creates an armored SSH signature (as created by 'ssh-keygen -Y sign')
+// of the message.
+func (s *signer) sign(namespace string, message []byte) ([]byte, error) {
+	hash := sha512.Sum512(message)
+	signedData := append([]byte(sshSignatureMagic), ssh.Marshal(struct {
+		Namespace     string
+		Reserved      string
+		HashAlgorithm string
+		Hash          []byte
+	}{namespace, "", sshSignatureHash, hash[:]})...)
+
+	var signature *ssh.Signature
+	var err error
+	if algorithmSigner, ok := s.signer.(ssh.AlgorithmSigner); ok && s.signer.PublicKey().Type() == ssh.KeyAlgoRSA {
+		signature, err = algorithmSigner.SignWithAlgorithm(rand.Reader, signedData, ssh.KeyAlgoRSASHA512)
+	} else {
+		signature, err = s.signer.Sign(rand.Reader, signedData)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	blob := append([]byte(sshSignatureMagic), ssh.Marshal(struct {
+		Version       uint32
+		PublicKey     []byte
+		Namespace     string
+		Reserved      string
+		HashAlgorithm string
+		Signature     []byte
+	}{
+		sshSignatureVersion,
+		s.signer.PublicKey().Marshal(),
+		namespace,
+		"",
+		sshSignatureHash,
+		ssh.Marshal(signature),
+	})...)
+
+	return armorSSHSignature(blob), nil
+}
+
+func armorSSHSignature(blob []byte) []byte {
+	encoded := base64.StdEncoding.EncodeToString(blob)
+	var b bytes.Buffer
+	b.WriteString("-----BEGIN SSH SIGNATURE-----\n")
+	for len(encoded) > 70 {
+		b.WriteString(encoded[:70])
+		b.WriteString("\n")
+		encoded = encoded[70:]
+	}
+	b.WriteString(encoded)
+	b.WriteString("\n-----END SSH SIGNATURE-----\n")
+	return b.Bytes()
+}
+
+// signDescription writes the detached signature of the description at
+// descPath next to it, and returns the path of the signature.
+func (s *signer) signDescription(descPath string) (string, error) {
+	content, err := ioutil.ReadFile(descPath)
+	if err != nil {
+		return "", err
+	}
+	signature, err := s.sign(DescriptionSignatureNamespace, content)
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(filepath.Dir(descPath), signatureFileName)
+	if err := ioutil.WriteFile(path, signature, 0644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// signHead replaces the HEAD commit of the repository with a signed copy.
+func (s *signer) signHead(repository *git.Repository) error {
+	head, err := repository.Head()
+	if err != nil {
+		return err
+	}
+	commit, err := repository.CommitObject(head.Hash())
+	if err != nil {
+		return err
+	}
+
+	unsigned := &plumbing.MemoryObject{}
+	if err := commit.EncodeWithoutSignature(unsigned); err != nil {
+		return err
+	}
+	reader, err := unsigned.Reader()
+	if err != nil {
+		return err
+	}
+	content, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	signature, err := s.sign(commitSignatureNamespace, content)
+	if err != nil {
+		return err
+	}
+
+	signed := &object.Commit{
+		Author:       commit.Author,
+		Committer:    commit.Committer,
+		Message:      commit.Message,
+		TreeHash:     commit.TreeHash,
+		ParentHashes: commit.ParentHashes,
+		PGPSignature: string(signature),
+	}
+	obj := repository.Storer.NewEncodedObject()
+	if err := signed.Encode(obj); err != nil {
+		return err
+	}
+	hash, err := repository.Storer.SetEncodedObject(obj)
+	if err != nil {
+		return err
+	}
+	return repository.Storer.SetReference(plumbing.NewHashReference(head.Name(), hash))
+}
@@ -0,0 +1,70 @@
+// Copyright (C) 2026 Toitware ApS. All rights reserved.
+// Use of this source code is governed by an MIT-style license that can be
+// found in the LICENSE file.
+
+package controllers
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+func verifySSHSignature(t *testing.T, pub ssh.PublicKey, namespace string, message []byte, armored []byte) error {
+	body := strings.TrimSpace(string(armored))
+	require.True(t, strings.HasPrefix(body, "-----BEGIN SSH SIGNATURE-----"))
+	body = strings.TrimPrefix(body, "-----BEGIN SSH SIGNATURE-----")
+	body = strings.TrimSuffix(body, "-----END SSH SIGNATURE-----")
+	blob, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(body, "\n", ""))
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(string(blob), sshSignatureMagic))
+
+	var parsed struct {
+		Version       uint32
+		PublicKey     []byte
+		Namespace     string
+		Reserved      string
+		HashAlgorithm string
+		Signature     []byte
+	}
+	require.NoError(t, ssh.Unmarshal(blob[len(sshSignatureMagic):], &parsed))
+	assert.Equal(t, uint32(sshSignatureVersion), parsed.Version)
+	assert.Equal(t, namespace, parsed.Namespace)
+	assert.Equal(t, pub.Marshal(), parsed.PublicKey)
+
+	var signature ssh.Signature
+	require.NoError(t, ssh.Unmarshal(parsed.Signature, &signature))
+
+	hash := sha512.Sum512(message)
+	signedData := append([]byte(sshSignatureMagic), ssh.Marshal(struct {
+		Namespace     string
+		Reserved      string
+		HashAlgorithm string
+		Hash          []byte
+	}{namespace, "", parsed.HashAlgorithm, hash[:]})...)
+	return pub.Verify(signedData, &signature)
+}
+
+func Test_signDescription(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	sshSigner, err := ssh.NewSignerFromKey(key)
+	require.NoError(t, err)
+	s := &signer{signer: sshSigner, detached: true}
+
+	assert.True(t, strings.HasPrefix(s.PublicKey(), "ssh-ed25519 "))
+
+	message := []byte("name: morse\nurl: github.com/toitware/toit-morse\nversion: 1.0.6\n")
+	signature, err := s.sign(DescriptionSignatureNamespace, message)
+	require.NoError(t, err)
+
+	assert.NoError(t, verifySSHSignature(t, sshSigner.PublicKey(), DescriptionSignatureNamespace, message, signature))
+	assert.Error(t, verifySSHSignature(t, sshSigner.PublicKey(), DescriptionSignatureNamespace, []byte("tampered"), signature))
+}
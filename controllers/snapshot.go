@@ -0,0 +1,310 @@
+// Copyright (C) 2026 Toitware ApS. All rights reserved.
+// Use of this source code is governed by an MIT-style license that can be
+// found in the LICENSE file.
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/toitlang/tpkg/pkg/tpkg"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// SnapshotFormatVersion is the version of the snapshot format. Snapshots of
+// other versions can't be imported.
+const SnapshotFormatVersion = 1
+
+// Snapshot is the complete state of the registry, independent of its git
+// repository.
+type Snapshot struct {
+	FormatVersion int `json:"format_version"`
+	// Generation is the registry commit the snapshot was taken from.
+	Generation    string              `json:"generation,omitempty"`
+	CreatedAt     time.Time           `json:"created_at"`
+	Packages      []*SnapshotPackage  `json:"packages"`
+	Owners        map[string][]*Owner `json:"owners,omitempty"`
+	NameAllowList []string            `json:"name_allow_list,omitempty"`
+	NameReviews   []*NameReview       `json:"name_reviews,omitempty"`
+}
+
+type SnapshotPackage struct {
+	URL string `json:"url"`
+	// Versions are sorted by semver.
+	Versions []*SnapshotVersion `json:"versions"`
+}
+
+type SnapshotVersion struct {
+	Version string `json:"version"`
+	// Description is the content of the description file.
+	Description string `json:"description"`
+	// Signature is the detached signature of the description, if any.
+	Signature  string `json:"signature,omitempty"`
+	Yanked     bool   `json:"yanked,omitempty"`
+	YankReason string `json:"yank_reason,omitempty"`
+	// RegisteredAt and RegisteredBy are taken from the release, if it is
+	// known.
+	RegisteredAt time.Time `json:"registered_at,omitempty"`
+	RegisteredBy string    `json:"registered_by,omitempty"`
+}
+
+// ReadSnapshot decodes a JSON snapshot.
+func ReadSnapshot(r io.Reader) (*Snapshot, error) {
+	res := &Snapshot{}
+	if err := json.NewDecoder(r).Decode(res); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid snapshot: %v", err)
+	}
+	if res.FormatVersion != SnapshotFormatVersion {
+		return nil, status.Errorf(codes.InvalidArgument, "unsupported snapshot format version %d, expected %d", res.FormatVersion, SnapshotFormatVersion)
+	}
+	return res, nil
+}
+
+// Write encodes the snapshot as JSON.
+func (s *Snapshot) Write(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(s)
+}
+
+// snapshotPackageDir returns the directory of the version in the registry
+// checkout at dir. Fails if it isn't inside the packages directory.
+func snapshotPackageDir(dir string, url string, version string) (string, error) {
+	desc := &tpkg.Desc{URL: url, Version: version}
+	res := filepath.Join(dir, desc.PackageDir())
+	rel, err := filepath.Rel(filepath.Join(dir, tpkg.PackageDescriptionDir), res)
+	if url == "" || version == "" || err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return "", status.Errorf(codes.InvalidArgument, "invalid package '%s' version '%s'", url, version)
+	}
+	return res, nil
+}
+
+func (r *registry) Snapshot(ctx context.Context) (*Snapshot, error) {
+	r.syncMutex.Lock()
+	packages := r.packages
+	owners := r.owners
+	n := r.names
+	var generation string
+	if r.history != nil {
+		generation = r.history.head.String()
+	}
+	r.syncMutex.Unlock()
+
+	dir, err := r.registryPath()
+	if err != nil {
+		return nil, err
+	}
+	res := &Snapshot{
+		FormatVersion: SnapshotFormatVersion,
+		Generation:    generation,
+		CreatedAt:     time.Now().UTC(),
+		Owners:        owners,
+		NameAllowList: n.Allowed,
+		NameReviews:   n.Pending,
+	}
+	for _, p := range packages {
+		if !r.isPrimary(p) {
+			// Upstream packages are part of the snapshots of their registries.
+			continue
+		}
+		pkg := &SnapshotPackage{URL: p.Descriptions[0].URL}
+		for _, d := range p.Descriptions {
+			version := &SnapshotVersion{Version: d.Version}
+			description, err := ioutil.ReadFile(filepath.Join(dir, d.PackageDir(), tpkg.DescriptionFileName))
+			if err != nil {
+				return nil, err
+			}
+			version.Description = string(description)
+			signature, err := ioutil.ReadFile(filepath.Join(dir, d.PackageDir(), signatureFileName))
+			if err == nil {
+				version.Signature = string(signature)
+			} else if !os.IsNotExist(err) {
+				return nil, err
+			}
+			if reason, ok := p.Yanked[d.Version]; ok {
+				version.Yanked = true
+				version.YankReason = reason
+			}
+			if release, ok := p.Releases[d.Version]; ok {
+				version.RegisteredAt = release.Time.UTC()
+				version.RegisteredBy = release.Committer
+			}
+			pkg.Versions = append(pkg.Versions, version)
+		}
+		res.Packages = append(res.Packages, pkg)
+	}
+	return res, nil
+}
+
+func (r *registry) ImportSnapshot(ctx context.Context, snapshot *Snapshot) (err error) {
+	ctx, done := startAudit(ctx, r.audit, "import_snapshot", "", map[string]string{
+		"generation": snapshot.Generation,
+		"packages":   strconv.Itoa(len(snapshot.Packages)),
+	})
+	defer func() { done(err) }()
+
+	if len(snapshot.Packages) == 0 {
+		return status.Errorf(codes.InvalidArgument, "the snapshot doesn't contain any packages")
+	}
+
+	dir, err := ioutil.TempDir("", "tmp")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	repository, err := r.clone(ctx, dir)
+	if err == transport.ErrEmptyRemoteRepository {
+		repository, err = r.initRepository(dir)
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(filepath.Join(dir, tpkg.PackageDescriptionDir)); err == nil {
+		return status.Errorf(codes.FailedPrecondition, "the registry already contains packages")
+	}
+
+	if err := r.importSnapshot(ctx, repository, dir, snapshot); err != nil {
+		return err
+	}
+	if err := r.push(ctx, repository); err != nil {
+		return err
+	}
+	return r.sync(ctx)
+}
+
+// initRepository creates a repository in dir for an empty remote registry.
+func (r *registry) initRepository(dir string) (*git.Repository, error) {
+	repository, err := git.PlainInit(dir, false)
+	if err != nil {
+		return nil, err
+	}
+	branch := plumbing.NewBranchReferenceName(r.remoteRegistryConfig.Branch)
+	if err := repository.Storer.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, branch)); err != nil {
+		return nil, err
+	}
+	if _, err := repository.CreateRemote(&gitconfig.RemoteConfig{
+		Name: git.DefaultRemoteName,
+		URLs: []string{r.remoteURL()},
+	}); err != nil {
+		return nil, err
+	}
+	return repository, nil
+}
+
+// importSnapshot commits the snapshot to the checkout at dir. Every version
+// is committed separately, in the order of registration and with its
+// original author and time, so the history yields the same releases. The
+// yanks, owners and names follow in a last commit.
+func (r *registry) importSnapshot(ctx context.Context, repository *git.Repository, dir string, snapshot *Snapshot) error {
+	type entry struct {
+		url     string
+		version *SnapshotVersion
+	}
+	var entries []entry
+	for _, p := range snapshot.Packages {
+		for _, v := range p.Versions {
+			entries = append(entries, entry{url: p.URL, version: v})
+		}
+	}
+	// Versions without a known registration go last.
+	sort.SliceStable(entries, func(i, j int) bool {
+		ti, tj := entries[i].version.RegisteredAt, entries[j].version.RegisteredAt
+		if ti.IsZero() || tj.IsZero() {
+			return !ti.IsZero() && tj.IsZero()
+		}
+		return ti.Before(tj)
+	})
+
+	var metadata []string
+	for _, e := range entries {
+		v := e.version
+		packageDir, err := snapshotPackageDir(dir, e.url, v.Version)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(packageDir, 0755); err != nil {
+			return err
+		}
+		descPath := filepath.Join(packageDir, tpkg.DescriptionFileName)
+		if _, err := os.Stat(descPath); err == nil {
+			return status.Errorf(codes.InvalidArgument, "duplicate package '%s' version '%s'", e.url, v.Version)
+		}
+		if err := ioutil.WriteFile(descPath, []byte(v.Description), 0644); err != nil {
+			return err
+		}
+		paths := []string{descPath}
+		if v.Signature != "" {
+			sigPath := filepath.Join(packageDir, signatureFileName)
+			if err := ioutil.WriteFile(sigPath, []byte(v.Signature), 0644); err != nil {
+				return err
+			}
+			paths = append(paths, sigPath)
+		}
+		if v.Yanked {
+			yankPath := filepath.Join(packageDir, yankFileName)
+			if err := ioutil.WriteFile(yankPath, []byte(v.YankReason+"\n"), 0644); err != nil {
+				return err
+			}
+			metadata = append(metadata, yankPath)
+		}
+
+		author := &object.Signature{
+			Name: v.RegisteredBy,
+			When: v.RegisteredAt,
+		}
+		if author.Name == "" {
+			author.Name = registryCommitterName
+		}
+		if author.When.IsZero() {
+			author.When = snapshot.CreatedAt
+		}
+		message := fmt.Sprintf("Add %s version %s", e.url, v.Version)
+		if err := r.commitFiles(repository, dir, message, author, paths); err != nil {
+			return err
+		}
+	}
+
+	if len(snapshot.Owners) > 0 {
+		path, err := writeMetadata(dir, ownersFileName, owners(snapshot.Owners))
+		if err != nil {
+			return err
+		}
+		metadata = append(metadata, path)
+	}
+	if len(snapshot.NameAllowList) > 0 || len(snapshot.NameReviews) > 0 {
+		n := &names{
+			Allowed: snapshot.NameAllowList,
+			Pending: snapshot.NameReviews,
+		}
+		path, err := n.write(dir)
+		if err != nil {
+			return err
+		}
+		metadata = append(metadata, path)
+	}
+	if len(metadata) == 0 {
+		return nil
+	}
+	message := "Import snapshot"
+	if snapshot.Generation != "" {
+		message += " of " + snapshot.Generation
+	}
+	return r.commitFiles(repository, dir, message, authorFromContext(ctx, time.Now()), metadata)
+}
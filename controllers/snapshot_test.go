@@ -0,0 +1,86 @@
+// Copyright (C) 2026 Toitware ApS. All rights reserved.
+// Use of this source code is governed by an MIT-style license that can be
+// found in the LICENSE file.
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/toitlang/tpkg/pkg/tpkg"
+	"github.com/toitware/tpkg/pkg/auth"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func Test_snapshot(t *testing.T) {
+	var snapshot *Snapshot
+	withRegistry(t, func(ctx context.Context, registry *registry) {
+		alice := auth.NewContext(ctx, &auth.Identity{Name: "alice"})
+		for _, version := range []string{"1.0.5", "1.0.6"} {
+			desc := tpkg.NewDesc("morse", "Morse code", "github.com/toitware/toit-morse", version, "", "MIT", "1234", nil)
+			err := registry.commit(alice, "Add morse "+version, func(dir string) ([]string, error) {
+				path, err := desc.WriteInDir(dir)
+				return []string{path}, err
+			})
+			require.NoError(t, err)
+		}
+		checkoutMasterOnSync(t, registry)
+		require.NoError(t, registry.sync(ctx))
+		admin := auth.NewContext(ctx, &auth.Identity{Name: "admin", Admin: true})
+		require.NoError(t, registry.YankPackage(admin, "github.com/toitware/toit-morse", "1.0.5", "broken"))
+		require.NoError(t, registry.UpdateNameAllowList(ctx, []string{"github.com/toitware/toit-morse"}, nil))
+
+		var err error
+		snapshot, err = registry.Snapshot(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, registry.Generation(ctx), snapshot.Generation)
+		require.Len(t, snapshot.Packages, 1)
+		require.Len(t, snapshot.Packages[0].Versions, 2)
+		v := snapshot.Packages[0].Versions[0]
+		assert.Equal(t, "1.0.5", v.Version)
+		assert.Contains(t, v.Description, "version: 1.0.5")
+		assert.True(t, v.Yanked)
+		assert.Equal(t, "broken", v.YankReason)
+		assert.Equal(t, "alice", v.RegisteredBy)
+	})
+
+	var buf bytes.Buffer
+	require.NoError(t, snapshot.Write(&buf))
+	decoded, err := ReadSnapshot(&buf)
+	require.NoError(t, err)
+
+	withRegistry(t, func(ctx context.Context, registry *registry) {
+		checkoutMasterOnSync(t, registry)
+		require.NoError(t, registry.ImportSnapshot(ctx, decoded))
+
+		pkg, err := registry.Package(ctx, "github.com/toitware/toit-morse")
+		require.NoError(t, err)
+		require.Len(t, pkg.Descriptions, 2)
+		assert.Equal(t, "broken", pkg.Yanked["1.0.5"])
+		assert.False(t, pkg.IsYanked("1.0.6"))
+		// The history keeps the original registrations.
+		for _, v := range decoded.Packages[0].Versions {
+			require.Contains(t, pkg.Releases, v.Version)
+			assert.Equal(t, "alice", pkg.Releases[v.Version].Committer)
+			assert.True(t, v.RegisteredAt.Equal(pkg.Releases[v.Version].Time))
+		}
+		allowed, err := registry.NameAllowList(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"github.com/toitware/toit-morse"}, allowed)
+
+		// Only fresh registries can be imported into.
+		err = registry.ImportSnapshot(ctx, decoded)
+		assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	})
+}
+
+func Test_readSnapshotVersion(t *testing.T) {
+	_, err := ReadSnapshot(strings.NewReader(`{"format_version": 2, "packages": []}`))
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
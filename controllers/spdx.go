@@ -0,0 +1,471 @@
+// Copyright (C) 2026 Toitware ApS. All rights reserved.
+// Use of this source code is governed by an MIT-style license that can be
+// found in the LICENSE file.
+
+package controllers
+
+// spdxLicenseIDs are the SPDX license identifiers.
+// Extracted from: https://raw.githubusercontent.com/spdx/license-list-data/master/json/licenses.json
+var spdxLicenseIDs = map[string]bool{
+	"0BSD":                                 true,
+	"AAL":                                  true,
+	"Abstyles":                             true,
+	"Adobe-2006":                           true,
+	"Adobe-Glyph":                          true,
+	"ADSL":                                 true,
+	"AFL-1.1":                              true,
+	"AFL-1.2":                              true,
+	"AFL-2.0":                              true,
+	"AFL-2.1":                              true,
+	"AFL-3.0":                              true,
+	"Afmparse":                             true,
+	"AGPL-1.0":                             true,
+	"AGPL-1.0-only":                        true,
+	"AGPL-1.0-or-later":                    true,
+	"AGPL-3.0":                             true,
+	"AGPL-3.0-only":                        true,
+	"AGPL-3.0-or-later":                    true,
+	"Aladdin":                              true,
+	"AMDPLPA":                              true,
+	"AML":                                  true,
+	"AMPAS":                                true,
+	"ANTLR-PD":                             true,
+	"ANTLR-PD-fallback":                    true,
+	"Apache-1.0":                           true,
+	"Apache-1.1":                           true,
+	"Apache-2.0":                           true,
+	"APAFML":                               true,
+	"APL-1.0":                              true,
+	"APSL-1.0":                             true,
+	"APSL-1.1":                             true,
+	"APSL-1.2":                             true,
+	"APSL-2.0":                             true,
+	"Artistic-1.0":                         true,
+	"Artistic-1.0-cl8":                     true,
+	"Artistic-1.0-Perl":                    true,
+	"Artistic-2.0":                         true,
+	"Bahyph":                               true,
+	"Barr":                                 true,
+	"Beerware":                             true,
+	"BitTorrent-1.0":                       true,
+	"BitTorrent-1.1":                       true,
+	"blessing":                             true,
+	"BlueOak-1.0.0":                        true,
+	"Borceux":                              true,
+	"BSD-1-Clause":                         true,
+	"BSD-2-Clause":                         true,
+	"BSD-2-Clause-FreeBSD":                 true,
+	"BSD-2-Clause-NetBSD":                  true,
+	"BSD-2-Clause-Patent":                  true,
+	"BSD-2-Clause-Views":                   true,
+	"BSD-3-Clause":                         true,
+	"BSD-3-Clause-Attribution":             true,
+	"BSD-3-Clause-Clear":                   true,
+	"BSD-3-Clause-LBNL":                    true,
+	"BSD-3-Clause-Modification":            true,
+	"BSD-3-Clause-No-Military-License":     true,
+	"BSD-3-Clause-No-Nuclear-License":      true,
+	"BSD-3-Clause-No-Nuclear-License-2014": true,
+	"BSD-3-Clause-No-Nuclear-Warranty":     true,
+	"BSD-3-Clause-Open-MPI":                true,
+	"BSD-4-Clause-Shortened":               true,
+	"BSD-4-Clause-UC":                      true,
+	"BSD-Protection":                       true,
+	"BSD-Source-Code":                      true,
+	"BSL-1.0":                              true,
+	"BUSL-1.1":                             true,
+	"bzip2-1.0.5":                          true,
+	"bzip2-1.0.6":                          true,
+	"C-UDA-1.0":                            true,
+	"CAL-1.0":                              true,
+	"CAL-1.0-Combined-Work-Exception":      true,
+	"Caldera":                              true,
+	"CATOSL-1.1":                           true,
+	"CC-BY-1.0":                            true,
+	"CC-BY-2.0":                            true,
+	"CC-BY-2.5":                            true,
+	"CC-BY-2.5-AU":                         true,
+	"CC-BY-3.0":                            true,
+	"CC-BY-3.0-AT":                         true,
+	"CC-BY-3.0-US":                         true,
+	"CC-BY-4.0":                            true,
+	"CC-BY-NC-1.0":                         true,
+	"CC-BY-NC-2.0":                         true,
+	"CC-BY-NC-2.5":                         true,
+	"CC-BY-NC-3.0":                         true,
+	"CC-BY-NC-4.0":                         true,
+	"CC-BY-NC-ND-1.0":                      true,
+	"CC-BY-NC-ND-2.0":                      true,
+	"CC-BY-NC-ND-2.5":                      true,
+	"CC-BY-NC-ND-3.0":                      true,
+	"CC-BY-NC-ND-3.0-IGO":                  true,
+	"CC-BY-NC-ND-4.0":                      true,
+	"CC-BY-NC-SA-1.0":                      true,
+	"CC-BY-NC-SA-2.0":                      true,
+	"CC-BY-NC-SA-2.5":                      true,
+	"CC-BY-NC-SA-3.0":                      true,
+	"CC-BY-NC-SA-4.0":                      true,
+	"CC-BY-ND-1.0":                         true,
+	"CC-BY-ND-2.0":                         true,
+	"CC-BY-ND-2.5":                         true,
+	"CC-BY-ND-3.0":                         true,
+	"CC-BY-ND-4.0":                         true,
+	"CC-BY-SA-1.0":                         true,
+	"CC-BY-SA-2.0":                         true,
+	"CC-BY-SA-2.0-UK":                      true,
+	"CC-BY-SA-2.1-JP":                      true,
+	"CC-BY-SA-2.5":                         true,
+	"CC-BY-SA-3.0":                         true,
+	"CC-BY-SA-3.0-AT":                      true,
+	"CC-BY-SA-4.0":                         true,
+	"CC-PDDC":                              true,
+	"CC0-1.0":                              true,
+	"CDDL-1.0":                             true,
+	"CDDL-1.1":                             true,
+	"CDL-1.0":                              true,
+	"CDLA-Permissive-1.0":                  true,
+	"CDLA-Sharing-1.0":                     true,
+	"CECILL-1.0":                           true,
+	"CECILL-1.1":                           true,
+	"CECILL-2.0":                           true,
+	"CECILL-2.1":                           true,
+	"CECILL-B":                             true,
+	"CECILL-C":                             true,
+	"CERN-OHL-1.1":                         true,
+	"CERN-OHL-1.2":                         true,
+	"CERN-OHL-P-2.0":                       true,
+	"CERN-OHL-S-2.0":                       true,
+	"CERN-OHL-W-2.0":                       true,
+	"ClArtistic":                           true,
+	"CNRI-Jython":                          true,
+	"CNRI-Python":                          true,
+	"CNRI-Python-GPL-Compatible":           true,
+	"Condor-1.1":                           true,
+	"copyleft-next-0.3.0":                  true,
+	"copyleft-next-0.3.1":                  true,
+	"CPAL-1.0":                             true,
+	"CPL-1.0":                              true,
+	"CPOL-1.02":                            true,
+	"Crossword":                            true,
+	"CrystalStacker":                       true,
+	"CUA-OPL-1.0":                          true,
+	"Cube":                                 true,
+	"curl":                                 true,
+	"D-FSL-1.0":                            true,
+	"diffmark":                             true,
+	"DOC":                                  true,
+	"Dotseqn":                              true,
+	"DRL-1.0":                              true,
+	"DSDP":                                 true,
+	"dvipdfm":                              true,
+	"ECL-1.0":                              true,
+	"ECL-2.0":                              true,
+	"eCos-2.0":                             true,
+	"EFL-1.0":                              true,
+	"EFL-2.0":                              true,
+	"eGenix":                               true,
+	"Entessa":                              true,
+	"EPICS":                                true,
+	"EPL-1.0":                              true,
+	"EPL-2.0":                              true,
+	"ErlPL-1.1":                            true,
+	"etalab-2.0":                           true,
+	"EUDatagrid":                           true,
+	"EUPL-1.0":                             true,
+	"EUPL-1.1":                             true,
+	"EUPL-1.2":                             true,
+	"Eurosym":                              true,
+	"Fair":                                 true,
+	"Frameworx-1.0":                        true,
+	"FreeBSD-DOC":                          true,
+	"FreeImage":                            true,
+	"FSFAP":                                true,
+	"FSFUL":                                true,
+	"FSFULLR":                              true,
+	"FTL":                                  true,
+	"GD":                                   true,
+	"GFDL-1.1":                             true,
+	"GFDL-1.1-invariants-only":             true,
+	"GFDL-1.1-invariants-or-later":         true,
+	"GFDL-1.1-no-invariants-only":          true,
+	"GFDL-1.1-no-invariants-or-later":      true,
+	"GFDL-1.1-only":                        true,
+	"GFDL-1.1-or-later":                    true,
+	"GFDL-1.2":                             true,
+	"GFDL-1.2-invariants-only":             true,
+	"GFDL-1.2-invariants-or-later":         true,
+	"GFDL-1.2-no-invariants-only":          true,
+	"GFDL-1.2-no-invariants-or-later":      true,
+	"GFDL-1.2-only":                        true,
+	"GFDL-1.2-or-later":                    true,
+	"GFDL-1.3":                             true,
+	"GFDL-1.3-invariants-only":             true,
+	"GFDL-1.3-invariants-or-later":         true,
+	"GFDL-1.3-no-invariants-only":          true,
+	"GFDL-1.3-no-invariants-or-later":      true,
+	"GFDL-1.3-only":                        true,
+	"GFDL-1.3-or-later":                    true,
+	"Giftware":                             true,
+	"GL2PS":                                true,
+	"Glide":                                true,
+	"Glulxe":                               true,
+	"GLWTPL":                               true,
+	"gnuplot":                              true,
+	"GPL-1.0":                              true,
+	"GPL-1.0+":                             true,
+	"GPL-1.0-only":                         true,
+	"GPL-1.0-or-later":                     true,
+	"GPL-2.0":                              true,
+	"GPL-2.0+":                             true,
+	"GPL-2.0-only":                         true,
+	"GPL-2.0-or-later":                     true,
+	"GPL-2.0-with-autoconf-exception":      true,
+	"GPL-2.0-with-bison-exception":         true,
+	"GPL-2.0-with-classpath-exception":     true,
+	"GPL-2.0-with-font-exception":          true,
+	"GPL-2.0-with-GCC-exception":           true,
+	"GPL-3.0":                              true,
+	"GPL-3.0+":                             true,
+	"GPL-3.0-only":                         true,
+	"GPL-3.0-or-later":                     true,
+	"GPL-3.0-with-autoconf-exception":      true,
+	"GPL-3.0-with-GCC-exception":           true,
+	"gSOAP-1.3b":                           true,
+	"HaskellReport":                        true,
+	"Hippocratic-2.1":                      true,
+	"HPND":                                 true,
+	"HPND-sell-variant":                    true,
+	"HTMLTIDY":                             true,
+	"IBM-pibs":                             true,
+	"ICU":                                  true,
+	"IJG":                                  true,
+	"ImageMagick":                          true,
+	"iMatix":                               true,
+	"Imlib2":                               true,
+	"Info-ZIP":                             true,
+	"Intel":                                true,
+	"Intel-ACPI":                           true,
+	"Interbase-1.0":                        true,
+	"IPA":                                  true,
+	"IPL-1.0":                              true,
+	"ISC":                                  true,
+	"JasPer-2.0":                           true,
+	"JPNIC":                                true,
+	"JSON":                                 true,
+	"LAL-1.2":                              true,
+	"LAL-1.3":                              true,
+	"Latex2e":                              true,
+	"Leptonica":                            true,
+	"LGPL-2.0":                             true,
+	"LGPL-2.0+":                            true,
+	"LGPL-2.0-only":                        true,
+	"LGPL-2.0-or-later":                    true,
+	"LGPL-2.1":                             true,
+	"LGPL-2.1+":                            true,
+	"LGPL-2.1-only":                        true,
+	"LGPL-2.1-or-later":                    true,
+	"LGPL-3.0":                             true,
+	"LGPL-3.0+":                            true,
+	"LGPL-3.0-only":                        true,
+	"LGPL-3.0-or-later":                    true,
+	"LGPLLR":                               true,
+	"Libpng":                               true,
+	"libpng-2.0":                           true,
+	"libselinux-1.0":                       true,
+	"libtiff":                              true,
+	"LiLiQ-P-1.1":                          true,
+	"LiLiQ-R-1.1":                          true,
+	"LiLiQ-Rplus-1.1":                      true,
+	"Linux-OpenIB":                         true,
+	"LPL-1.0":                              true,
+	"LPL-1.02":                             true,
+	"LPPL-1.0":                             true,
+	"LPPL-1.1":                             true,
+	"LPPL-1.2":                             true,
+	"LPPL-1.3a":                            true,
+	"LPPL-1.3c":                            true,
+	"MakeIndex":                            true,
+	"MirOS":                                true,
+	"MIT":                                  true,
+	"MIT-0":                                true,
+	"MIT-advertising":                      true,
+	"MIT-CMU":                              true,
+	"MIT-enna":                             true,
+	"MIT-feh":                              true,
+	"MIT-Modern-Variant":                   true,
+	"MIT-open-group":                       true,
+	"MITNFA":                               true,
+	"Motosoto":                             true,
+	"mpich2":                               true,
+	"MPL-1.0":                              true,
+	"MPL-1.1":                              true,
+	"MPL-2.0":                              true,
+	"MPL-2.0-no-copyleft-exception":        true,
+	"MS-PL":                                true,
+	"MS-RL":                                true,
+	"MTLL":                                 true,
+	"MulanPSL-1.0":                         true,
+	"MulanPSL-2.0":                         true,
+	"Multics":                              true,
+	"Mup":                                  true,
+	"NAIST-2003":                           true,
+	"NASA-1.3":                             true,
+	"Naumen":                               true,
+	"NBPL-1.0":                             true,
+	"NCGL-UK-2.0":                          true,
+	"NCSA":                                 true,
+	"Net-SNMP":                             true,
+	"NetCDF":                               true,
+	"Newsletr":                             true,
+	"NGPL":                                 true,
+	"NIST-PD":                              true,
+	"NIST-PD-fallback":                     true,
+	"NLOD-1.0":                             true,
+	"NLPL":                                 true,
+	"Nokia":                                true,
+	"NOSL":                                 true,
+	"Noweb":                                true,
+	"NPL-1.0":                              true,
+	"NPL-1.1":                              true,
+	"NPOSL-3.0":                            true,
+	"NRL":                                  true,
+	"NTP":                                  true,
+	"NTP-0":                                true,
+	"Nunit":                                true,
+	"O-UDA-1.0":                            true,
+	"OCCT-PL":                              true,
+	"OCLC-2.0":                             true,
+	"ODbL-1.0":                             true,
+	"ODC-By-1.0":                           true,
+	"OFL-1.0":                              true,
+	"OFL-1.0-no-RFN":                       true,
+	"OFL-1.0-RFN":                          true,
+	"OFL-1.1":                              true,
+	"OFL-1.1-no-RFN":                       true,
+	"OFL-1.1-RFN":                          true,
+	"OGC-1.0":                              true,
+	"OGDL-Taiwan-1.0":                      true,
+	"OGL-Canada-2.0":                       true,
+	"OGL-UK-1.0":                           true,
+	"OGL-UK-2.0":                           true,
+	"OGL-UK-3.0":                           true,
+	"OGTSL":                                true,
+	"OLDAP-1.1":                            true,
+	"OLDAP-1.2":                            true,
+	"OLDAP-1.3":                            true,
+	"OLDAP-1.4":                            true,
+	"OLDAP-2.0":                            true,
+	"OLDAP-2.0.1":                          true,
+	"OLDAP-2.1":                            true,
+	"OLDAP-2.2":                            true,
+	"OLDAP-2.2.1":                          true,
+	"OLDAP-2.2.2":                          true,
+	"OLDAP-2.3":                            true,
+	"OLDAP-2.4":                            true,
+	"OLDAP-2.5":                            true,
+	"OLDAP-2.6":                            true,
+	"OLDAP-2.7":                            true,
+	"OLDAP-2.8":                            true,
+	"OML":                                  true,
+	"OpenSSL":                              true,
+	"OPL-1.0":                              true,
+	"OPUBL-1.0":                            true,
+	"OSET-PL-2.1":                          true,
+	"OSL-1.0":                              true,
+	"OSL-1.1":                              true,
+	"OSL-2.0":                              true,
+	"OSL-2.1":                              true,
+	"OSL-3.0":                              true,
+	"Parity-6.0.0":                         true,
+	"Parity-7.0.0":                         true,
+	"PDDL-1.0":                             true,
+	"PHP-3.0":                              true,
+	"PHP-3.01":                             true,
+	"Plexus":                               true,
+	"PolyForm-Noncommercial-1.0.0":         true,
+	"PolyForm-Small-Business-1.0.0":        true,
+	"PostgreSQL":                           true,
+	"PSF-2.0":                              true,
+	"psfrag":                               true,
+	"psutils":                              true,
+	"Python-2.0":                           true,
+	"Qhull":                                true,
+	"QPL-1.0":                              true,
+	"Rdisc":                                true,
+	"RHeCos-1.1":                           true,
+	"RPL-1.1":                              true,
+	"RPL-1.5":                              true,
+	"RPSL-1.0":                             true,
+	"RSA-MD":                               true,
+	"RSCPL":                                true,
+	"Ruby":                                 true,
+	"SAX-PD":                               true,
+	"Saxpath":                              true,
+	"SCEA":                                 true,
+	"Sendmail":                             true,
+	"Sendmail-8.23":                        true,
+	"SGI-B-1.0":                            true,
+	"SGI-B-1.1":                            true,
+	"SGI-B-2.0":                            true,
+	"SHL-0.5":                              true,
+	"SHL-0.51":                             true,
+	"SimPL-2.0":                            true,
+	"SISSL":                                true,
+	"SISSL-1.2":                            true,
+	"Sleepycat":                            true,
+	"SMLNJ":                                true,
+	"SMPPL":                                true,
+	"SNIA":                                 true,
+	"Spencer-86":                           true,
+	"Spencer-94":                           true,
+	"Spencer-99":                           true,
+	"SPL-1.0":                              true,
+	"SSH-OpenSSH":                          true,
+	"SSH-short":                            true,
+	"SSPL-1.0":                             true,
+	"StandardML-NJ":                        true,
+	"SugarCRM-1.1.3":                       true,
+	"SWL":                                  true,
+	"TAPR-OHL-1.0":                         true,
+	"TCL":                                  true,
+	"TCP-wrappers":                         true,
+	"TMate":                                true,
+	"TORQUE-1.1":                           true,
+	"TOSL":                                 true,
+	"TU-Berlin-1.0":                        true,
+	"TU-Berlin-2.0":                        true,
+	"UCL-1.0":                              true,
+	"Unicode-DFS-2015":                     true,
+	"Unicode-DFS-2016":                     true,
+	"Unicode-TOU":                          true,
+	"Unlicense":                            true,
+	"UPL-1.0":                              true,
+	"Vim":                                  true,
+	"VOSTROM":                              true,
+	"VSL-1.0":                              true,
+	"W3C":                                  true,
+	"W3C-19980720":                         true,
+	"W3C-20150513":                         true,
+	"Watcom-1.0":                           true,
+	"Wsuipa":                               true,
+	"WTFPL":                                true,
+	"wxWindows":                            true,
+	"X11":                                  true,
+	"Xerox":                                true,
+	"XFree86-1.1":                          true,
+	"xinetd":                               true,
+	"Xnet":                                 true,
+	"xpp":                                  true,
+	"XSkat":                                true,
+	"YPL-1.0":                              true,
+	"YPL-1.1":                              true,
+	"Zed":                                  true,
+	"Zend-2.0":                             true,
+	"Zimbra-1.3":                           true,
+	"Zimbra-1.4":                           true,
+	"Zlib":                                 true,
+	"zlib-acknowledgement":                 true,
+	"ZPL-1.1":                              true,
+	"ZPL-2.0":                              true,
+	"ZPL-2.1":                              true,
+}
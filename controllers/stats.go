@@ -0,0 +1,363 @@
+// Copyright (C) 2026 Toitware ApS. All rights reserved.
+// Use of this source code is governed by an MIT-style license that can be
+// found in the LICENSE file.
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/toitware/tpkg/config"
+	"github.com/uber-go/tally"
+	bolt "go.etcd.io/bbolt"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// StatsKind is the kind of a counted package access.
+type StatsKind string
+
+const (
+	// StatsView is a view of the docs or the README of a version.
+	StatsView StatsKind = "view"
+	// StatsLookup is a lookup of a single version through the API.
+	StatsLookup StatsKind = "lookup"
+	// StatsDownload is a download of the archive of a version.
+	StatsDownload StatsKind = "download"
+)
+
+const (
+	// statsDateFormat is the format of the keys of the daily buckets.
+	statsDateFormat = "2006-01-02"
+	// PopularityDays is the number of days the popularity of a package is
+	// computed over.
+	PopularityDays = 30
+)
+
+var statsBucket = []byte("stats")
+
+// statsDay are the counts of a package on a day, keyed by version and kind.
+type statsDay map[string]map[StatsKind]int64
+
+func (d statsDay) add(version string, kind StatsKind, n int64) {
+	counts, ok := d[version]
+	if !ok {
+		counts = map[StatsKind]int64{}
+		d[version] = counts
+	}
+	counts[kind] += n
+}
+
+type DailyStats struct {
+	// Date is the UTC day, formatted as YYYY-MM-DD.
+	Date   string
+	Counts map[StatsKind]int64
+}
+
+type VersionStats struct {
+	Version string
+	Counts  map[StatsKind]int64
+}
+
+type PackageStats struct {
+	// Days are the days with any access, oldest first.
+	Days []*DailyStats
+	// Versions are the totals of the versions, sorted by version string.
+	Versions []*VersionStats
+	Total    map[StatsKind]int64
+}
+
+// Stats counts the accesses of packages in daily buckets. Only the counts
+// are stored, nothing about the clients.
+type Stats interface {
+	Record(url string, version string, kind StatsKind)
+	// PackageStats returns the counts of the package over the given number of
+	// days, including today.
+	PackageStats(ctx context.Context, url string, days int) (*PackageStats, error)
+	// Popularity returns the number of accesses per package URL over the
+	// given number of days. The counts are those of the last flush, so the
+	// result stays the same between flushes.
+	Popularity(ctx context.Context, days int) (map[string]int64, error)
+}
+
+type statsKey struct {
+	url     string
+	date    string
+	version string
+	kind    StatsKind
+}
+
+type stats struct {
+	logger *zap.Logger
+	scope  tally.Scope
+	cfg    config.Stats
+	db     *bolt.DB
+	now    func() time.Time
+
+	mutex   sync.Mutex
+	pending map[statsKey]int64
+
+	// popularity caches the result of Popularity until the next flush that
+	// writes counts, so the ranking is stable between flushes.
+	popularityMutex sync.Mutex
+	popularity      *popularityCache
+}
+
+type popularityCache struct {
+	since  string
+	counts map[string]int64
+}
+
+func provideStats(cfg *config.Config, logger *zap.Logger, scope tally.Scope) (*stats, Stats, error) {
+	res, err := newStats(cfg.Stats, logger, scope)
+	if err != nil {
+		return nil, nil, err
+	}
+	return res, res, nil
+}
+
+// newStats opens the store of the statistics. Counting is disabled if the
+// path is empty.
+func newStats(cfg config.Stats, logger *zap.Logger, scope tally.Scope) (*stats, error) {
+	res := &stats{
+		logger:  logger,
+		scope:   scope.SubScope("stats"),
+		cfg:     cfg,
+		now:     time.Now,
+		pending: map[statsKey]int64{},
+	}
+	if cfg.Path == "" {
+		return res, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(cfg.Path), 0755); err != nil {
+		return nil, err
+	}
+	db, err := bolt.Open(cfg.Path, 0644, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(statsBucket)
+		return err
+	}); err != nil {
+		db.Close()
+		return nil, err
+	}
+	res.db = db
+	return res, nil
+}
+
+func initStats(lc fx.Lifecycle, s *stats) {
+	if s.db == nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	lc.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			go s.flushLoop(ctx, done)
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			cancel()
+			<-done
+			if err := s.flush(); err != nil {
+				s.logger.Error("failed to flush stats", zap.Error(err))
+			}
+			return s.db.Close()
+		},
+	})
+}
+
+func (s *stats) flushLoop(ctx context.Context, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(s.cfg.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.flush(); err != nil {
+				s.logger.Error("failed to flush stats", zap.Error(err))
+			}
+		}
+	}
+}
+
+func (s *stats) Record(url string, version string, kind StatsKind) {
+	s.scope.Tagged(map[string]string{"kind": string(kind)}).Counter("accesses").Inc(1)
+	if s.db == nil {
+		return
+	}
+	key := statsKey{
+		url:     url,
+		date:    s.now().UTC().Format(statsDateFormat),
+		version: version,
+		kind:    kind,
+	}
+	s.mutex.Lock()
+	s.pending[key]++
+	s.mutex.Unlock()
+}
+
+// flush adds the pending counts to the store.
+func (s *stats) flush() error {
+	s.mutex.Lock()
+	pending := s.pending
+	s.pending = map[statsKey]int64{}
+	s.mutex.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		days := map[[2]string]statsDay{}
+		for k, n := range pending {
+			id := [2]string{k.url, k.date}
+			day, ok := days[id]
+			if !ok {
+				b, err := tx.Bucket(statsBucket).CreateBucketIfNotExists([]byte(k.url))
+				if err != nil {
+					return err
+				}
+				day = statsDay{}
+				if v := b.Get([]byte(k.date)); v != nil {
+					if err := json.Unmarshal(v, &day); err != nil {
+						return err
+					}
+				}
+				days[id] = day
+			}
+			day.add(k.version, k.kind, n)
+		}
+		for id, day := range days {
+			v, err := json.Marshal(day)
+			if err != nil {
+				return err
+			}
+			if err := tx.Bucket(statsBucket).Bucket([]byte(id[0])).Put([]byte(id[1]), v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		s.popularityMutex.Lock()
+		s.popularity = nil
+		s.popularityMutex.Unlock()
+	}
+	if err != nil {
+		// Keep the counts for the next attempt.
+		s.mutex.Lock()
+		for k, n := range pending {
+			s.pending[k] += n
+		}
+		s.mutex.Unlock()
+	}
+	return err
+}
+
+// since returns the first date of a window of the given number of days that
+// ends today.
+func (s *stats) since(days int) string {
+	return s.now().UTC().AddDate(0, 0, 1-days).Format(statsDateFormat)
+}
+
+func (s *stats) PackageStats(ctx context.Context, url string, days int) (*PackageStats, error) {
+	if s.db == nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "statistics are disabled")
+	}
+	if days <= 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid number of days %d", days)
+	}
+	if err := s.flush(); err != nil {
+		return nil, err
+	}
+
+	res := &PackageStats{Total: map[StatsKind]int64{}}
+	versions := map[string]map[StatsKind]int64{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(statsBucket).Bucket([]byte(url))
+		if b == nil {
+			return nil
+		}
+		c := b.Cursor()
+		// The dates sort lexicographically.
+		for k, v := c.Seek([]byte(s.since(days))); k != nil; k, v = c.Next() {
+			var day statsDay
+			if err := json.Unmarshal(v, &day); err != nil {
+				return err
+			}
+			daily := &DailyStats{Date: string(k), Counts: map[StatsKind]int64{}}
+			for version, counts := range day {
+				if _, ok := versions[version]; !ok {
+					versions[version] = map[StatsKind]int64{}
+				}
+				for kind, n := range counts {
+					daily.Counts[kind] += n
+					versions[version][kind] += n
+					res.Total[kind] += n
+				}
+			}
+			res.Days = append(res.Days, daily)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for version, counts := range versions {
+		res.Versions = append(res.Versions, &VersionStats{Version: version, Counts: counts})
+	}
+	sort.Slice(res.Versions, func(i, j int) bool {
+		return res.Versions[i].Version < res.Versions[j].Version
+	})
+	return res, nil
+}
+
+func (s *stats) Popularity(ctx context.Context, days int) (map[string]int64, error) {
+	if s.db == nil {
+		return map[string]int64{}, nil
+	}
+	since := s.since(days)
+	s.popularityMutex.Lock()
+	defer s.popularityMutex.Unlock()
+	// The counts of the last flush are used. Pending counts are added by the
+	// next flush, which invalidates the cache.
+	if s.popularity != nil && s.popularity.since == since {
+		return s.popularity.counts, nil
+	}
+
+	res := map[string]int64{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(statsBucket).ForEach(func(url, _ []byte) error {
+			c := tx.Bucket(statsBucket).Bucket(url).Cursor()
+			for k, v := c.Seek([]byte(since)); k != nil; k, v = c.Next() {
+				var day statsDay
+				if err := json.Unmarshal(v, &day); err != nil {
+					return err
+				}
+				for _, counts := range day {
+					for _, n := range counts {
+						res[string(url)] += n
+					}
+				}
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.popularity = &popularityCache{since: since, counts: res}
+	return res, nil
+}
@@ -0,0 +1,88 @@
+// Copyright (C) 2026 Toitware ApS. All rights reserved.
+// Use of this source code is governed by an MIT-style license that can be
+// found in the LICENSE file.
+
+package controllers
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/toitware/tpkg/config"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func Test_stats(t *testing.T) {
+	ctx := context.Background()
+	cfg := config.Stats{Path: filepath.Join(t.TempDir(), "stats", "stats.db")}
+	s, err := newStats(cfg, zap.NewNop(), tally.NoopScope)
+	require.NoError(t, err)
+
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now.AddDate(0, 0, -40) }
+	s.Record("github.com/toitware/toit-morse", "1.0.0", StatsView)
+	s.now = func() time.Time { return now.AddDate(0, 0, -1) }
+	s.Record("github.com/toitware/toit-morse", "1.0.0", StatsView)
+	s.Record("github.com/toitware/toit-morse", "1.1.0", StatsLookup)
+	require.NoError(t, s.flush())
+	s.now = func() time.Time { return now }
+	s.Record("github.com/toitware/toit-morse", "1.1.0", StatsView)
+	s.Record("github.com/toitware/toit-morse", "1.1.0", StatsView)
+	s.Record("github.com/toitware/ubx-message", "2.1.1", StatsLookup)
+
+	// The counts survive a restart.
+	require.NoError(t, s.flush())
+	require.NoError(t, s.db.Close())
+	s, err = newStats(cfg, zap.NewNop(), tally.NoopScope)
+	require.NoError(t, err)
+	defer s.db.Close()
+	s.now = func() time.Time { return now }
+
+	stats, err := s.PackageStats(ctx, "github.com/toitware/toit-morse", 30)
+	require.NoError(t, err)
+	assert.Equal(t, map[StatsKind]int64{StatsView: 3, StatsLookup: 1}, stats.Total)
+	require.Len(t, stats.Days, 2)
+	assert.Equal(t, "2026-03-09", stats.Days[0].Date)
+	assert.Equal(t, map[StatsKind]int64{StatsView: 1, StatsLookup: 1}, stats.Days[0].Counts)
+	assert.Equal(t, "2026-03-10", stats.Days[1].Date)
+	require.Len(t, stats.Versions, 2)
+	assert.Equal(t, "1.0.0", stats.Versions[0].Version)
+	assert.Equal(t, map[StatsKind]int64{StatsView: 1}, stats.Versions[0].Counts)
+	assert.Equal(t, map[StatsKind]int64{StatsView: 2, StatsLookup: 1}, stats.Versions[1].Counts)
+
+	stats, err = s.PackageStats(ctx, "github.com/toitware/toit-morse", 1)
+	require.NoError(t, err)
+	assert.Equal(t, map[StatsKind]int64{StatsView: 2}, stats.Total)
+
+	popularity, err := s.Popularity(ctx, PopularityDays)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int64{
+		"github.com/toitware/toit-morse":  4,
+		"github.com/toitware/ubx-message": 1,
+	}, popularity)
+
+	// The popularity only changes with the next flush.
+	s.Record("github.com/toitware/ubx-message", "2.1.1", StatsLookup)
+	popularity, err = s.Popularity(ctx, PopularityDays)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), popularity["github.com/toitware/ubx-message"])
+	require.NoError(t, s.flush())
+	popularity, err = s.Popularity(ctx, PopularityDays)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), popularity["github.com/toitware/ubx-message"])
+}
+
+func Test_statsDisabled(t *testing.T) {
+	s, err := newStats(config.Stats{}, zap.NewNop(), tally.NoopScope)
+	require.NoError(t, err)
+	s.Record("github.com/toitware/toit-morse", "1.0.0", StatsView)
+	_, err = s.PackageStats(context.Background(), "github.com/toitware/toit-morse", 30)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
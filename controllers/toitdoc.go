@@ -23,6 +23,11 @@ func provideToitdoc(logger *zap.Logger, manager doc.Manager) (*toitdocCtrl, Toit
 
 type Toitdoc interface {
 	Load(ctx context.Context, desc *tpkg.Desc) (doc.Doc, error)
+	// Built returns whether the docs of the package are generated.
+	Built(desc *tpkg.Desc) bool
+	// GC removes the generated docs of all versions that aren't in keep, and
+	// returns the number of removed versions.
+	GC(keep []*tpkg.Desc) (int, error)
 }
 
 type toitdocCtrl struct {
@@ -35,3 +40,11 @@ type toitdocCtrl struct {
 func (t *toitdocCtrl) Load(ctx context.Context, desc *tpkg.Desc) (doc.Doc, error) {
 	return t.manager.Get(ctx, desc)
 }
+
+func (t *toitdocCtrl) Built(desc *tpkg.Desc) bool {
+	return t.manager.Built(desc)
+}
+
+func (t *toitdocCtrl) GC(keep []*tpkg.Desc) (int, error) {
+	return t.manager.GC(keep)
+}
@@ -5,6 +5,8 @@
 package controllers
 
 import (
+	"sort"
+
 	"github.com/toitlang/tpkg/pkg/tpkg"
 	"github.com/toitlang/tpkg/pkg/tracking"
 	"github.com/toitware/tpkg/config"
@@ -15,9 +17,31 @@ func provideTpkgRegistry(cfg *config.Config, cache tpkg.Cache) (tpkg.Registry, e
 		return nil, err
 	}
 
-	return tpkg.NewSSHGitRegistry("registry", cfg.Registry.Url, cache, cfg.Registry.SSHKeyFile, cfg.Registry.Branch)
+	r, err := newGitRegistry("registry", cfg.Registry.Url, cfg.Registry.Branch, cfg.Registry.Git, cfg.Registry.SSHKeyFile, cache)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
 }
 
-func provideManager(registry tpkg.Registry, cache tpkg.Cache, ui tpkg.UI) *tpkg.Manager {
-	return tpkg.NewManager(tpkg.Registries{registry}, cache, nil, ui, tracking.NopTrack)
+// provideManager returns the manager that resolves the dependencies of
+// packages, from the registry and its upstreams.
+func provideManager(cfg *config.Config, registry tpkg.Registry, upstreams upstreams, cache tpkg.Cache, ui tpkg.UI) *tpkg.Manager {
+	type prioritized struct {
+		registry tpkg.Registry
+		priority int
+	}
+	all := []prioritized{{registry, cfg.Registry.Priority}}
+	for _, u := range upstreams {
+		all = append(all, prioritized{u.registry, u.config.Priority})
+	}
+	// The registry stays first on ties.
+	sort.SliceStable(all, func(i, j int) bool {
+		return all[i].priority > all[j].priority
+	})
+	var registries tpkg.Registries
+	for _, p := range all {
+		registries = append(registries, p.registry)
+	}
+	return tpkg.NewManager(registries, cache, nil, ui, tracking.NopTrack)
 }
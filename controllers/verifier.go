@@ -0,0 +1,379 @@
+// Copyright (C) 2026 Toitware ApS. All rights reserved.
+// Use of this source code is governed by an MIT-style license that can be
+// found in the LICENSE file.
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"github.com/hashicorp/go-version"
+	"github.com/toitware/tpkg/config"
+	"github.com/toitware/tpkg/pkg/auth"
+	"github.com/uber-go/tally"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type IssueKind string
+
+const (
+	// IssueTagDeleted is reported when the tag of a registered version no
+	// longer exists upstream.
+	IssueTagDeleted IssueKind = "tag_deleted"
+	// IssueTagMoved is reported when the tag of a registered version points
+	// to a different commit than the recorded hash.
+	IssueTagMoved IssueKind = "tag_moved"
+)
+
+type VersionIssue struct {
+	URL          string    `json:"url"`
+	Version      string    `json:"version"`
+	Kind         IssueKind `json:"kind"`
+	RecordedHash string    `json:"recorded_hash"`
+	RemoteHash   string    `json:"remote_hash,omitempty"`
+	DetectedAt   time.Time `json:"detected_at"`
+}
+
+type VerificationReport struct {
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	// Checked is the number of verified versions. Yanked versions aren't
+	// verified.
+	Checked int             `json:"checked"`
+	Issues  []*VersionIssue `json:"issues"`
+	// Errors contains the packages that couldn't be verified, keyed by URL.
+	Errors map[string]string `json:"errors"`
+}
+
+type Verifier interface {
+	// Report returns the result of the last verification, or nil if none
+	// has finished yet.
+	Report(ctx context.Context) (*VerificationReport, error)
+	Verify(ctx context.Context) (*VerificationReport, error)
+}
+
+// tagLister returns the commit hashes of all tags of the repository at url,
+// keyed by tag name.
+type tagLister func(ctx context.Context, url string) (map[string]string, error)
+
+type verifier struct {
+	logger   *zap.Logger
+	scope    tally.Scope
+	cfg      config.Verifier
+	registry Registry
+	listTags tagLister
+	// source is the name of the registry. Upstream registries verify their
+	// own packages.
+	source string
+
+	verifyMutex sync.Mutex
+	reportMutex sync.RWMutex
+	report      *VerificationReport
+}
+
+func provideVerifier(cfg *config.Config, logger *zap.Logger, scope tally.Scope, registry Registry) (*verifier, Verifier) {
+	res := &verifier{
+		logger:   logger,
+		scope:    scope.SubScope("verifier"),
+		cfg:      cfg.Verifier,
+		registry: registry,
+		listTags: listRemoteTags,
+		source:   cfg.Registry.Name,
+	}
+	report, err := loadReport(cfg.Verifier.ReportPath)
+	if err != nil {
+		// The report is replaced by the next verification.
+		logger.Warn("failed to load the last verification report", zap.String("path", cfg.Verifier.ReportPath), zap.Error(err))
+	}
+	res.report = report
+	return res, res
+}
+
+// loadReport reads the report at path. Returns nil if there is none.
+func loadReport(path string) (*VerificationReport, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var res VerificationReport
+	if err := json.Unmarshal(data, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// saveReport replaces the report at path.
+func saveReport(path string, report *VerificationReport) error {
+	data, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func initVerifier(lc fx.Lifecycle, verifier *verifier) {
+	ctx, cancel := context.WithCancel(context.Background())
+	lc.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			go verifier.autoVerify(ctx)
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			cancel()
+			return nil
+		},
+	})
+}
+
+func (v *verifier) autoVerify(ctx context.Context) {
+	if v.cfg.Interval == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(v.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		report, err := v.Verify(ctx)
+		if err != nil {
+			v.logger.Error("failed to verify registry", zap.Error(err))
+		} else {
+			v.logger.Info("verified registry", zap.Int("checked", report.Checked), zap.Int("issues", len(report.Issues)))
+		}
+	}
+}
+
+func (v *verifier) Report(ctx context.Context) (*VerificationReport, error) {
+	v.reportMutex.RLock()
+	defer v.reportMutex.RUnlock()
+	return v.report, nil
+}
+
+func (v *verifier) Verify(ctx context.Context) (*VerificationReport, error) {
+	v.verifyMutex.Lock()
+	defer v.verifyMutex.Unlock()
+
+	packages, err := v.registry.Packages(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &VerificationReport{
+		StartedAt: time.Now(),
+		Errors:    map[string]string{},
+	}
+	v.scope.Counter("runs").Inc(1)
+
+	for _, p := range packages {
+		if p.Source != v.source {
+			continue
+		}
+		url := p.Latest().URL
+		tags, err := v.listTags(ctx, url)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			v.logger.Warn("failed to list remote tags", zap.String("url", url), zap.Error(err))
+			v.scope.Counter("remote_errors").Inc(1)
+			report.Errors[url] = err.Error()
+			continue
+		}
+		issues, checked := verifyPackage(p, tags, time.Now())
+		report.Checked += checked
+		report.Issues = append(report.Issues, issues...)
+	}
+	report.FinishedAt = time.Now()
+
+	counts := map[IssueKind]int64{IssueTagDeleted: 0, IssueTagMoved: 0}
+	for _, issue := range report.Issues {
+		counts[issue.Kind]++
+		v.logger.Warn("registered version does not match upstream",
+			zap.String("url", issue.URL),
+			zap.String("version", issue.Version),
+			zap.String("kind", string(issue.Kind)),
+			zap.String("recorded_hash", issue.RecordedHash),
+			zap.String("remote_hash", issue.RemoteHash))
+	}
+	for kind, count := range counts {
+		v.scope.Tagged(map[string]string{"kind": string(kind)}).Gauge("issues").Update(float64(count))
+	}
+	v.scope.Gauge("checked_versions").Update(float64(report.Checked))
+
+	v.reportMutex.Lock()
+	v.report = report
+	v.reportMutex.Unlock()
+	if v.cfg.ReportPath != "" {
+		if err := saveReport(v.cfg.ReportPath, report); err != nil {
+			v.logger.Error("failed to save the verification report", zap.String("path", v.cfg.ReportPath), zap.Error(err))
+		}
+	}
+
+	if v.cfg.AutoYank && len(report.Issues) > 0 {
+		if err := v.yank(ctx, report.Issues); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+// verifierIdentity is the identity of automatic yanks.
+var verifierIdentity = &auth.Identity{Name: "verifier", Admin: true}
+
+func (v *verifier) yank(ctx context.Context, issues []*VersionIssue) error {
+	ctx = auth.NewContext(ctx, verifierIdentity)
+	for _, issue := range issues {
+		reason := fmt.Sprintf("upstream %s (recorded hash %s)", strings.ReplaceAll(string(issue.Kind), "_", " "), issue.RecordedHash)
+		err := v.registry.YankPackage(ctx, issue.URL, issue.Version, reason)
+		if status.Code(err) == codes.AlreadyExists {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		v.logger.Info("yanked version", zap.String("url", issue.URL), zap.String("version", issue.Version), zap.String("reason", reason))
+		v.scope.Counter("auto_yanks").Inc(1)
+	}
+	return v.registry.Sync(ctx)
+}
+
+// verifyPackage compares the recorded hashes of the package's versions with
+// the given upstream tags. Yanked versions are ignored. Returns the issues and
+// the number of checked versions.
+func verifyPackage(p *Package, tags map[string]string, now time.Time) ([]*VersionIssue, int) {
+	var res []*VersionIssue
+	checked := 0
+	for _, d := range p.Descriptions {
+		if p.IsYanked(d.Version) {
+			continue
+		}
+		checked++
+		remoteHash, ok := tags[versionTag(d.Version)]
+		if !ok {
+			res = append(res, &VersionIssue{
+				URL:          d.URL,
+				Version:      d.Version,
+				Kind:         IssueTagDeleted,
+				RecordedHash: d.Hash,
+				DetectedAt:   now,
+			})
+		} else if d.Hash != "" && remoteHash != d.Hash {
+			res = append(res, &VersionIssue{
+				URL:          d.URL,
+				Version:      d.Version,
+				Kind:         IssueTagMoved,
+				RecordedHash: d.Hash,
+				RemoteHash:   remoteHash,
+				DetectedAt:   now,
+			})
+		}
+	}
+	return res, checked
+}
+
+// versionTag returns the git tag of the given package version.
+func versionTag(version string) string {
+	if strings.HasPrefix(version, "v") {
+		return version
+	}
+	return "v" + version
+}
+
+func packageRemoteURL(url string) string {
+	if filepath.IsAbs(url) || strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://") {
+		return url
+	}
+	return "https://" + url
+}
+
+// latestVersionTag returns the newest version tag of the package repository:
+// the highest 'v'-prefixed semantic version that isn't a pre-release.
+func latestVersionTag(ctx context.Context, url string) (string, error) {
+	tags, err := listRemoteTags(ctx, url)
+	if err != nil {
+		return "", err
+	}
+	var res string
+	var latest *version.Version
+	for tag := range tags {
+		if !strings.HasPrefix(tag, "v") {
+			continue
+		}
+		v, err := version.NewSemver(tag[1:])
+		if err != nil || v.Prerelease() != "" {
+			continue
+		}
+		if latest == nil || v.GreaterThan(latest) {
+			latest = v
+			res = tag
+		}
+	}
+	if res == "" {
+		return "", status.Errorf(codes.NotFound, "package '%s' doesn't have any version tags", url)
+	}
+	return res, nil
+}
+
+func listRemoteTags(ctx context.Context, url string) (map[string]string, error) {
+	remote := git.NewRemote(memory.NewStorage(), &gitconfig.RemoteConfig{
+		Name: "origin",
+		URLs: []string{packageRemoteURL(url)},
+	})
+	refs, err := remote.ListContext(ctx, &git.ListOptions{
+		PeelingOption: git.AppendPeeled,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res := map[string]string{}
+	peeled := map[string]string{}
+	for _, ref := range refs {
+		name := ref.Name().String()
+		if !strings.HasPrefix(name, "refs/tags/") {
+			continue
+		}
+		tag := strings.TrimPrefix(name, "refs/tags/")
+		if strings.HasSuffix(tag, "^{}") {
+			peeled[strings.TrimSuffix(tag, "^{}")] = ref.Hash().String()
+		} else if ref.Type() == plumbing.HashReference {
+			res[tag] = ref.Hash().String()
+		}
+	}
+	// Annotated tags point to tag objects. Use the commit they point to.
+	for tag, hash := range peeled {
+		res[tag] = hash
+	}
+	return res, nil
+}
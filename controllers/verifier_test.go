@@ -0,0 +1,91 @@
+// Copyright (C) 2026 Toitware ApS. All rights reserved.
+// Use of this source code is governed by an MIT-style license that can be
+// found in the LICENSE file.
+
+package controllers
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/toitlang/tpkg/pkg/tpkg"
+	"github.com/toitware/tpkg/config"
+	"github.com/uber-go/tally"
+	"go.uber.org/zap"
+)
+
+func Test_verifyPackage(t *testing.T) {
+	descs := []*tpkg.Desc{
+		{URL: "github.com/foo/bar", Version: "1.0.0", Hash: "aaaa"},
+		{URL: "github.com/foo/bar", Version: "1.1.0", Hash: "bbbb"},
+		{URL: "github.com/foo/bar", Version: "1.2.0", Hash: "cccc"},
+		{URL: "github.com/foo/bar", Version: "1.3.0", Hash: "dddd"},
+	}
+	packages, _ := buildPackageStructure(descs)
+	require.Len(t, packages, 1)
+	pkg := packages[0]
+	pkg.Yanked["1.3.0"] = "broken"
+	// Yanks of versions that aren't registered don't change the count.
+	pkg.Yanked["2.0.0"] = "broken"
+
+	tags := map[string]string{
+		"v1.0.0": "aaaa",
+		"v1.1.0": "ffff",
+	}
+	issues, checked := verifyPackage(pkg, tags, time.Now())
+	assert.Equal(t, 3, checked)
+	require.Len(t, issues, 2)
+
+	assert.Equal(t, "1.1.0", issues[0].Version)
+	assert.Equal(t, IssueTagMoved, issues[0].Kind)
+	assert.Equal(t, "bbbb", issues[0].RecordedHash)
+	assert.Equal(t, "ffff", issues[0].RemoteHash)
+
+	assert.Equal(t, "1.2.0", issues[1].Version)
+	assert.Equal(t, IssueTagDeleted, issues[1].Kind)
+}
+
+func Test_latestSkipsYanked(t *testing.T) {
+	descs := []*tpkg.Desc{
+		{URL: "github.com/foo/bar", Version: "1.0.0"},
+		{URL: "github.com/foo/bar", Version: "2.0.0"},
+	}
+	packages, _ := buildPackageStructure(descs)
+	pkg := packages[0]
+	assert.Equal(t, "2.0.0", pkg.Latest().Version)
+
+	pkg.Yanked["2.0.0"] = "broken"
+	assert.Equal(t, "1.0.0", pkg.Latest().Version)
+
+	pkg.Yanked["1.0.0"] = "broken"
+	assert.Equal(t, "2.0.0", pkg.Latest().Version)
+}
+
+func Test_verifierReport(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "verifier", "report.json")
+	cfg := &config.Config{Verifier: config.Verifier{ReportPath: path}}
+
+	v, _ := provideVerifier(cfg, zap.NewNop(), tally.NoopScope, nil)
+	report, err := v.Report(context.Background())
+	require.NoError(t, err)
+	assert.Nil(t, report)
+
+	saved := &VerificationReport{
+		StartedAt:  time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+		FinishedAt: time.Date(2026, 1, 1, 0, 1, 0, 0, time.UTC),
+		Checked:    3,
+		Issues:     []*VersionIssue{{URL: "github.com/foo/bar", Version: "1.1.0", Kind: IssueTagMoved, RecordedHash: "bbbb", RemoteHash: "ffff"}},
+		Errors:     map[string]string{"github.com/foo/baz": "not found"},
+	}
+	require.NoError(t, saveReport(path, saved))
+
+	// The last report survives a restart.
+	v, _ = provideVerifier(cfg, zap.NewNop(), tally.NoopScope, nil)
+	report, err = v.Report(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, saved, report)
+}
@@ -0,0 +1,576 @@
+// Copyright (C) 2026 Toitware ApS. All rights reserved.
+// Use of this source code is governed by an MIT-style license that can be
+// found in the LICENSE file.
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/toitlang/tpkg/pkg/tpkg"
+	"github.com/toitware/tpkg/config"
+	"github.com/uber-go/tally"
+	bolt "go.etcd.io/bbolt"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+type WebhookStatus string
+
+const (
+	WebhookPending   WebhookStatus = "pending"
+	WebhookDelivered WebhookStatus = "delivered"
+	WebhookFailed    WebhookStatus = "failed"
+)
+
+const (
+	// WebhookSignatureHeader carries the hex HMAC-SHA256 of the body, keyed
+	// with the secret of the subscription, as 'sha256=<hex>'.
+	WebhookSignatureHeader = "X-Tpkg-Signature-256"
+	WebhookEventHeader     = "X-Tpkg-Event"
+	WebhookDeliveryHeader  = "X-Tpkg-Delivery"
+
+	// webhookPollInterval is the interval at which due retries are picked up.
+	webhookPollInterval = time.Second
+)
+
+var (
+	deliveriesBucket = []byte("deliveries")
+	// stateBucket holds the package set whose changes were enqueued last.
+	stateBucket = []byte("state")
+	packagesKey = []byte("packages")
+)
+
+// defaultWebhookEvents are the events of subscriptions that don't list any.
+var defaultWebhookEvents = []ChangeKind{ChangeVersionAdded, ChangeVersionYanked}
+
+// WebhookDelivery is the delivery of an event to a subscription.
+type WebhookDelivery struct {
+	ID             uint64        `json:"id"`
+	Subscription   string        `json:"subscription"`
+	Event          *ChangeEvent  `json:"event"`
+	Status         WebhookStatus `json:"status"`
+	Attempts       int           `json:"attempts"`
+	CreatedAt      time.Time     `json:"created_at"`
+	NextAttempt    time.Time     `json:"next_attempt"`
+	LastAttempt    time.Time     `json:"last_attempt"`
+	LastStatusCode int           `json:"last_status_code,omitempty"`
+	LastError      string        `json:"last_error,omitempty"`
+}
+
+// webhookPayload is the body of the webhook requests.
+type webhookPayload struct {
+	Delivery     uint64       `json:"delivery"`
+	Subscription string       `json:"subscription"`
+	Event        *ChangeEvent `json:"event"`
+}
+
+type Webhooks interface {
+	// Deliveries returns the most recent deliveries, newest first.
+	// If subscription is not empty, only its deliveries are returned.
+	Deliveries(ctx context.Context, subscription string, limit int) ([]*WebhookDelivery, error)
+}
+
+type webhookSubscription struct {
+	config.WebhookSubscription
+	events map[ChangeKind]bool
+}
+
+func (s *webhookSubscription) matches(e *ChangeEvent) bool {
+	if !s.events[e.Kind] {
+		return false
+	}
+	if len(s.Packages) == 0 {
+		return true
+	}
+	for _, pattern := range s.Packages {
+		if ok, _ := path.Match(pattern, e.URL); ok {
+			return true
+		}
+	}
+	return false
+}
+
+type webhooks struct {
+	logger        *zap.Logger
+	scope         tally.Scope
+	cfg           config.Webhooks
+	registry      Registry
+	subscriptions []*webhookSubscription
+	client        *http.Client
+	db            *bolt.DB
+	wake          chan struct{}
+	wg            sync.WaitGroup
+}
+
+func provideWebhooks(cfg *config.Config, logger *zap.Logger, scope tally.Scope, registry Registry) (*webhooks, Webhooks, error) {
+	res, err := newWebhooks(cfg.Webhooks, logger, scope, registry)
+	if err != nil {
+		return nil, nil, err
+	}
+	return res, res, nil
+}
+
+// newWebhooks returns the webhooks of the configuration. The delivery queue
+// is only opened if there are subscriptions.
+func newWebhooks(cfg config.Webhooks, logger *zap.Logger, scope tally.Scope, registry Registry) (*webhooks, error) {
+	res := &webhooks{
+		logger:   logger,
+		scope:    scope.SubScope("webhooks"),
+		cfg:      cfg,
+		registry: registry,
+		client:   &http.Client{Timeout: cfg.Timeout},
+		wake:     make(chan struct{}, 1),
+	}
+
+	known := map[ChangeKind]bool{}
+	for _, k := range []ChangeKind{ChangePackageAdded, ChangePackageRemoved, ChangeVersionAdded, ChangeVersionRemoved, ChangeVersionYanked} {
+		known[k] = true
+	}
+	names := map[string]bool{}
+	for _, s := range cfg.Subscriptions {
+		if s.Name == "" || s.URL == "" {
+			return nil, fmt.Errorf("webhook subscriptions need a name and a url")
+		}
+		if names[s.Name] {
+			return nil, fmt.Errorf("duplicate webhook subscription '%s'", s.Name)
+		}
+		names[s.Name] = true
+
+		sub := &webhookSubscription{WebhookSubscription: s, events: map[ChangeKind]bool{}}
+		for _, e := range s.Events {
+			if !known[ChangeKind(e)] {
+				return nil, fmt.Errorf("unknown event '%s' in webhook subscription '%s'", e, s.Name)
+			}
+			sub.events[ChangeKind(e)] = true
+		}
+		if len(s.Events) == 0 {
+			for _, k := range defaultWebhookEvents {
+				sub.events[k] = true
+			}
+		}
+		for _, pattern := range s.Packages {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("invalid package pattern '%s' in webhook subscription '%s'", pattern, s.Name)
+			}
+		}
+		res.subscriptions = append(res.subscriptions, sub)
+	}
+
+	if len(res.subscriptions) == 0 {
+		return res, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(cfg.QueuePath), 0755); err != nil {
+		return nil, err
+	}
+	db, err := bolt.Open(cfg.QueuePath, 0644, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(deliveriesBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(stateBucket)
+		return err
+	}); err != nil {
+		db.Close()
+		return nil, err
+	}
+	res.db = db
+	return res, nil
+}
+
+func initWebhooks(lc fx.Lifecycle, w *webhooks) {
+	if w.db == nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	lc.Append(fx.Hook{
+		// Registered after the registry, so the packages are loaded.
+		OnStart: func(context.Context) error {
+			w.wg.Add(2)
+			go w.watch(ctx)
+			go w.deliverLoop(ctx)
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			cancel()
+			w.wg.Wait()
+			return w.db.Close()
+		},
+	})
+}
+
+// watch enqueues the registry changes until the context is done. The
+// events of the registry only trigger a reconcile, so no change is lost when
+// the watcher falls behind.
+func (w *webhooks) watch(ctx context.Context) {
+	defer w.wg.Done()
+	for ctx.Err() == nil {
+		changes := w.registry.Watch(ctx)
+		// Catch up with the changes since the last reconcile, including the
+		// ones while the server was down.
+		w.reconcileLogged(ctx)
+		for range changes {
+			// A sync publishes all its events at once.
+			drainChanges(changes)
+			w.reconcileLogged(ctx)
+		}
+		if ctx.Err() == nil {
+			w.logger.Warn("webhooks fell behind the registry changes, catching up")
+		}
+	}
+}
+
+// drainChanges discards the buffered events of the channel.
+func drainChanges(changes <-chan *ChangeEvent) {
+	for {
+		select {
+		case _, ok := <-changes:
+			if !ok {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (w *webhooks) reconcileLogged(ctx context.Context) {
+	if err := w.reconcile(ctx); err != nil {
+		w.logger.Error("failed to enqueue webhook deliveries", zap.Error(err))
+	}
+}
+
+// webhookPackage is the state of a package, as stored in the stateBucket.
+type webhookPackage struct {
+	// Versions maps the versions to their names.
+	Versions map[string]string `json:"versions"`
+	Yanked   map[string]string `json:"yanked,omitempty"`
+}
+
+// reconcile enqueues the changes from the stored package set to the current
+// packages of the registry, and stores them. Nothing is enqueued the first
+// time, when there is no stored package set yet.
+func (w *webhooks) reconcile(ctx context.Context) error {
+	packages, err := w.registry.Packages(ctx)
+	if err != nil {
+		return err
+	}
+	current := map[string]*Package{}
+	state := map[string]*webhookPackage{}
+	for _, p := range packages {
+		url := p.Descriptions[0].URL
+		current[url] = p
+		s := &webhookPackage{Versions: map[string]string{}, Yanked: p.Yanked}
+		for _, d := range p.Descriptions {
+			s.Versions[d.Version] = d.Name
+		}
+		state[url] = s
+	}
+	encoded, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	enqueued := false
+	err = w.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(stateBucket)
+		if stored := b.Get(packagesKey); stored != nil {
+			previous, err := decodeWebhookState(stored)
+			if err != nil {
+				return err
+			}
+			for _, e := range diffPackages(previous, current, time.Now()) {
+				ok, err := w.enqueueIn(tx.Bucket(deliveriesBucket), e)
+				if err != nil {
+					return err
+				}
+				enqueued = enqueued || ok
+			}
+		}
+		return b.Put(packagesKey, encoded)
+	})
+	if err == nil && enqueued {
+		w.wakeUp()
+	}
+	return err
+}
+
+// decodeWebhookState returns the packages of the stored package set.
+func decodeWebhookState(data []byte) (map[string]*Package, error) {
+	var state map[string]*webhookPackage
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	var descs []*tpkg.Desc
+	for url, s := range state {
+		for version, name := range s.Versions {
+			descs = append(descs, &tpkg.Desc{Name: name, URL: url, Version: version})
+		}
+	}
+	_, res := buildPackageStructure(descs)
+	for url, p := range res {
+		p.Yanked = state[url].Yanked
+	}
+	return res, nil
+}
+
+// enqueueIn stores the deliveries of the event in the bucket. Returns
+// whether any subscription matched.
+func (w *webhooks) enqueueIn(b *bolt.Bucket, e *ChangeEvent) (bool, error) {
+	enqueued := false
+	for _, s := range w.subscriptions {
+		if !s.matches(e) {
+			continue
+		}
+		id, err := b.NextSequence()
+		if err != nil {
+			return false, err
+		}
+		now := time.Now()
+		if err := putDelivery(b, &WebhookDelivery{
+			ID:           id,
+			Subscription: s.Name,
+			Event:        e,
+			Status:       WebhookPending,
+			CreatedAt:    now,
+			NextAttempt:  now,
+		}); err != nil {
+			return false, err
+		}
+		enqueued = true
+	}
+	return enqueued, nil
+}
+
+// wakeUp makes the delivery loop pick up new deliveries.
+func (w *webhooks) wakeUp() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (w *webhooks) deliverLoop(ctx context.Context) {
+	defer w.wg.Done()
+	ticker := time.NewTicker(webhookPollInterval)
+	defer ticker.Stop()
+	for {
+		if err := w.deliverDue(ctx, time.Now()); err != nil {
+			w.logger.Error("failed to deliver webhooks", zap.Error(err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-w.wake:
+		}
+	}
+}
+
+// deliverDue attempts all pending deliveries whose next attempt is due.
+func (w *webhooks) deliverDue(ctx context.Context, now time.Time) error {
+	var due []*WebhookDelivery
+	err := w.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(deliveriesBucket).ForEach(func(k, v []byte) error {
+			var d WebhookDelivery
+			if err := json.Unmarshal(v, &d); err != nil {
+				return err
+			}
+			if d.Status == WebhookPending && !d.NextAttempt.After(now) {
+				due = append(due, &d)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, d := range due {
+		if ctx.Err() != nil {
+			return nil
+		}
+		w.attempt(ctx, d)
+		if err := w.db.Update(func(tx *bolt.Tx) error {
+			return putDelivery(tx.Bucket(deliveriesBucket), d)
+		}); err != nil {
+			return err
+		}
+	}
+	if len(due) > 0 {
+		return w.trimHistory()
+	}
+	return nil
+}
+
+func (w *webhooks) subscription(name string) *webhookSubscription {
+	for _, s := range w.subscriptions {
+		if s.Name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// attempt sends the delivery and updates its state.
+func (w *webhooks) attempt(ctx context.Context, d *WebhookDelivery) {
+	sub := w.subscription(d.Subscription)
+	if sub == nil {
+		// The subscription was removed from the configuration.
+		d.Status = WebhookFailed
+		d.LastError = "unknown subscription"
+		w.scope.Tagged(map[string]string{"outcome": "failed"}).Counter("deliveries").Inc(1)
+		return
+	}
+
+	d.Attempts++
+	d.LastAttempt = time.Now()
+	statusCode, err := w.post(ctx, sub, d)
+	d.LastStatusCode = statusCode
+	if err == nil {
+		d.Status = WebhookDelivered
+		d.LastError = ""
+		d.NextAttempt = time.Time{}
+		w.scope.Tagged(map[string]string{"outcome": "delivered"}).Counter("deliveries").Inc(1)
+		return
+	}
+
+	d.LastError = err.Error()
+	if d.Attempts >= w.cfg.MaxAttempts {
+		d.Status = WebhookFailed
+		d.NextAttempt = time.Time{}
+		w.scope.Tagged(map[string]string{"outcome": "failed"}).Counter("deliveries").Inc(1)
+		w.logger.Warn("webhook delivery failed", zap.Uint64("delivery", d.ID), zap.String("subscription", d.Subscription), zap.Error(err))
+		return
+	}
+	d.NextAttempt = d.LastAttempt.Add(w.backoff(d.Attempts))
+	w.scope.Tagged(map[string]string{"outcome": "retry"}).Counter("deliveries").Inc(1)
+}
+
+// backoff returns the delay after the given number of failed attempts.
+func (w *webhooks) backoff(attempts int) time.Duration {
+	res := w.cfg.InitialBackoff
+	for i := 1; i < attempts; i++ {
+		res *= 2
+		if w.cfg.MaxBackoff > 0 && res >= w.cfg.MaxBackoff {
+			return w.cfg.MaxBackoff
+		}
+	}
+	return res
+}
+
+func (w *webhooks) post(ctx context.Context, sub *webhookSubscription, d *WebhookDelivery) (int, error) {
+	body, err := json.Marshal(&webhookPayload{
+		Delivery:     d.ID,
+		Subscription: d.Subscription,
+		Event:        d.Event,
+	})
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookEventHeader, string(d.Event.Kind))
+	req.Header.Set(WebhookDeliveryHeader, strconv.FormatUint(d.ID, 10))
+	if sub.Secret != "" {
+		req.Header.Set(WebhookSignatureHeader, "sha256="+webhookSignature(sub.Secret, body))
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("unexpected status '%s'", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// webhookSignature returns the hex HMAC-SHA256 of the body.
+func webhookSignature(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// trimHistory removes the oldest finished deliveries beyond the history size.
+func (w *webhooks) trimHistory() error {
+	return w.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(deliveriesBucket)
+		var finished [][]byte
+		err := b.ForEach(func(k, v []byte) error {
+			var d WebhookDelivery
+			if err := json.Unmarshal(v, &d); err != nil {
+				return err
+			}
+			if d.Status != WebhookPending {
+				finished = append(finished, append([]byte{}, k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for i := 0; i < len(finished)-w.cfg.HistorySize; i++ {
+			if err := b.Delete(finished[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (w *webhooks) Deliveries(ctx context.Context, subscription string, limit int) ([]*WebhookDelivery, error) {
+	if w.db == nil {
+		return nil, nil
+	}
+	var res []*WebhookDelivery
+	err := w.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(deliveriesBucket).Cursor()
+		for k, v := c.Last(); k != nil && (limit <= 0 || len(res) < limit); k, v = c.Prev() {
+			var d WebhookDelivery
+			if err := json.Unmarshal(v, &d); err != nil {
+				return err
+			}
+			if subscription == "" || d.Subscription == subscription {
+				res = append(res, &d)
+			}
+		}
+		return nil
+	})
+	return res, err
+}
+
+func putDelivery(b *bolt.Bucket, d *WebhookDelivery) error {
+	value, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, d.ID)
+	return b.Put(key, value)
+}
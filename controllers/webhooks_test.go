@@ -0,0 +1,223 @@
+// Copyright (C) 2026 Toitware ApS. All rights reserved.
+// Use of this source code is governed by an MIT-style license that can be
+// found in the LICENSE file.
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/toitlang/tpkg/pkg/tpkg"
+	"github.com/toitware/tpkg/config"
+	"github.com/uber-go/tally"
+	bolt "go.etcd.io/bbolt"
+	"go.uber.org/zap"
+)
+
+// enqueue stores the deliveries of the event, like a reconcile that finds it.
+func enqueue(t *testing.T, w *webhooks, e *ChangeEvent) {
+	err := w.db.Update(func(tx *bolt.Tx) error {
+		_, err := w.enqueueIn(tx.Bucket(deliveriesBucket), e)
+		return err
+	})
+	require.NoError(t, err)
+}
+
+func Test_webhooks(t *testing.T) {
+	ctx := context.Background()
+	var requests []*http.Request
+	var bodies [][]byte
+	failing := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		requests = append(requests, r)
+		bodies = append(bodies, body)
+		if failing {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	cfg := config.Webhooks{
+		QueuePath:      filepath.Join(t.TempDir(), "webhooks", "queue.db"),
+		MaxAttempts:    3,
+		InitialBackoff: time.Minute,
+		MaxBackoff:     90 * time.Second,
+		HistorySize:    10,
+		Subscriptions: []config.WebhookSubscription{
+			{Name: "ci", URL: server.URL, Secret: "secret", Packages: []string{"github.com/toitware/*"}},
+			{Name: "removals", URL: server.URL, Events: []string{"package_removed"}},
+		},
+	}
+	w, err := newWebhooks(cfg, zap.NewNop(), tally.NoopScope, nil)
+	require.NoError(t, err)
+
+	enqueue(t, w, &ChangeEvent{Kind: ChangeVersionAdded, URL: "github.com/toitware/toit-morse", Version: "1.1.0"})
+	enqueue(t, w, &ChangeEvent{Kind: ChangeVersionAdded, URL: "github.com/someone/morse", Version: "1.0.0"})
+	enqueue(t, w, &ChangeEvent{Kind: ChangeVersionRemoved, URL: "github.com/toitware/toit-morse", Version: "1.0.0"})
+
+	// Pending deliveries survive a restart.
+	require.NoError(t, w.db.Close())
+	w, err = newWebhooks(cfg, zap.NewNop(), tally.NoopScope, nil)
+	require.NoError(t, err)
+	defer w.db.Close()
+
+	now := time.Now()
+	require.NoError(t, w.deliverDue(ctx, now))
+	require.Len(t, requests, 1)
+	deliveries, err := w.Deliveries(ctx, "", 0)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	d := deliveries[0]
+	assert.Equal(t, WebhookPending, d.Status)
+	assert.Equal(t, 1, d.Attempts)
+	assert.Equal(t, http.StatusServiceUnavailable, d.LastStatusCode)
+	assert.Equal(t, d.LastAttempt.Add(time.Minute), d.NextAttempt)
+
+	// Retries wait for the backoff.
+	require.NoError(t, w.deliverDue(ctx, now.Add(30*time.Second)))
+	require.Len(t, requests, 1)
+
+	failing = false
+	require.NoError(t, w.deliverDue(ctx, now.Add(2*time.Minute)))
+	require.Len(t, requests, 2)
+	deliveries, err = w.Deliveries(ctx, "ci", 10)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, WebhookDelivered, deliveries[0].Status)
+	assert.Equal(t, 2, deliveries[0].Attempts)
+	assert.Empty(t, deliveries[0].LastError)
+
+	r := requests[1]
+	assert.Equal(t, "version_added", r.Header.Get(WebhookEventHeader))
+	assert.Equal(t, "1", r.Header.Get(WebhookDeliveryHeader))
+	assert.Equal(t, "sha256="+webhookSignature("secret", bodies[1]), r.Header.Get(WebhookSignatureHeader))
+	var payload webhookPayload
+	require.NoError(t, json.Unmarshal(bodies[1], &payload))
+	assert.Equal(t, "ci", payload.Subscription)
+	assert.Equal(t, "github.com/toitware/toit-morse", payload.Event.URL)
+	assert.Equal(t, "1.1.0", payload.Event.Version)
+}
+
+func Test_webhooksBackoff(t *testing.T) {
+	w := &webhooks{cfg: config.Webhooks{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second}}
+	assert.Equal(t, time.Second, w.backoff(1))
+	assert.Equal(t, 2*time.Second, w.backoff(2))
+	assert.Equal(t, 4*time.Second, w.backoff(3))
+	assert.Equal(t, 5*time.Second, w.backoff(4))
+	assert.Equal(t, 5*time.Second, w.backoff(20))
+}
+
+func Test_webhooksGiveUp(t *testing.T) {
+	ctx := context.Background()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	w, err := newWebhooks(config.Webhooks{
+		QueuePath:   filepath.Join(t.TempDir(), "queue.db"),
+		MaxAttempts: 2,
+		HistorySize: 1,
+		Subscriptions: []config.WebhookSubscription{
+			{Name: "ci", URL: server.URL},
+		},
+	}, zap.NewNop(), tally.NoopScope, nil)
+	require.NoError(t, err)
+	defer w.db.Close()
+
+	enqueue(t, w, &ChangeEvent{Kind: ChangeVersionYanked, URL: "github.com/toitware/toit-morse", Version: "1.0.0"})
+	enqueue(t, w, &ChangeEvent{Kind: ChangeVersionYanked, URL: "github.com/toitware/toit-morse", Version: "1.0.1"})
+	for i := 0; i < 3; i++ {
+		require.NoError(t, w.deliverDue(ctx, time.Now()))
+	}
+
+	// Only the most recent finished delivery is kept.
+	deliveries, err := w.Deliveries(ctx, "", 0)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, uint64(2), deliveries[0].ID)
+	assert.Equal(t, WebhookFailed, deliveries[0].Status)
+	assert.Equal(t, 2, deliveries[0].Attempts)
+	assert.Equal(t, "unexpected status '500 Internal Server Error'", deliveries[0].LastError)
+}
+
+// packagesRegistry is a registry that only serves its packages.
+type packagesRegistry struct {
+	Registry
+	descs  []*tpkg.Desc
+	yanked map[string]string
+}
+
+func (r *packagesRegistry) Packages(ctx context.Context) ([]*Package, error) {
+	packages, _ := buildPackageStructure(r.descs)
+	for _, p := range packages {
+		p.Yanked = r.yanked
+	}
+	return packages, nil
+}
+
+func Test_webhooksReconcile(t *testing.T) {
+	ctx := context.Background()
+	morse := func(version string) *tpkg.Desc {
+		return &tpkg.Desc{Name: "morse", URL: "github.com/toitware/toit-morse", Version: version}
+	}
+	registry := &packagesRegistry{descs: []*tpkg.Desc{morse("1.0.0")}}
+	cfg := config.Webhooks{
+		QueuePath:   filepath.Join(t.TempDir(), "queue.db"),
+		MaxAttempts: 1,
+		HistorySize: 10,
+		Subscriptions: []config.WebhookSubscription{
+			{Name: "ci", URL: "http://127.0.0.1:0"},
+		},
+	}
+	w, err := newWebhooks(cfg, zap.NewNop(), tally.NoopScope, registry)
+	require.NoError(t, err)
+
+	// The existing packages aren't delivered.
+	require.NoError(t, w.reconcile(ctx))
+	deliveries, err := w.Deliveries(ctx, "", 0)
+	require.NoError(t, err)
+	assert.Empty(t, deliveries)
+
+	registry.descs = append(registry.descs, morse("1.1.0"))
+	require.NoError(t, w.reconcile(ctx))
+	// Reconciling again doesn't enqueue the change twice.
+	require.NoError(t, w.reconcile(ctx))
+	deliveries, err = w.Deliveries(ctx, "", 0)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, ChangeVersionAdded, deliveries[0].Event.Kind)
+	assert.Equal(t, "1.1.0", deliveries[0].Event.Version)
+
+	// Changes while the server is down are enqueued after the restart.
+	require.NoError(t, w.db.Close())
+	registry.yanked = map[string]string{"1.0.0": "broken"}
+	w, err = newWebhooks(cfg, zap.NewNop(), tally.NoopScope, registry)
+	require.NoError(t, err)
+	defer w.db.Close()
+	require.NoError(t, w.reconcile(ctx))
+	deliveries, err = w.Deliveries(ctx, "", 0)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 2)
+	assert.Equal(t, ChangeVersionYanked, deliveries[0].Event.Kind)
+	assert.Equal(t, "broken", deliveries[0].Event.Reason)
+}
+
+func Test_webhooksInvalidConfig(t *testing.T) {
+	_, err := newWebhooks(config.Webhooks{
+		Subscriptions: []config.WebhookSubscription{
+			{Name: "ci", URL: "http://localhost", Events: []string{"released"}},
+		},
+	}, zap.NewNop(), tally.NoopScope, nil)
+	assert.Error(t, err)
+}
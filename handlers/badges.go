@@ -0,0 +1,123 @@
+// Copyright (C) 2026 Toitware ApS. All rights reserved.
+// Use of this source code is governed by an MIT-style license that can be
+// found in the LICENSE file.
+
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"html"
+	"net/http"
+	"strconv"
+	"text/template"
+
+	"github.com/gorilla/mux"
+	"github.com/toitware/tpkg/controllers"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	badgeColorBlue  = "#007ec6"
+	badgeColorGreen = "#4c1"
+	badgeColorGrey  = "#9f9f9f"
+)
+
+// badge is a label and a value, rendered like the common shields.
+type badge struct {
+	Label string
+	Value string
+	Color string
+}
+
+var badgeTemplate = template.Must(template.New("badge").Funcs(template.FuncMap{
+	"escape": html.EscapeString,
+}).Parse(`<svg xmlns="http://www.w3.org/2000/svg" width="{{.Width}}" height="20" role="img" aria-label="{{escape .Label}}: {{escape .Value}}">
+<title>{{escape .Label}}: {{escape .Value}}</title>
+<linearGradient id="s" x2="0" y2="100%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>
+<clipPath id="r"><rect width="{{.Width}}" height="20" rx="3" fill="#fff"/></clipPath>
+<g clip-path="url(#r)"><rect width="{{.LabelWidth}}" height="20" fill="#555"/><rect x="{{.LabelWidth}}" width="{{.ValueWidth}}" height="20" fill="{{.Color}}"/><rect width="{{.Width}}" height="20" fill="url(#s)"/></g>
+<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">
+<text x="{{.LabelX}}" y="15" fill="#010101" fill-opacity=".3">{{escape .Label}}</text><text x="{{.LabelX}}" y="14">{{escape .Label}}</text>
+<text x="{{.ValueX}}" y="15" fill="#010101" fill-opacity=".3">{{escape .Value}}</text><text x="{{.ValueX}}" y="14">{{escape .Value}}</text>
+</g>
+</svg>
+`))
+
+// textWidth approximates the width of the text in 11px Verdana.
+func textWidth(s string) int {
+	return len([]rune(s))*7 + 10
+}
+
+func (b *badge) render() ([]byte, error) {
+	labelWidth := textWidth(b.Label)
+	valueWidth := textWidth(b.Value)
+	var buf bytes.Buffer
+	err := badgeTemplate.Execute(&buf, struct {
+		*badge
+		Width      int
+		LabelWidth int
+		ValueWidth int
+		LabelX     float64
+		ValueX     float64
+	}{
+		badge:      b,
+		Width:      labelWidth + valueWidth,
+		LabelWidth: labelWidth,
+		ValueWidth: valueWidth,
+		LabelX:     float64(labelWidth) / 2,
+		ValueX:     float64(labelWidth) + float64(valueWidth)/2,
+	})
+	return buf.Bytes(), err
+}
+
+// packageBadge returns the badge of the given kind for the package.
+func (h *httpHandlers) packageBadge(kind string, pkg *controllers.Package) *badge {
+	latest := pkg.Latest()
+	switch kind {
+	case "license":
+		if latest.License == "" {
+			return &badge{Label: "license", Value: "unknown", Color: badgeColorGrey}
+		}
+		return &badge{Label: "license", Value: latest.License, Color: badgeColorBlue}
+	case "docs":
+		if h.toitdoc.Built(latest) {
+			return &badge{Label: "docs", Value: "built", Color: badgeColorGreen}
+		}
+		return &badge{Label: "docs", Value: "not built", Color: badgeColorGrey}
+	case "dependents":
+		return &badge{Label: "dependents", Value: strconv.Itoa(pkg.Dependents), Color: badgeColorBlue}
+	default:
+		return &badge{Label: "pkg", Value: "v" + latest.Version, Color: badgeColorBlue}
+	}
+}
+
+// badge serves an SVG badge of the package. The kind defaults to the latest
+// version.
+func (h *httpHandlers) badge(rw http.ResponseWriter, r *http.Request) error {
+	vars := mux.Vars(r)
+	b := &badge{Label: "pkg", Value: "not found", Color: badgeColorGrey}
+	pkg, err := h.registry.Package(r.Context(), vars["package"])
+	if err == nil {
+		b = h.packageBadge(vars["kind"], pkg)
+	} else if status.Code(err) != codes.NotFound {
+		return err
+	}
+
+	body, err := b.render()
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	rw.Header().Set("Content-Type", "image/svg+xml; charset=utf-8")
+	rw.Header().Set("ETag", etag)
+	if etagMatches(r, etag) {
+		rw.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+	_, err = rw.Write(body)
+	return err
+}
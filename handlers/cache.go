@@ -0,0 +1,120 @@
+// Copyright (C) 2026 Toitware ApS. All rights reserved.
+// Use of this source code is governed by an MIT-style license that can be
+// found in the LICENSE file.
+
+package handlers
+
+import (
+	"net/http"
+	"strings"
+)
+
+// etagMatches returns true if the If-None-Match header of the request
+// contains the ETag.
+func etagMatches(r *http.Request, etag string) bool {
+	header := r.Header.Get("If-None-Match")
+	if header == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// registryDependent returns whether the response to the API request only
+// depends on the synced registry, and can be identified by its generation.
+// Statistics, docs build states, admin data and streams change independently.
+// READMEs and matches are counted in the statistics, so they must always
+// reach the handler.
+func registryDependent(r *http.Request) bool {
+	path := strings.TrimPrefix(r.URL.Path, "/api")
+	if !strings.HasPrefix(path, "/v1/packages") {
+		return false
+	}
+	for _, suffix := range []string{"/stats", "/readme", "/match"} {
+		if strings.HasSuffix(path, suffix) {
+			return false
+		}
+	}
+	// The single version endpoint reports whether the docs are built.
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	if len(segments) >= 2 && segments[len(segments)-2] == "versions" {
+		return false
+	}
+	query := r.URL.Query()
+	return query.Get("sort") != "POPULARITY" && query.Get("has_docs") == ""
+}
+
+// cached sets the Cache-Control header of the successful responses. If etag
+// returns true for the request, the generation of the registry is used as
+// ETag, and the handler isn't called if the client has the current
+// generation. Errors are never cached.
+func (h *httpHandlers) cached(cacheControl string, etag func(*http.Request) bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			next.ServeHTTP(rw, r)
+			return
+		}
+		w := &cachingWriter{ResponseWriter: rw, cacheControl: cacheControl}
+		if etag != nil && etag(r) {
+			if generation := h.registry.Generation(r.Context()); generation != "" {
+				w.etag = `"` + generation + `"`
+				if etagMatches(r, w.etag) {
+					w.WriteHeader(http.StatusNotModified)
+					return
+				}
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// cachingWriter adds the caching headers to the response, if its status is
+// 2xx or 304.
+type cachingWriter struct {
+	http.ResponseWriter
+	cacheControl string
+	etag         string
+	wroteHeader  bool
+}
+
+func (w *cachingWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		if (code >= 200 && code < 300) || code == http.StatusNotModified {
+			if w.cacheControl != "" {
+				w.Header().Set("Cache-Control", w.cacheControl)
+			}
+			if w.etag != "" {
+				w.Header().Set("ETag", w.etag)
+			}
+		}
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *cachingWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush supports streaming responses through the writer.
+func (w *cachingWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// always uses the generation as ETag for all requests.
+func always(*http.Request) bool {
+	return true
+}
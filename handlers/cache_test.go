@@ -0,0 +1,29 @@
+// Copyright (C) 2026 Toitware ApS. All rights reserved.
+// Use of this source code is governed by an MIT-style license that can be
+// found in the LICENSE file.
+
+package handlers
+
+import (
+	"net/http/httptest"
+
+	"github.com/jstroem/tedi"
+	"github.com/stretchr/testify/assert"
+)
+
+func test_registryDependent(t *tedi.T) {
+	for path, expected := range map[string]bool{
+		"/api/v1/packages": true,
+		"/api/v1/packages?sort=DEPENDENTS&page_size=10":         true,
+		"/api/v1/packages?sort=POPULARITY":                      false,
+		"/api/v1/packages?has_docs=true":                        false,
+		"/api/v1/packages/github.com/a/b/versions":              true,
+		"/api/v1/packages/github.com/a/b/versions/latest":       false,
+		"/api/v1/packages/github.com/a/b/match?constraint=":     false,
+		"/api/v1/packages/github.com/a/b/versions/1.0.0/readme": false,
+		"/api/v1/packages/github.com/a/b/stats":                 false,
+		"/api/v1/admin/audit":                                   false,
+	} {
+		assert.Equal(t, expected, registryDependent(httptest.NewRequest("GET", path, nil)), path)
+	}
+}
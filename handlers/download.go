@@ -0,0 +1,60 @@
+// Copyright (C) 2026 Toitware ApS. All rights reserved.
+// Use of this source code is governed by an MIT-style license that can be
+// found in the LICENSE file.
+
+package handlers
+
+import (
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/toitlang/tpkg/pkg/tpkg"
+	"github.com/toitware/tpkg/controllers"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// archiveURL returns the URL of the tar.gz archive of the commit of the
+// version, or "" if the host of the package is unknown.
+func archiveURL(desc *tpkg.Desc) string {
+	parts := strings.SplitN(desc.URL, "/", 2)
+	if len(parts) != 2 || desc.Hash == "" {
+		return ""
+	}
+	switch strings.ToLower(parts[0]) {
+	case "github.com":
+		return "https://" + desc.URL + "/archive/" + desc.Hash + ".tar.gz"
+	case "gitlab.com":
+		name := path.Base(parts[1])
+		return "https://" + desc.URL + "/-/archive/" + desc.Hash + "/" + name + "-" + desc.Hash + ".tar.gz"
+	default:
+		return ""
+	}
+}
+
+// download counts a download of the version and redirects to the archive of
+// its commit at the host of the package.
+func (h *httpHandlers) download(rw http.ResponseWriter, r *http.Request) error {
+	vars := mux.Vars(r)
+	pkg, err := h.registry.Package(r.Context(), vars["package"])
+	if err != nil {
+		return err
+	}
+	version := vars["version"]
+	desc, ok := pkg.Lookup[version]
+	if !ok {
+		return status.Errorf(codes.NotFound, "package '%s' did not have a version '%s'", vars["package"], version)
+	}
+	url := archiveURL(desc)
+	if url == "" {
+		return status.Errorf(codes.NotFound, "no archive of package '%s' is available", desc.URL)
+	}
+
+	h.stats.Record(desc.URL, desc.Version, controllers.StatsDownload)
+	// Redirects aren't cached, so every download is counted.
+	rw.Header().Set("Cache-Control", "no-store")
+	http.Redirect(rw, r, url, http.StatusFound)
+	return nil
+}
@@ -0,0 +1,125 @@
+// Copyright (C) 2026 Toitware ApS. All rights reserved.
+// Use of this source code is governed by an MIT-style license that can be
+// found in the LICENSE file.
+
+package handlers
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gorilla/feeds"
+	"github.com/gorilla/mux"
+	"github.com/toitlang/tpkg/pkg/tpkg"
+	"github.com/toitware/tpkg/config"
+	"github.com/toitware/tpkg/controllers"
+)
+
+// feedSize is the maximum number of entries of a feed.
+const feedSize = 50
+
+type feedEntry struct {
+	desc    *tpkg.Desc
+	release *controllers.Release
+	yanked  bool
+}
+
+// releaseEntries returns the versions of the packages with a known release
+// time, newest first.
+func releaseEntries(packages ...*controllers.Package) []*feedEntry {
+	var res []*feedEntry
+	for _, p := range packages {
+		for _, d := range p.Descriptions {
+			if release, ok := p.Releases[d.Version]; ok {
+				res = append(res, &feedEntry{
+					desc:    d,
+					release: release,
+					yanked:  p.IsYanked(d.Version),
+				})
+			}
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].release.Time.After(res[j].release.Time)
+	})
+	if len(res) > feedSize {
+		res = res[:feedSize]
+	}
+	return res
+}
+
+// publicURL returns the configured public URL of the registry, without a
+// trailing slash. Defaults to the local port if it isn't configured.
+// The Host header of the requests isn't used, as the responses are cached.
+func publicURL(cfg *config.Config) string {
+	if cfg.PublicURL != "" {
+		return strings.TrimSuffix(cfg.PublicURL, "/")
+	}
+	scheme := "http"
+	if cfg.HTTPS {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://localhost:%d", scheme, cfg.Port)
+}
+
+func (h *httpHandlers) writeFeed(rw http.ResponseWriter, r *http.Request, title string, link string, entries []*feedEntry) error {
+	base := h.publicURL
+	feed := &feeds.Feed{
+		Title:   title,
+		Link:    &feeds.Link{Href: base + link},
+		Id:      base + r.URL.Path,
+		Updated: time.Now(),
+	}
+	if len(entries) > 0 {
+		feed.Updated = entries[0].release.Time
+	}
+
+	for _, e := range entries {
+		title := fmt.Sprintf("%s %s", e.desc.Name, e.desc.Version)
+		if e.yanked {
+			title += " (yanked)"
+		}
+		docs := fmt.Sprintf("%s/%s@%s/docs/", base, e.desc.URL, e.desc.Version)
+		content := fmt.Sprintf("<p>%s</p><p>Package: %s<br>Version: %s<br>License: %s</p>",
+			html.EscapeString(e.desc.Description),
+			html.EscapeString(e.desc.URL),
+			html.EscapeString(e.desc.Version),
+			html.EscapeString(e.desc.License))
+		feed.Add(&feeds.Item{
+			Title:       title,
+			Link:        &feeds.Link{Href: docs},
+			Id:          docs,
+			Description: e.desc.Description,
+			Content:     content,
+			Updated:     e.release.Time,
+			Created:     e.release.Time,
+		})
+	}
+
+	rw.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	return feed.WriteAtom(rw)
+}
+
+// feed serves the most recent releases of all packages.
+func (h *httpHandlers) feed(rw http.ResponseWriter, r *http.Request) error {
+	packages, err := h.registry.Packages(r.Context())
+	if err != nil {
+		return err
+	}
+	return h.writeFeed(rw, r, "Toit package releases", "/", releaseEntries(packages...))
+}
+
+// packageFeed serves the most recent releases of a single package.
+func (h *httpHandlers) packageFeed(rw http.ResponseWriter, r *http.Request) error {
+	url := mux.Vars(r)["package"]
+	pkg, err := h.registry.Package(r.Context(), url)
+	if err != nil {
+		return err
+	}
+	title := fmt.Sprintf("%s releases", pkg.Latest().Name)
+	return h.writeFeed(rw, r, title, "/"+url, releaseEntries(pkg))
+}
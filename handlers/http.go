@@ -6,10 +6,14 @@ package handlers
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
@@ -49,25 +53,74 @@ type httpHandlers struct {
 	logger      *zap.Logger
 	registry    controllers.Registry
 	toitdoc     controllers.Toitdoc
+	stats       controllers.Stats
 	toitdocCfg  config.Toitdocs
+	cacheCfg    config.HTTPCache
 	webFilePath string
+	publicURL   string
+
+	corsMutex   sync.Mutex
+	corsOrigins []string
 }
 
-func provideHTTPHandlers(logger *zap.Logger, cfg *config.Config, registry controllers.Registry, toitdoc controllers.Toitdoc) *httpHandlers {
+func provideHTTPHandlers(logger *zap.Logger, cfg *config.Config, registry controllers.Registry, toitdoc controllers.Toitdoc, stats controllers.Stats) *httpHandlers {
 	return &httpHandlers{
 		logger:      logger,
 		registry:    registry,
 		toitdoc:     toitdoc,
+		stats:       stats,
 		toitdocCfg:  cfg.Toitdocs,
+		cacheCfg:    cfg.HTTPCache,
 		webFilePath: cfg.WebPath,
+		publicURL:   publicURL(cfg),
+		corsOrigins: cfg.CORS.AllowedOrigins,
+	}
+}
+
+// watchCORS applies changes of the allowed origins without a restart.
+func watchCORS(watcher *config.Watcher, h *httpHandlers) {
+	watcher.Subscribe(func(change *config.Change) {
+		if change.Changed("cors") {
+			h.corsMutex.Lock()
+			h.corsOrigins = change.New.CORS.AllowedOrigins
+			h.corsMutex.Unlock()
+		}
+	})
+}
+
+// allowedOrigin returns whether browsers may call the API from the origin.
+func (h *httpHandlers) allowedOrigin(origin string) bool {
+	h.corsMutex.Lock()
+	defer h.corsMutex.Unlock()
+	if len(h.corsOrigins) == 0 {
+		return true
 	}
+	for _, o := range h.corsOrigins {
+		if o == "*" || strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+	return false
 }
 
 func bindHTTPHandlers(router *mux.Router, cfg *config.Config, logger *zap.Logger, h *httpHandlers, apiHandler *runtime.ServeMux) {
 	router.NotFoundHandler = network.HTTPHandle(h.web)
-	router.Handle("/{package:[^@]+}/docs/{path:.*}", network.HTTPHandle(h.toitdocs))
-	router.Handle("/{package:[^@]+}@{version:[^/]+}/docs/{path:.*}", network.HTTPHandle(h.toitdocs))
-	router.PathPrefix("/api/").Handler(http.StripPrefix("/api", apiHandler))
+	cache := h.cacheCfg
+	router.Handle("/feed.atom", h.cached(cache.Feeds, always, network.HTTPHandle(h.feed)))
+	router.Handle("/sitemap.xml", h.cached(cache.Sitemap, always, network.HTTPHandle(h.sitemap)))
+	// Package URLs start with a host, so they can't be confused with a kind.
+	// Badges and docs don't use the generation as ETag, as the docs state
+	// isn't part of the registry generation.
+	router.Handle("/badge/{kind:version|license|docs|dependents}/{package:.+}.svg", h.cached(cache.Badges, nil, network.HTTPHandle(h.badge)))
+	router.Handle("/badge/{package:.+}.svg", h.cached(cache.Badges, nil, network.HTTPHandle(h.badge)))
+	router.Handle("/{package:[^@]+}/feed.atom", h.cached(cache.Feeds, always, network.HTTPHandle(h.packageFeed)))
+	router.Handle("/{package:[^@]+}/docs/{path:.*}", h.cached(cache.Docs, nil, network.HTTPHandle(h.toitdocs)))
+	router.Handle("/{package:[^@]+}@{version:[^/]+}/docs/{path:.*}", h.cached(cache.VersionedDocs, nil, network.HTTPHandle(h.toitdocs)))
+	router.Handle("/{package:[^@]+}@{version:[^/]+}/archive.tar.gz", network.HTTPHandle(h.download))
+	// Server-sent events can't go through the gRPC gateway, which buffers
+	// and compresses responses.
+	router.Path("/api/v1/events").Methods(http.MethodGet).HandlerFunc(h.events)
+	router.PathPrefix("/api/").Handler(h.cached(cache.API, registryDependent, http.StripPrefix("/api", apiHandler)))
 	router.Path("/health").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 	})
@@ -76,7 +129,7 @@ func bindHTTPHandlers(router *mux.Router, cfg *config.Config, logger *zap.Logger
 		handlers.CORS(
 			handlers.AllowedHeaders([]string{"Accept", "Content-Type", "Content-Length", "Accept-Encoding", "Authorization"}),
 			handlers.AllowedMethods([]string{"GET", "POST", "DELETE", "HEAD", "OPTIONS"}),
-			handlers.AllowedOriginValidator(func(host string) bool { return true }),
+			handlers.AllowedOriginValidator(h.allowedOrigin),
 			handlers.AllowCredentials(),
 		),
 	}
@@ -142,6 +195,11 @@ func (h *httpHandlers) toitdocs(rw http.ResponseWriter, r *http.Request) error {
 		return status.Errorf(codes.Internal, "failed to load package '%s@%s", desc.URL, desc.Version)
 	}
 
+	// The viewer loads its assets separately. Only count the page itself.
+	if path == "" || path == "index.html" {
+		h.stats.Record(desc.URL, desc.Version, controllers.StatsView)
+	}
+
 	srv := &toitdocFileServer{
 		doc:        doc,
 		viewerPath: h.toitdocCfg.ViewerPath,
@@ -149,8 +207,62 @@ func (h *httpHandlers) toitdocs(rw http.ResponseWriter, r *http.Request) error {
 	return srv.serve(rw, r, path)
 }
 
+// sseKeepAliveInterval is the interval of the comments that keep idle
+// event streams open through proxies.
+const sseKeepAliveInterval = 30 * time.Second
+
+// events streams the registry changes as server-sent events. The optional
+// 'url' query parameter restricts the events to a single package.
+func (h *httpHandlers) events(rw http.ResponseWriter, r *http.Request) {
+	flusher, ok := rw.(http.Flusher)
+	if !ok {
+		http.Error(rw, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	url := r.URL.Query().Get("url")
+
+	ctx := r.Context()
+	events := h.registry.Watch(ctx)
+
+	rw.Header().Set("Content-Type", "text/event-stream")
+	rw.Header().Set("Cache-Control", "no-cache")
+	rw.Header().Set("Connection", "keep-alive")
+	rw.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(sseKeepAliveInterval)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				return
+			}
+			if url != "" && e.URL != url {
+				continue
+			}
+			data, err := json.Marshal(e)
+			if err != nil {
+				h.logger.Error("failed to encode change event", zap.Error(err))
+				continue
+			}
+			if _, err := fmt.Fprintf(rw, "event: %s\ndata: %s\n\n", e.Kind, data); err != nil {
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(rw, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
 func (h *httpHandlers) web(rw http.ResponseWriter, r *http.Request) error {
 	p := strings.Trim(r.URL.Path, "/")
+	if served, err := h.packagePage(rw, r, p); served || err != nil {
+		return err
+	}
 
 	if p == "" {
 		p = "index.html"
@@ -6,13 +6,19 @@ package handlers
 
 import (
 	"context"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/gavv/httpexpect"
 	"github.com/golang/mock/gomock"
 	"github.com/gorilla/mux"
 	"github.com/jstroem/tedi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/toitlang/tpkg/pkg/tpkg"
 	"github.com/toitware/tpkg/config"
 	"github.com/toitware/tpkg/controllers"
@@ -32,8 +38,18 @@ func fix_ToitdocCtrl(ctrl *gomock.Controller) *controllers.MockToitdoc {
 	return controllers.NewMockToitdoc(ctrl)
 }
 
+// testGeneration is the generation of the registry in the tests.
+const testGeneration = "0123456789abcdef"
+
 func fix_RegistryCtrl(ctrl *gomock.Controller) *controllers.MockRegistry {
-	return controllers.NewMockRegistry(ctrl)
+	res := controllers.NewMockRegistry(ctrl)
+	// Most routes use the generation as ETag.
+	res.EXPECT().Generation(gomock.Any()).Return(testGeneration).AnyTimes()
+	return res
+}
+
+func fix_StatsCtrl(ctrl *gomock.Controller) *controllers.MockStats {
+	return controllers.NewMockStats(ctrl)
 }
 
 func fix_Logger() *zap.Logger {
@@ -46,12 +62,22 @@ func fix_Context(t *tedi.T) context.Context {
 	return ctx
 }
 
+const testPublicURL = "https://pkg.example.com"
+
 func fix_Config() *config.Config {
-	return &config.Config{}
+	return &config.Config{
+		PublicURL: testPublicURL + "/",
+		HTTPCache: config.HTTPCache{
+			Docs:          "public, max-age=300",
+			VersionedDocs: "public, max-age=31536000, immutable",
+			Feeds:         "public, max-age=300",
+			Badges:        "public, max-age=300",
+		},
+	}
 }
 
-func fix_HTTPHandlers(logger *zap.Logger, cfg *config.Config, registry *controllers.MockRegistry, toitdoc *controllers.MockToitdoc) *httpHandlers {
-	return provideHTTPHandlers(logger, cfg, registry, toitdoc)
+func fix_HTTPHandlers(logger *zap.Logger, cfg *config.Config, registry *controllers.MockRegistry, toitdoc *controllers.MockToitdoc, stats *controllers.MockStats) *httpHandlers {
+	return provideHTTPHandlers(logger, cfg, registry, toitdoc, stats)
 }
 
 func fix_HTTPServer(t *tedi.T, cfg *config.Config, logger *zap.Logger, handlers *httpHandlers) *httptest.Server {
@@ -68,6 +94,7 @@ type httpHandlerTestInput struct {
 	Handlers *httpHandlers
 	Registry *controllers.MockRegistry
 	Toitdoc  *controllers.MockToitdoc
+	Stats    *controllers.MockStats
 	Ctx      context.Context
 	Server   *httptest.Server
 }
@@ -105,4 +132,272 @@ func test_HTTPHandlers_Toitdoc(t *tedi.T) {
 		e := httpexpect.New(t, i.Server.URL)
 		e.GET("/foo/bar/baz/docs/").Expect().Status(http.StatusInternalServerError)
 	})
+
+	t.Run("counts views of the docs page", func(t *tedi.T, i httpHandlerTestInput) {
+		desc := &tpkg.Desc{
+			URL:     "foo/bar/baz",
+			Version: "v1.2.3",
+		}
+		pkg := &controllers.Package{
+			Lookup: map[string]*tpkg.Desc{
+				desc.Version: desc,
+			},
+			Descriptions: []*tpkg.Desc{desc},
+		}
+		dir := t.TempDir()
+		index := filepath.Join(dir, "viewer_index.html")
+		require.NoError(t, ioutil.WriteFile(index, []byte("<html></html>"), 0644))
+		i.Registry.EXPECT().Package(gomock.Any(), "foo/bar/baz").Return(pkg, nil).Times(2)
+		i.Toitdoc.EXPECT().Load(gomock.Any(), desc).Return(&testDoc{dir: dir}, nil).Times(2)
+		i.Stats.EXPECT().Record("foo/bar/baz", "v1.2.3", controllers.StatsView)
+
+		e := httpexpect.New(t, i.Server.URL)
+		e.GET("/foo/bar/baz@v1.2.3/docs/").Expect().Status(http.StatusOK)
+		e.GET("/foo/bar/baz@v1.2.3/docs/toitdoc.json").Expect().Status(http.StatusNotFound)
+	})
+}
+
+type testDoc struct {
+	dir string
+}
+
+func (d *testDoc) JSONPath() string {
+	return filepath.Join(d.dir, "toitdoc.json")
+}
+
+func (d *testDoc) ViewerIndexPath() string {
+	return filepath.Join(d.dir, "viewer_index.html")
+}
+
+func test_HTTPHandlers_Events(t *tedi.T) {
+	t.Run("streams change events of the package", func(t *tedi.T, i httpHandlerTestInput) {
+		events := make(chan *controllers.ChangeEvent, 2)
+		events <- &controllers.ChangeEvent{Kind: controllers.ChangeVersionAdded, URL: "foo/bar/qux", Version: "1.0.0"}
+		events <- &controllers.ChangeEvent{Kind: controllers.ChangeVersionAdded, URL: "foo/bar/baz", Version: "1.2.3"}
+		close(events)
+		i.Registry.EXPECT().Watch(gomock.Any()).Return((<-chan *controllers.ChangeEvent)(events))
+
+		e := httpexpect.New(t, i.Server.URL)
+		res := e.GET("/api/v1/events").WithQuery("url", "foo/bar/baz").Expect()
+		res.Status(http.StatusOK)
+		res.Header("Content-Type").Equal("text/event-stream")
+		body := res.Body()
+		body.Contains("event: version_added\ndata: {")
+		body.Contains(`"version":"1.2.3"`)
+		body.NotContains("foo/bar/qux")
+	})
+}
+
+func test_HTTPHandlers_Feeds(t *tedi.T) {
+	release := func(day int) *controllers.Release {
+		return &controllers.Release{Time: time.Date(2026, 1, day, 0, 0, 0, 0, time.UTC), Commit: "abc"}
+	}
+	morse := &controllers.Package{
+		Descriptions: []*tpkg.Desc{
+			{Name: "morse", URL: "foo/bar/morse", Version: "1.0.0", License: "MIT", Description: "Morse <code>"},
+			{Name: "morse", URL: "foo/bar/morse", Version: "1.1.0", License: "MIT"},
+		},
+		Releases: map[string]*controllers.Release{"1.0.0": release(1), "1.1.0": release(3)},
+	}
+	ubx := &controllers.Package{
+		Descriptions: []*tpkg.Desc{{Name: "ubx", URL: "foo/bar/ubx", Version: "2.0.0"}},
+		Releases:     map[string]*controllers.Release{"2.0.0": release(2)},
+	}
+
+	t.Run("lists the releases of all packages", func(t *tedi.T, i httpHandlerTestInput) {
+		i.Registry.EXPECT().Packages(gomock.Any()).Return([]*controllers.Package{morse, ubx}, nil)
+
+		e := httpexpect.New(t, i.Server.URL)
+		res := e.GET("/feed.atom").Expect()
+		res.Status(http.StatusOK)
+		res.Header("Content-Type").Equal("application/atom+xml; charset=utf-8")
+		body := res.Body().Raw()
+		first := strings.Index(body, "morse 1.1.0")
+		second := strings.Index(body, "ubx 2.0.0")
+		third := strings.Index(body, "morse 1.0.0")
+		assert.True(t, first >= 0 && first < second && second < third, body)
+		assert.Contains(t, body, "/foo/bar/morse@1.1.0/docs/")
+		assert.Contains(t, body, "Morse &amp;lt;code&amp;gt;")
+	})
+
+	t.Run("lists the releases of a package", func(t *tedi.T, i httpHandlerTestInput) {
+		i.Registry.EXPECT().Package(gomock.Any(), "foo/bar/ubx").Return(ubx, nil)
+
+		e := httpexpect.New(t, i.Server.URL)
+		body := e.GET("/foo/bar/ubx/feed.atom").Expect().Status(http.StatusOK).Body()
+		body.Contains("<title>ubx releases</title>")
+		body.Contains("ubx 2.0.0")
+		body.NotContains("morse")
+	})
+
+	t.Run("returns not found for unknown packages", func(t *tedi.T, i httpHandlerTestInput) {
+		i.Registry.EXPECT().Package(gomock.Any(), "foo/bar/baz").Return(nil, status.Errorf(codes.NotFound, "not found"))
+
+		e := httpexpect.New(t, i.Server.URL)
+		e.GET("/foo/bar/baz/feed.atom").Expect().Status(http.StatusNotFound)
+	})
+}
+
+func test_HTTPHandlers_Badges(t *tedi.T) {
+	latest := &tpkg.Desc{Name: "morse", URL: "foo/bar/morse", Version: "1.1.0", License: "MIT"}
+	morse := &controllers.Package{
+		Descriptions: []*tpkg.Desc{
+			{Name: "morse", URL: "foo/bar/morse", Version: "1.0.0"},
+			latest,
+		},
+		Dependents: 3,
+	}
+
+	t.Run("renders the latest version", func(t *tedi.T, i httpHandlerTestInput) {
+		i.Registry.EXPECT().Package(gomock.Any(), "foo/bar/morse").Return(morse, nil).Times(2)
+
+		e := httpexpect.New(t, i.Server.URL)
+		res := e.GET("/badge/foo/bar/morse.svg").Expect()
+		res.Status(http.StatusOK)
+		res.Header("Content-Type").Equal("image/svg+xml; charset=utf-8")
+		res.Header("Cache-Control").Equal("public, max-age=300")
+		res.Body().Contains("<svg").Contains("v1.1.0")
+
+		etag := res.Header("ETag").NotEmpty().Raw()
+		e.GET("/badge/foo/bar/morse.svg").WithHeader("If-None-Match", etag).
+			Expect().Status(http.StatusNotModified)
+	})
+
+	t.Run("renders the variants", func(t *tedi.T, i httpHandlerTestInput) {
+		i.Registry.EXPECT().Package(gomock.Any(), "foo/bar/morse").Return(morse, nil).Times(3)
+		i.Toitdoc.EXPECT().Built(latest).Return(true)
+
+		e := httpexpect.New(t, i.Server.URL)
+		e.GET("/badge/license/foo/bar/morse.svg").Expect().Body().Contains("license: MIT")
+		e.GET("/badge/docs/foo/bar/morse.svg").Expect().Body().Contains("docs: built")
+		e.GET("/badge/dependents/foo/bar/morse.svg").Expect().Body().Contains("dependents: 3")
+	})
+
+	t.Run("renders unknown packages", func(t *tedi.T, i httpHandlerTestInput) {
+		i.Registry.EXPECT().Package(gomock.Any(), "foo/bar/unknown").Return(nil, status.Errorf(codes.NotFound, "not found"))
+
+		e := httpexpect.New(t, i.Server.URL)
+		e.GET("/badge/foo/bar/unknown.svg").Expect().Status(http.StatusOK).Body().Contains("not found")
+	})
+}
+
+func test_HTTPHandlers_SEO(t *tedi.T) {
+	desc := &tpkg.Desc{Name: "morse", URL: "foo/bar/morse", Version: "1.1.0", Description: "Morse & code"}
+	morse := &controllers.Package{
+		Lookup: map[string]*tpkg.Desc{"1.0.0": {Name: "morse", URL: "foo/bar/morse", Version: "1.0.0"}, "1.1.0": desc},
+		Descriptions: []*tpkg.Desc{
+			{Name: "morse", URL: "foo/bar/morse", Version: "1.0.0"},
+			desc,
+		},
+		Yanked:   map[string]string{"1.0.0": "broken"},
+		Releases: map[string]*controllers.Release{"1.1.0": {Time: time.Date(2026, 1, 3, 0, 0, 0, 0, time.UTC)}},
+	}
+
+	t.Run("lists the pages in the sitemap", func(t *tedi.T, i httpHandlerTestInput) {
+		i.Registry.EXPECT().Packages(gomock.Any()).Return([]*controllers.Package{morse}, nil)
+
+		e := httpexpect.New(t, i.Server.URL)
+		res := e.GET("/sitemap.xml").Expect()
+		res.Status(http.StatusOK)
+		res.Header("Content-Type").Equal("application/xml; charset=utf-8")
+		body := res.Body()
+		body.Contains("<loc>" + testPublicURL + "/foo/bar/morse</loc><lastmod>2026-01-03</lastmod>")
+		body.Contains("<loc>" + testPublicURL + "/foo/bar/morse@1.1.0/docs/</loc>")
+		body.NotContains("morse@1.0.0")
+	})
+
+	t.Run("injects the metadata of package pages", func(t *tedi.T, i httpHandlerTestInput) {
+		dir := t.TempDir()
+		index := "<html><head><title>Toit</title></head><body></body></html>"
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "index.html"), []byte(index), 0644))
+		i.Handlers.webFilePath = dir
+		i.Registry.EXPECT().Package(gomock.Any(), "foo/bar/morse").Return(morse, nil).Times(2)
+		i.Registry.EXPECT().Package(gomock.Any(), "foo/bar/unknown").Return(nil, status.Errorf(codes.NotFound, "not found"))
+
+		e := httpexpect.New(t, i.Server.URL)
+		// The Host header of the request is ignored.
+		body := e.GET("/foo/bar/morse").WithHeader("Host", "evil.example.com").Expect().Status(http.StatusOK).Body()
+		body.Contains("<title>morse | Toit package registry</title>")
+		body.Contains(`<meta name="description" content="Morse &amp; code">`)
+		body.Contains(`<link rel="canonical" href="` + testPublicURL + `/foo/bar/morse">`)
+		body.NotContains("<title>Toit</title>")
+
+		body = e.GET("/foo/bar/morse@1.0.0").Expect().Status(http.StatusOK).Body()
+		body.Contains(`<meta property="og:url" content="` + testPublicURL + `/foo/bar/morse@1.0.0">`)
+
+		e.GET("/foo/bar/unknown").Expect().Status(http.StatusOK).Body().Equal(index)
+	})
+}
+
+func test_HTTPHandlers_Caching(t *tedi.T) {
+	t.Run("returns not modified for the current generation", func(t *tedi.T, i httpHandlerTestInput) {
+		i.Registry.EXPECT().Packages(gomock.Any()).Return(nil, nil)
+
+		e := httpexpect.New(t, i.Server.URL)
+		res := e.GET("/feed.atom").Expect()
+		res.Status(http.StatusOK)
+		res.Header("ETag").Equal(`"` + testGeneration + `"`)
+		res.Header("Cache-Control").Equal("public, max-age=300")
+
+		e.GET("/feed.atom").WithHeader("If-None-Match", `"old", "`+testGeneration+`"`).
+			Expect().Status(http.StatusNotModified)
+	})
+
+	t.Run("doesn't cache errors", func(t *tedi.T, i httpHandlerTestInput) {
+		i.Registry.EXPECT().Package(gomock.Any(), "foo/bar/baz").Return(nil, status.Errorf(codes.NotFound, "not found")).Times(2)
+
+		e := httpexpect.New(t, i.Server.URL)
+		// The docs state isn't part of the generation.
+		res := e.GET("/foo/bar/baz@1.0.0/docs/").WithHeader("If-None-Match", `"`+testGeneration+`"`).Expect()
+		res.Status(http.StatusNotFound)
+		res.Headers().NotContainsKey("Cache-Control")
+		res.Headers().NotContainsKey("Etag")
+
+		res = e.GET("/foo/bar/baz/docs/").Expect()
+		res.Status(http.StatusNotFound)
+		res.Headers().NotContainsKey("Cache-Control")
+	})
+}
+
+func test_HTTPHandlers_Download(t *tedi.T) {
+	desc := &tpkg.Desc{Name: "morse", URL: "github.com/toitware/toit-morse", Version: "1.0.2", Hash: "abc123"}
+	pkg := &controllers.Package{
+		Lookup:       map[string]*tpkg.Desc{desc.Version: desc},
+		Descriptions: []*tpkg.Desc{desc},
+	}
+	noRedirects := func(t *tedi.T, url string) *httpexpect.Expect {
+		return httpexpect.WithConfig(httpexpect.Config{
+			BaseURL:  url,
+			Reporter: httpexpect.NewAssertReporter(t),
+			Client: &http.Client{
+				CheckRedirect: func(*http.Request, []*http.Request) error {
+					return http.ErrUseLastResponse
+				},
+			},
+		})
+	}
+
+	t.Run("counts the download and redirects to the archive", func(t *tedi.T, i httpHandlerTestInput) {
+		i.Registry.EXPECT().Package(gomock.Any(), "github.com/toitware/toit-morse").Return(pkg, nil)
+		i.Stats.EXPECT().Record("github.com/toitware/toit-morse", "1.0.2", controllers.StatsDownload)
+
+		e := noRedirects(t, i.Server.URL)
+		res := e.GET("/github.com/toitware/toit-morse@1.0.2/archive.tar.gz").Expect()
+		res.Status(http.StatusFound)
+		res.Header("Location").Equal("https://github.com/toitware/toit-morse/archive/abc123.tar.gz")
+	})
+
+	t.Run("doesn't count unknown versions", func(t *tedi.T, i httpHandlerTestInput) {
+		i.Registry.EXPECT().Package(gomock.Any(), "github.com/toitware/toit-morse").Return(pkg, nil)
+
+		e := noRedirects(t, i.Server.URL)
+		e.GET("/github.com/toitware/toit-morse@2.0.0/archive.tar.gz").Expect().Status(http.StatusNotFound)
+	})
+}
+
+func test_archiveURL(t *tedi.T) {
+	assert.Equal(t, "https://gitlab.com/group/sub/morse/-/archive/abc/morse-abc.tar.gz",
+		archiveURL(&tpkg.Desc{URL: "gitlab.com/group/sub/morse", Hash: "abc"}))
+	assert.Empty(t, archiveURL(&tpkg.Desc{URL: "example.com/morse", Hash: "abc"}))
+	assert.Empty(t, archiveURL(&tpkg.Desc{URL: "github.com/toitware/toit-morse"}))
 }
@@ -6,16 +6,23 @@ package handlers
 
 import "go.uber.org/fx"
 
+// TpkgModule provides the tpkg cache and UI, which the controllers need even
+// without the servers.
+var TpkgModule = fx.Provide(
+	provideCache,
+	provideLoggerUI,
+)
+
 var Module = fx.Options(
+	TpkgModule,
 	fx.Provide(
-		provideCache,
 		provideRegistryService,
-		provideLoggerUI,
 		provideHTTPHandlers,
 	),
 	fx.Invoke(
 		bindRegistryService,
 		bindHTTPHandlers,
+		watchCORS,
 		proxyHTTPToGRPC,
 	),
 )
@@ -5,6 +5,7 @@
 package handlers
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 
@@ -12,24 +13,37 @@ import (
 	"github.com/toitware/tpkg/build/proto/registry"
 	"github.com/toitware/tpkg/config"
 	"github.com/toitware/tpkg/controllers"
+	"github.com/toitware/tpkg/pkg/auth"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 type registryService struct {
 	registry.UnimplementedRegistryServiceServer
 	logger   *zap.Logger
 	registry controllers.Registry
+	verifier controllers.Verifier
+	audit    controllers.AuditLog
+	webhooks controllers.Webhooks
+	readme   controllers.Readme
+	stats    controllers.Stats
 }
 
 var _ registry.RegistryServiceServer = (*registryService)(nil)
 
-func provideRegistryService(logger *zap.Logger, registry controllers.Registry) *registryService {
+func provideRegistryService(logger *zap.Logger, registry controllers.Registry, verifier controllers.Verifier, audit controllers.AuditLog, webhooks controllers.Webhooks, readme controllers.Readme, stats controllers.Stats) *registryService {
 	return &registryService{
 		logger:   logger,
 		registry: registry,
+		readme:   readme,
+		stats:    stats,
+		verifier: verifier,
+		audit:    audit,
+		webhooks: webhooks,
 	}
 }
 
@@ -37,24 +51,49 @@ func bindRegistryService(service *registryService, s *grpc.Server) {
 	registry.RegisterRegistryServiceServer(s, service)
 }
 
-func (s *registryService) ListPackages(req *registry.ListPackagesRequest, stream registry.RegistryService_ListPackagesServer) error {
-	packages, err := s.registry.Packages(stream.Context())
+func (s *registryService) ListPackages(ctx context.Context, req *registry.ListPackagesRequest) (*registry.ListPackagesResponse, error) {
+	packages, next, err := s.registry.QueryPackages(ctx, &controllers.PackageQuery{
+		Sort:      controllers.PackageSort(req.Sort),
+		License:   req.License,
+		Host:      req.Host,
+		URLPrefix: req.UrlPrefix,
+		HasDocs:   req.HasDocs,
+		Registry:  req.Registry,
+		PageSize:  int(req.PageSize),
+		PageToken: req.PageToken,
+	})
 	if err != nil {
-		return err
+		return nil, err
+	}
+	res := &registry.ListPackagesResponse{
+		NextPageToken: next,
 	}
 	for _, p := range packages {
-		d := p.Latest()
-		stream.Send(&registry.ListPackagesResponse{
-			Package: &registry.Package{
-				Name:          d.Name,
-				Url:           d.URL,
-				License:       d.License,
-				Description:   d.Description,
-				LatestVersion: d.Version,
-			},
-		})
+		res.Packages = append(res.Packages, toPackage(p))
 	}
-	return nil
+	return res, nil
+}
+
+func toPackage(p *controllers.Package) *registry.Package {
+	d := p.Latest()
+	res := &registry.Package{
+		Name:          d.Name,
+		Url:           d.URL,
+		License:       d.License,
+		Description:   d.Description,
+		LatestVersion: d.Version,
+		Dependents:    int32(p.Dependents),
+		Registry:      p.Source,
+	}
+	if updatedAt := p.UpdatedAt(); !updatedAt.IsZero() {
+		res.UpdatedAt = timestamppb.New(updatedAt)
+	}
+	if release, ok := p.Releases[d.Version]; ok {
+		res.PublishedAt = timestamppb.New(release.Time)
+		res.Commit = release.Commit
+		res.Committer = release.Committer
+	}
+	return res
 }
 
 func (s *registryService) Sync(ctx context.Context, req *registry.SyncRequest) (*registry.SyncResponse, error) {
@@ -64,34 +103,238 @@ func (s *registryService) Sync(ctx context.Context, req *registry.SyncRequest) (
 	return &registry.SyncResponse{}, nil
 }
 
+func (s *registryService) Watch(req *registry.WatchRequest, stream registry.RegistryService_WatchServer) error {
+	ctx := stream.Context()
+	for e := range s.registry.Watch(ctx) {
+		if req.Url != "" && e.URL != req.Url {
+			continue
+		}
+		if err := stream.Send(&registry.WatchResponse{Event: toChangeEvent(e)}); err != nil {
+			return err
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return status.Errorf(codes.ResourceExhausted, "the watcher fell behind")
+}
+
+var changeKinds = map[controllers.ChangeKind]registry.ChangeEvent_Kind{
+	controllers.ChangePackageAdded:   registry.ChangeEvent_PACKAGE_ADDED,
+	controllers.ChangePackageRemoved: registry.ChangeEvent_PACKAGE_REMOVED,
+	controllers.ChangeVersionAdded:   registry.ChangeEvent_VERSION_ADDED,
+	controllers.ChangeVersionRemoved: registry.ChangeEvent_VERSION_REMOVED,
+	controllers.ChangeVersionYanked:  registry.ChangeEvent_VERSION_YANKED,
+}
+
+func toChangeEvent(e *controllers.ChangeEvent) *registry.ChangeEvent {
+	return &registry.ChangeEvent{
+		Kind:    changeKinds[e.Kind],
+		Url:     e.URL,
+		Name:    e.Name,
+		Version: e.Version,
+		Reason:  e.Reason,
+		Time:    timestamppb.New(e.Time),
+	}
+}
+
 func (s *registryService) GetPackageVersions(req *registry.GetPackageVersionsRequest, stream registry.RegistryService_GetPackageVersionsServer) error {
 	versions, err := s.registry.Package(stream.Context(), req.Url)
 	if err != nil {
 		return err
 	}
 	for _, v := range versions.Descriptions {
-		dependencies := make([]*registry.Dependency, len(v.Deps))
-		for i, d := range v.Deps {
-			dependencies[i] = &registry.Dependency{
-				Url:     d.URL,
-				Version: d.Version,
-			}
-		}
-
 		stream.Send(&registry.GetPackageVersionsResponse{
-			Version: &registry.PackageVersion{
-				Name:         v.Name,
-				Version:      v.Version,
-				Description:  v.Description,
-				Url:          v.URL,
-				License:      v.License,
-				Dependencies: dependencies,
-			},
+			Version: toRegistryVersion(versions, v),
 		})
 	}
 	return nil
 }
 
+// toRegistryVersion converts the version of the package, including its
+// registry state.
+func toRegistryVersion(pkg *controllers.Package, desc *tpkg.Desc) *registry.PackageVersion {
+	version := toPackageVersion(desc)
+	setRelease(version, pkg.Releases[desc.Version])
+	version.Yanked = pkg.IsYanked(desc.Version)
+	version.YankReason = pkg.Yanked[desc.Version]
+	version.Registry = pkg.Source
+	return version
+}
+
+// setRelease fills in the registration of the version, if known.
+func setRelease(version *registry.PackageVersion, release *controllers.Release) {
+	if release == nil {
+		return
+	}
+	version.PublishedAt = timestamppb.New(release.Time)
+	version.Commit = release.Commit
+	version.Committer = release.Committer
+}
+
+func toPackageVersion(desc *tpkg.Desc) *registry.PackageVersion {
+	dependencies := make([]*registry.Dependency, len(desc.Deps))
+	for i, d := range desc.Deps {
+		dependencies[i] = &registry.Dependency{
+			Url:     d.URL,
+			Version: d.Version,
+		}
+	}
+
+	return &registry.PackageVersion{
+		Name:         desc.Name,
+		Version:      desc.Version,
+		Description:  desc.Description,
+		Url:          desc.URL,
+		License:      desc.License,
+		Dependencies: dependencies,
+		Hash:         desc.Hash,
+		Sdk:          desc.Environment.SDK,
+	}
+}
+
+func (s *registryService) GetPackageVersion(ctx context.Context, req *registry.GetPackageVersionRequest) (*registry.GetPackageVersionResponse, error) {
+	if req.Version == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "missing version")
+	}
+	info, err := s.registry.Version(ctx, req.Url, req.Version)
+	if err != nil {
+		return nil, err
+	}
+	s.stats.Record(info.Desc.URL, info.Desc.Version, controllers.StatsLookup)
+	return &registry.GetPackageVersionResponse{
+		Version:         toRegistryVersion(info.Package, info.Desc),
+		DescriptionYaml: string(info.Raw),
+		DocsBuilt:       info.DocsBuilt,
+		Dependents:      int32(info.Package.Dependents),
+	}, nil
+}
+
+func (s *registryService) MatchVersions(ctx context.Context, req *registry.MatchVersionsRequest) (*registry.MatchVersionsResponse, error) {
+	if req.Constraint == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "missing constraint")
+	}
+	match, err := s.registry.Match(ctx, req.Url, req.Constraint)
+	if err != nil {
+		return nil, err
+	}
+	res := &registry.MatchVersionsResponse{}
+	for _, d := range match.Versions {
+		res.Versions = append(res.Versions, toRegistryVersion(match.Package, d))
+	}
+	if match.Best != nil {
+		res.Best = toRegistryVersion(match.Package, match.Best)
+		s.stats.Record(match.Best.URL, match.Best.Version, controllers.StatsLookup)
+	}
+	return res, nil
+}
+
+func (s *registryService) GetPackageReadme(ctx context.Context, req *registry.GetPackageReadmeRequest) (*registry.GetPackageReadmeResponse, error) {
+	if req.Version == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "missing version")
+	}
+	info, err := s.registry.Version(ctx, req.Url, req.Version)
+	if err != nil {
+		return nil, err
+	}
+	readme, err := s.readme.Load(ctx, info.Desc)
+	if status.Code(err) == codes.ResourceExhausted {
+		return nil, err
+	} else if err != nil {
+		s.logger.Error("failed to load readme", zap.Error(err), zap.String("package", req.Url), zap.String("version", info.Desc.Version))
+		return nil, status.Errorf(codes.Internal, "failed to load the readme of '%s@%s'", req.Url, info.Desc.Version)
+	}
+	s.stats.Record(info.Desc.URL, info.Desc.Version, controllers.StatsView)
+	return &registry.GetPackageReadmeResponse{
+		Readme:        string(readme.Readme),
+		ReadmeHtml:    string(readme.ReadmeHTML),
+		Changelog:     string(readme.Changelog),
+		ChangelogHtml: string(readme.ChangelogHTML),
+	}, nil
+}
+
+// defaultStatsDays is the number of days of the statistics if the request
+// doesn't specify it.
+const defaultStatsDays = 30
+
+func (s *registryService) GetPackageStats(ctx context.Context, req *registry.GetPackageStatsRequest) (*registry.GetPackageStatsResponse, error) {
+	if _, err := s.registry.Package(ctx, req.Url); err != nil {
+		return nil, err
+	}
+	days := int(req.Days)
+	if days == 0 {
+		days = defaultStatsDays
+	}
+	stats, err := s.stats.PackageStats(ctx, req.Url, days)
+	if err != nil {
+		return nil, err
+	}
+	res := &registry.GetPackageStatsResponse{
+		Total: toAccessCounts(stats.Total),
+	}
+	for _, d := range stats.Days {
+		res.Days = append(res.Days, &registry.GetPackageStatsResponse_Day{
+			Date:   d.Date,
+			Counts: toAccessCounts(d.Counts),
+		})
+	}
+	for _, v := range stats.Versions {
+		res.Versions = append(res.Versions, &registry.GetPackageStatsResponse_Version{
+			Version: v.Version,
+			Counts:  toAccessCounts(v.Counts),
+		})
+	}
+	return res, nil
+}
+
+func toAccessCounts(counts map[controllers.StatsKind]int64) *registry.AccessCounts {
+	return &registry.AccessCounts{
+		Views:     counts[controllers.StatsView],
+		Lookups:   counts[controllers.StatsLookup],
+		Downloads: counts[controllers.StatsDownload],
+	}
+}
+
+func (s *registryService) GetPackageVersionSignature(ctx context.Context, req *registry.GetPackageVersionSignatureRequest) (*registry.GetPackageVersionSignatureResponse, error) {
+	signature, err := s.registry.Signature(ctx, req.Url, req.Version)
+	if err != nil {
+		return nil, err
+	}
+	return &registry.GetPackageVersionSignatureResponse{
+		Description: string(signature.Description),
+		Signature:   string(signature.Signature),
+		Namespace:   signature.Namespace,
+	}, nil
+}
+
+func (s *registryService) GetSigningKey(ctx context.Context, req *registry.GetSigningKeyRequest) (*registry.GetSigningKeyResponse, error) {
+	key, err := s.registry.SigningKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &registry.GetSigningKeyResponse{PublicKey: key}, nil
+}
+
+func (s *registryService) ListRegistries(ctx context.Context, req *registry.ListRegistriesRequest) (*registry.ListRegistriesResponse, error) {
+	sources, err := s.registry.Sources(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res := &registry.ListRegistriesResponse{}
+	for _, source := range sources {
+		res.Registries = append(res.Registries, &registry.Registry{
+			Name:     source.Name,
+			Url:      source.URL,
+			Branch:   source.Branch,
+			Priority: int32(source.Priority),
+			Primary:  source.Primary,
+			Packages: int32(source.Packages),
+			Error:    source.Error,
+		})
+	}
+	return res, nil
+}
+
 func (s *registryService) Register(ctx context.Context, req *registry.RegisterRequest) (*registry.RegisterResponse, error) {
 	url := req.Url
 	version := req.Version
@@ -99,11 +342,291 @@ func (s *registryService) Register(ctx context.Context, req *registry.RegisterRe
 		return nil, status.Errorf(codes.Unimplemented, "Unimplemented for multiple versions")
 	}
 
-	if err := s.registry.RegisterPackage(ctx, url, version); err != nil {
+	desc, err := s.registry.RegisterPackage(ctx, url, version, req.DryRun)
+	if err != nil {
 		return nil, err
 	}
 
-	return &registry.RegisterResponse{}, nil
+	return &registry.RegisterResponse{
+		Version: toPackageVersion(desc),
+	}, nil
+}
+
+func (s *registryService) Yank(ctx context.Context, req *registry.YankRequest) (*registry.YankResponse, error) {
+	if req.Version == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "missing version")
+	}
+
+	if err := s.registry.YankPackage(ctx, req.Url, req.Version, req.Reason); err != nil {
+		return nil, err
+	}
+
+	return &registry.YankResponse{}, nil
+}
+
+func (s *registryService) Verify(ctx context.Context, req *registry.VerifyRequest) (*registry.VerifyResponse, error) {
+	if err := auth.RequireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	report, err := s.verifier.Verify(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &registry.VerifyResponse{Report: toVerificationReport(report)}, nil
+}
+
+func (s *registryService) GetVerificationReport(ctx context.Context, req *registry.GetVerificationReportRequest) (*registry.GetVerificationReportResponse, error) {
+	if err := auth.RequireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	report, err := s.verifier.Report(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if report == nil {
+		return nil, status.Errorf(codes.NotFound, "no verification has finished yet")
+	}
+	return &registry.GetVerificationReportResponse{Report: toVerificationReport(report)}, nil
+}
+
+func (s *registryService) GetNameAllowList(ctx context.Context, req *registry.GetNameAllowListRequest) (*registry.GetNameAllowListResponse, error) {
+	if err := auth.RequireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	urls, err := s.registry.NameAllowList(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &registry.GetNameAllowListResponse{Urls: urls}, nil
+}
+
+func (s *registryService) UpdateNameAllowList(ctx context.Context, req *registry.UpdateNameAllowListRequest) (*registry.UpdateNameAllowListResponse, error) {
+	if err := auth.RequireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	if err := s.registry.UpdateNameAllowList(ctx, req.Add, req.Remove); err != nil {
+		return nil, err
+	}
+	return &registry.UpdateNameAllowListResponse{}, nil
+}
+
+func (s *registryService) ListNameReviews(ctx context.Context, req *registry.ListNameReviewsRequest) (*registry.ListNameReviewsResponse, error) {
+	if err := auth.RequireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	reviews, err := s.registry.NameReviews(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res := &registry.ListNameReviewsResponse{}
+	for _, review := range reviews {
+		conflicts := make([]*registry.NameConflict, len(review.Conflicts))
+		for i, c := range review.Conflicts {
+			conflicts[i] = &registry.NameConflict{
+				Name:   c.Name,
+				Url:    c.URL,
+				Reason: c.Reason,
+			}
+		}
+		res.Reviews = append(res.Reviews, &registry.NameReview{
+			Url:         review.URL,
+			Version:     review.Version,
+			Name:        review.Name,
+			Conflicts:   conflicts,
+			RequestedAt: timestamppb.New(review.RequestedAt),
+			RequestedBy: review.RequestedBy,
+		})
+	}
+	return res, nil
+}
+
+func (s *registryService) ResolveNameReview(ctx context.Context, req *registry.ResolveNameReviewRequest) (*registry.ResolveNameReviewResponse, error) {
+	if err := auth.RequireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	if err := s.registry.ResolveNameReview(ctx, req.Url, req.Version, req.Approve); err != nil {
+		return nil, err
+	}
+	return &registry.ResolveNameReviewResponse{}, nil
+}
+
+func (s *registryService) ListAuditEvents(ctx context.Context, req *registry.ListAuditEventsRequest) (*registry.ListAuditEventsResponse, error) {
+	if err := auth.RequireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	filter := controllers.AuditFilter{URL: req.Url}
+	if req.Since != nil {
+		filter.Since = req.Since.AsTime()
+	}
+	if req.Until != nil {
+		filter.Until = req.Until.AsTime()
+	}
+	events, next, err := s.audit.List(ctx, filter, int(req.PageSize), req.PageToken)
+	if err != nil {
+		return nil, err
+	}
+	res := &registry.ListAuditEventsResponse{NextPageToken: next}
+	for _, e := range events {
+		res.Events = append(res.Events, &registry.AuditEvent{
+			Id:         e.ID,
+			Time:       timestamppb.New(e.Time),
+			Identity:   e.Identity,
+			RemoteAddr: e.RemoteAddr,
+			Operation:  e.Operation,
+			Url:        e.URL,
+			Arguments:  e.Arguments,
+			Outcome:    e.Outcome,
+			Error:      e.Error,
+			Commit:     e.Commit,
+			Duration:   durationpb.New(e.Duration),
+		})
+	}
+	return res, nil
+}
+
+// defaultWebhookDeliveriesLimit is the number of deliveries returned if the
+// request has no limit.
+const defaultWebhookDeliveriesLimit = 100
+
+func (s *registryService) ListWebhookDeliveries(ctx context.Context, req *registry.ListWebhookDeliveriesRequest) (*registry.ListWebhookDeliveriesResponse, error) {
+	if err := auth.RequireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	limit := int(req.Limit)
+	if limit <= 0 {
+		limit = defaultWebhookDeliveriesLimit
+	}
+	deliveries, err := s.webhooks.Deliveries(ctx, req.Subscription, limit)
+	if err != nil {
+		return nil, err
+	}
+	res := &registry.ListWebhookDeliveriesResponse{}
+	for _, d := range deliveries {
+		delivery := &registry.WebhookDelivery{
+			Id:             d.ID,
+			Subscription:   d.Subscription,
+			Event:          toChangeEvent(d.Event),
+			Status:         string(d.Status),
+			Attempts:       int32(d.Attempts),
+			CreatedAt:      timestamppb.New(d.CreatedAt),
+			LastStatusCode: int32(d.LastStatusCode),
+			LastError:      d.LastError,
+		}
+		if !d.NextAttempt.IsZero() {
+			delivery.NextAttempt = timestamppb.New(d.NextAttempt)
+		}
+		if !d.LastAttempt.IsZero() {
+			delivery.LastAttempt = timestamppb.New(d.LastAttempt)
+		}
+		res.Deliveries = append(res.Deliveries, delivery)
+	}
+	return res, nil
+}
+
+func (s *registryService) ExportSnapshot(ctx context.Context, req *registry.ExportSnapshotRequest) (*registry.ExportSnapshotResponse, error) {
+	if err := auth.RequireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	snapshot, err := s.registry.Snapshot(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := snapshot.Write(&buf); err != nil {
+		return nil, err
+	}
+	return &registry.ExportSnapshotResponse{Snapshot: buf.Bytes()}, nil
+}
+
+func (s *registryService) ImportSnapshot(ctx context.Context, req *registry.ImportSnapshotRequest) (*registry.ImportSnapshotResponse, error) {
+	if err := auth.RequireAdmin(ctx); err != nil {
+		return nil, err
+	}
+	snapshot, err := controllers.ReadSnapshot(bytes.NewReader(req.Snapshot))
+	if err != nil {
+		return nil, err
+	}
+	if err := s.registry.ImportSnapshot(ctx, snapshot); err != nil {
+		return nil, err
+	}
+	return &registry.ImportSnapshotResponse{}, nil
+}
+
+func (s *registryService) ListOwners(ctx context.Context, req *registry.ListOwnersRequest) (*registry.ListOwnersResponse, error) {
+	owners, err := s.registry.Owners(ctx, req.Url)
+	if err != nil {
+		return nil, err
+	}
+	res := &registry.ListOwnersResponse{}
+	for _, o := range owners {
+		res.Owners = append(res.Owners, &registry.Owner{
+			Identity: o.Identity,
+			Method:   o.Method,
+			AddedBy:  o.AddedBy,
+			AddedAt:  timestamppb.New(o.AddedAt),
+		})
+	}
+	return res, nil
+}
+
+func (s *registryService) AddOwner(ctx context.Context, req *registry.AddOwnerRequest) (*registry.AddOwnerResponse, error) {
+	if err := s.registry.AddOwner(ctx, req.Url, req.Identity); err != nil {
+		return nil, err
+	}
+	return &registry.AddOwnerResponse{}, nil
+}
+
+func (s *registryService) RemoveOwner(ctx context.Context, req *registry.RemoveOwnerRequest) (*registry.RemoveOwnerResponse, error) {
+	if err := s.registry.RemoveOwner(ctx, req.Url, req.Identity); err != nil {
+		return nil, err
+	}
+	return &registry.RemoveOwnerResponse{}, nil
+}
+
+func (s *registryService) CreateOwnershipChallenge(ctx context.Context, req *registry.CreateOwnershipChallengeRequest) (*registry.CreateOwnershipChallengeResponse, error) {
+	token, err := s.registry.OwnershipChallenge(ctx, req.Url)
+	if err != nil {
+		return nil, err
+	}
+	return &registry.CreateOwnershipChallengeResponse{
+		Token: token,
+		File:  controllers.OwnershipChallengeFile,
+	}, nil
+}
+
+func (s *registryService) VerifyOwnershipChallenge(ctx context.Context, req *registry.VerifyOwnershipChallengeRequest) (*registry.VerifyOwnershipChallengeResponse, error) {
+	if err := s.registry.VerifyOwnershipChallenge(ctx, req.Url); err != nil {
+		return nil, err
+	}
+	return &registry.VerifyOwnershipChallengeResponse{}, nil
+}
+
+func toVerificationReport(report *controllers.VerificationReport) *registry.VerificationReport {
+	issues := make([]*registry.VersionIssue, len(report.Issues))
+	for i, issue := range report.Issues {
+		kind := registry.VersionIssue_UNKNOWN
+		switch issue.Kind {
+		case controllers.IssueTagDeleted:
+			kind = registry.VersionIssue_TAG_DELETED
+		case controllers.IssueTagMoved:
+			kind = registry.VersionIssue_TAG_MOVED
+		}
+		issues[i] = &registry.VersionIssue{
+			Url:          issue.URL,
+			Version:      issue.Version,
+			Kind:         kind,
+			RecordedHash: issue.RecordedHash,
+			RemoteHash:   issue.RemoteHash,
+			DetectedAt:   timestamppb.New(issue.DetectedAt),
+		}
+	}
+	return &registry.VerificationReport{
+		StartedAt:  timestamppb.New(report.StartedAt),
+		FinishedAt: timestamppb.New(report.FinishedAt),
+		Checked:    int32(report.Checked),
+		Issues:     issues,
+		Errors:     report.Errors,
+	}
 }
 
 func provideCache(config *config.Config, ui tpkg.UI) tpkg.Cache {
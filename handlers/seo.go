@@ -0,0 +1,178 @@
+// Copyright (C) 2026 Toitware ApS. All rights reserved.
+// Use of this source code is governed by an MIT-style license that can be
+// found in the LICENSE file.
+
+package handlers
+
+import (
+	"encoding/xml"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/toitlang/tpkg/pkg/tpkg"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	sitemapNamespace  = "http://www.sitemaps.org/schemas/sitemap/0.9"
+	sitemapDateFormat = "2006-01-02"
+	siteName          = "Toit package registry"
+)
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+type sitemapURLSet struct {
+	XMLName   xml.Name     `xml:"urlset"`
+	Namespace string       `xml:"xmlns,attr"`
+	URLs      []sitemapURL `xml:"url"`
+}
+
+func lastMod(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(sitemapDateFormat)
+}
+
+// sitemap lists the pages and doc roots of all packages and their versions
+// that aren't yanked.
+func (h *httpHandlers) sitemap(rw http.ResponseWriter, r *http.Request) error {
+	packages, err := h.registry.Packages(r.Context())
+	if err != nil {
+		return err
+	}
+	base := h.publicURL
+	res := sitemapURLSet{Namespace: sitemapNamespace}
+	for _, p := range packages {
+		url := base + "/" + p.Latest().URL
+		updated := lastMod(p.UpdatedAt())
+		res.URLs = append(res.URLs,
+			sitemapURL{Loc: url, LastMod: updated},
+			sitemapURL{Loc: url + "/docs/", LastMod: updated})
+		for _, d := range p.Descriptions {
+			if p.IsYanked(d.Version) {
+				continue
+			}
+			var published string
+			if release, ok := p.Releases[d.Version]; ok {
+				published = lastMod(release.Time)
+			}
+			url := fmt.Sprintf("%s/%s@%s", base, d.URL, d.Version)
+			res.URLs = append(res.URLs,
+				sitemapURL{Loc: url, LastMod: published},
+				sitemapURL{Loc: url + "/docs/", LastMod: published})
+		}
+	}
+
+	rw.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	if _, err := rw.Write([]byte(xml.Header)); err != nil {
+		return err
+	}
+	return xml.NewEncoder(rw).Encode(&res)
+}
+
+// pageMetadata is the metadata injected in the index.html of package pages.
+type pageMetadata struct {
+	Title       string
+	Description string
+	Canonical   string
+}
+
+var (
+	titleRegexp           = regexp.MustCompile(`(?is)<title>.*?</title>`)
+	descriptionMetaRegexp = regexp.MustCompile(`(?is)<meta\s+name="description"[^>]*>`)
+	headEndRegexp         = regexp.MustCompile(`(?i)</head>`)
+)
+
+// injectMetadata replaces the title and description of the HTML page, and
+// adds the canonical URL and OpenGraph tags.
+func injectMetadata(body []byte, meta *pageMetadata) []byte {
+	title := html.EscapeString(meta.Title)
+	description := html.EscapeString(meta.Description)
+	canonical := html.EscapeString(meta.Canonical)
+
+	body = titleRegexp.ReplaceAllLiteral(body, nil)
+	body = descriptionMetaRegexp.ReplaceAllLiteral(body, nil)
+	tags := fmt.Sprintf(`<title>%[1]s</title>
+<meta name="description" content="%[2]s">
+<link rel="canonical" href="%[3]s">
+<meta property="og:type" content="website">
+<meta property="og:site_name" content="%[4]s">
+<meta property="og:title" content="%[1]s">
+<meta property="og:description" content="%[2]s">
+<meta property="og:url" content="%[3]s">
+`, title, description, canonical, siteName)
+
+	loc := headEndRegexp.FindIndex(body)
+	if loc == nil {
+		return append([]byte(tags), body...)
+	}
+	res := append([]byte{}, body[:loc[0]]...)
+	res = append(res, tags...)
+	return append(res, body[loc[0]:]...)
+}
+
+// packageMetadata returns the metadata of the page of the package version.
+// The latest version's page is the package page.
+func packageMetadata(base string, desc *tpkg.Desc, latest bool) *pageMetadata {
+	res := &pageMetadata{
+		Title:       fmt.Sprintf("%s %s | %s", desc.Name, desc.Version, siteName),
+		Description: desc.Description,
+		Canonical:   fmt.Sprintf("%s/%s@%s", base, desc.URL, desc.Version),
+	}
+	if latest {
+		res.Title = fmt.Sprintf("%s | %s", desc.Name, siteName)
+		res.Canonical = base + "/" + desc.URL
+	}
+	if res.Description == "" {
+		res.Description = fmt.Sprintf("The Toit package %s.", desc.URL)
+	}
+	return res
+}
+
+// packagePage serves the index.html of the web page with the metadata of
+// the package, if the path is a package page, '<url>' or '<url>@<version>'.
+// Returns false if it isn't.
+func (h *httpHandlers) packagePage(rw http.ResponseWriter, r *http.Request, p string) (bool, error) {
+	if p == "" {
+		return false, nil
+	}
+	// Files of the web page take precedence.
+	if _, err := os.Stat(filepath.Join(h.webFilePath, p)); err == nil {
+		return false, nil
+	}
+
+	url, version, _ := parsePackage(p)
+	pkg, err := h.registry.Package(r.Context(), url)
+	if status.Code(err) == codes.NotFound {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	desc := pkg.Latest()
+	if version != "" {
+		var ok bool
+		if desc, ok = pkg.Lookup[version]; !ok {
+			return false, nil
+		}
+	}
+
+	body, err := ioutil.ReadFile(filepath.Join(h.webFilePath, "index.html"))
+	if err != nil {
+		return false, err
+	}
+	body = injectMetadata(body, packageMetadata(h.publicURL, desc, version == ""))
+	rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, err = rw.Write(body)
+	return true, err
+}
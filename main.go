@@ -5,22 +5,126 @@
 package main
 
 import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
 	"github.com/toitware/tpkg/config"
 	"github.com/toitware/tpkg/controllers"
 	"github.com/toitware/tpkg/handlers"
+	"github.com/toitware/tpkg/pkg/auth"
 	"github.com/toitware/tpkg/pkg/network"
+	"github.com/toitware/tpkg/pkg/readme"
 	"github.com/toitware/tpkg/pkg/service"
 	"github.com/toitware/tpkg/pkg/toitdoc"
+	"go.uber.org/dig"
 	"go.uber.org/fx"
 )
 
 func main() {
-	fx.New(
+	root := &cobra.Command{
+		Use:   "registry",
+		Short: "The Toit package registry",
+		Long:  "The Toit package registry. Starts the server if no command is given.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return serve()
+		},
+		SilenceUsage: true,
+	}
+	root.AddCommand(
+		&cobra.Command{
+			Use:   "serve",
+			Short: "Start the server",
+			Args:  cobra.NoArgs,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				return serve()
+			},
+		},
+		syncCmd(),
+		registerCmd(),
+		validateCmd(),
+		docsCmd(),
+		configCmd(),
+		snapshotCmd(),
+	)
+	if err := root.Execute(); err != nil {
+		os.Exit(1)
+	}
+}
+
+// serve runs the server until it is stopped. Returns the error if the
+// application can't be constructed, like an invalid configuration.
+func serve() error {
+	app := fx.New(
+		// Must run before the controllers are constructed.
+		fx.Invoke(checkConfig),
 		config.Module,
 		handlers.Module,
 		service.Module,
 		network.Module,
 		controllers.Module,
 		toitdoc.Module,
-	).Run()
+		readme.Module,
+		auth.Module,
+	)
+	if err := app.Err(); err != nil {
+		return dig.RootCause(err)
+	}
+	app.Run()
+	return nil
+}
+
+// runCommand constructs the controllers without the servers and invokes f,
+// which may return an error. The application isn't started, so nothing runs
+// in the background. The options are applied first.
+func runCommand(f interface{}, options ...fx.Option) error {
+	app := fx.New(append(options,
+		// Must run before the controllers are constructed.
+		fx.Invoke(disableStores),
+		config.Module,
+		handlers.TpkgModule,
+		service.Module,
+		controllers.Module,
+		toitdoc.Module,
+		readme.Module,
+		auth.Module,
+		fx.Invoke(f),
+		fx.NopLogger,
+	)...)
+	if err := app.Err(); err != nil {
+		return dig.RootCause(err)
+	}
+	return nil
+}
+
+// commandContext returns the context of the commands, with the identity of
+// the operator.
+func commandContext() context.Context {
+	return auth.NewContext(context.Background(), operator)
+}
+
+// checkConfig checks that the paths and binaries of the configuration are
+// usable by the server. The configuration is only probed once, reloads just
+// validate the values.
+func checkConfig(cfg *config.Config) error {
+	return cfg.Check()
+}
+
+// disableStores turns off the statistics and webhooks of commands. Their
+// stores are locked by a running server. Commands append to their own audit
+// log, as the IDs of the events are only unique within one writer.
+func disableStores(cfg *config.Config) {
+	cfg.Stats.Path = ""
+	cfg.Webhooks.Subscriptions = nil
+	if cfg.Audit.Path != "" {
+		ext := filepath.Ext(cfg.Audit.Path)
+		cfg.Audit.Path = strings.TrimSuffix(cfg.Audit.Path, ext) + "-cli" + ext
+	}
 }
+
+// operator is the identity of commands. They are run by operators of the
+// registry, who have full access.
+var operator = &auth.Identity{Name: "cli", Admin: true}
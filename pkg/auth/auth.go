@@ -0,0 +1,176 @@
+// Copyright (C) 2026 Toitware ApS. All rights reserved.
+// Use of this source code is governed by an MIT-style license that can be
+// found in the LICENSE file.
+
+// Package auth maps the bearer tokens of the auth.tokens configuration to the
+// identities of callers. The gRPC interceptors attach the identity to the
+// context of every request; handlers and controllers only read it.
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/toitware/tpkg/config"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Identity is the caller of a request.
+type Identity struct {
+	Name  string
+	Admin bool
+}
+
+// Anonymous is the identity of callers that didn't provide a token.
+var Anonymous = &Identity{}
+
+func (i *Identity) IsAnonymous() bool {
+	return i.Name == ""
+}
+
+type identityKey struct{}
+
+// NewContext returns a context that carries the given identity.
+func NewContext(ctx context.Context, identity *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// FromContext returns the identity of the caller, or Anonymous.
+func FromContext(ctx context.Context) *Identity {
+	if identity, ok := ctx.Value(identityKey{}).(*Identity); ok {
+		return identity
+	}
+	return Anonymous
+}
+
+// RequireAdmin returns an error if the caller isn't an administrator.
+func RequireAdmin(ctx context.Context) error {
+	identity := FromContext(ctx)
+	if identity.IsAnonymous() {
+		return status.Error(codes.Unauthenticated, "authentication required")
+	}
+	if !identity.Admin {
+		return status.Errorf(codes.PermissionDenied, "'%s' is not an administrator", identity.Name)
+	}
+	return nil
+}
+
+type token struct {
+	value    []byte
+	identity *Identity
+}
+
+type Authenticator struct {
+	mutex  sync.RWMutex
+	tokens []token
+}
+
+func provideAuthenticator(cfg *config.Config, watcher *config.Watcher) *Authenticator {
+	res := NewAuthenticator(cfg.Auth)
+	watcher.Subscribe(func(change *config.Change) {
+		if change.Changed("auth") {
+			res.SetTokens(change.New.Auth)
+		}
+	})
+	return res
+}
+
+func NewAuthenticator(cfg config.Auth) *Authenticator {
+	res := &Authenticator{}
+	res.SetTokens(cfg)
+	return res
+}
+
+// SetTokens replaces the accepted tokens.
+func (a *Authenticator) SetTokens(cfg config.Auth) {
+	var tokens []token
+	for _, t := range cfg.Tokens {
+		if t.Token == "" {
+			continue
+		}
+		tokens = append(tokens, token{
+			value: []byte(t.Token),
+			identity: &Identity{
+				Name:  t.Identity,
+				Admin: t.Admin,
+			},
+		})
+	}
+	a.mutex.Lock()
+	a.tokens = tokens
+	a.mutex.Unlock()
+}
+
+// Authenticate returns the identity for the given bearer token.
+// An empty token authenticates as Anonymous.
+func (a *Authenticator) Authenticate(bearer string) (*Identity, error) {
+	if bearer == "" {
+		return Anonymous, nil
+	}
+	a.mutex.RLock()
+	tokens := a.tokens
+	a.mutex.RUnlock()
+	for _, t := range tokens {
+		if subtle.ConstantTimeCompare(t.value, []byte(bearer)) == 1 {
+			return t.identity, nil
+		}
+	}
+	return nil, status.Error(codes.Unauthenticated, "invalid token")
+}
+
+// FromRequest authenticates the caller of a plain HTTP request.
+func (a *Authenticator) FromRequest(r *http.Request) (*Identity, error) {
+	return a.Authenticate(bearerToken(r.Header.Get("Authorization")))
+}
+
+func (a *Authenticator) authenticateContext(ctx context.Context) (context.Context, error) {
+	var header string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("authorization"); len(values) > 0 {
+			header = values[0]
+		}
+	}
+	identity, err := a.Authenticate(bearerToken(header))
+	if err != nil {
+		return nil, err
+	}
+	return NewContext(ctx, identity), nil
+}
+
+func (a *Authenticator) UnaryServerInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := a.authenticateContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (a *Authenticator) StreamServerInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := a.authenticateContext(ss.Context())
+	if err != nil {
+		return err
+	}
+	return handler(srv, &authenticatedStream{ServerStream: ss, ctx: ctx})
+}
+
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+func bearerToken(header string) string {
+	if parts := strings.SplitN(header, " ", 2); len(parts) == 2 && strings.EqualFold(parts[0], "bearer") {
+		return strings.TrimSpace(parts[1])
+	}
+	return ""
+}
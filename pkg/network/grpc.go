@@ -10,20 +10,23 @@ import (
 	"time"
 
 	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	"github.com/toitware/tpkg/pkg/auth"
 	"github.com/uber-go/tally"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
 )
 
-func provideGRPCServer(logger *zap.Logger, scope tally.Scope) *grpc.Server {
+func provideGRPCServer(logger *zap.Logger, scope tally.Scope, authenticator *auth.Authenticator) *grpc.Server {
 	i := newInterceptor(logger, scope)
 	s := grpc.NewServer(
 		grpc.MaxRecvMsgSize(math.MaxInt32),
 		grpc.StreamInterceptor(grpc_middleware.ChainStreamServer(
 			grpc.StreamServerInterceptor(i.streamServerInterceptor),
+			grpc.StreamServerInterceptor(authenticator.StreamServerInterceptor),
 		)),
 		grpc.UnaryInterceptor(grpc_middleware.ChainUnaryServer(
 			grpc.UnaryServerInterceptor(i.unaryServerInterceptor),
+			grpc.UnaryServerInterceptor(authenticator.UnaryServerInterceptor),
 		)),
 	)
 
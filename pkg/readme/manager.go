@@ -0,0 +1,247 @@
+// Copyright (C) 2026 Toitware ApS. All rights reserved.
+// Use of this source code is governed by an MIT-style license that can be
+// found in the LICENSE file.
+
+package readme
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/toitlang/tpkg/pkg/tpkg"
+	"github.com/toitware/tpkg/config"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	readmeFileName    = "README.md"
+	changelogFileName = "CHANGELOG.md"
+)
+
+// Readme contains the README and CHANGELOG of a package version.
+// The markdown is empty if the package doesn't have the file.
+type Readme struct {
+	Readme        []byte
+	ReadmeHTML    []byte
+	Changelog     []byte
+	ChangelogHTML []byte
+}
+
+// ErrRateLimited is returned by Get if the files aren't cached, and too many
+// downloads happened recently.
+var ErrRateLimited = errors.New("too many readme downloads")
+
+type Manager interface {
+	// Get returns the README and CHANGELOG of the package at its registered
+	// commit. They are downloaded the first time, unless Store has been called.
+	// The downloads are rate limited, see ErrRateLimited.
+	Get(ctx context.Context, desc *tpkg.Desc) (*Readme, error)
+	// Store caches the README and CHANGELOG of the package from a checkout of
+	// its repository.
+	Store(desc *tpkg.Desc, repoDir string) error
+}
+
+type manager struct {
+	logger   *zap.Logger
+	cfg      config.Readmes
+	ui       tpkg.UI
+	markdown goldmark.Markdown
+	policy   *bluemonday.Policy
+	group    singleflight.Group
+
+	// The downloads of the current minute.
+	limitMutex  sync.Mutex
+	limitWindow time.Time
+	downloads   int
+}
+
+func provideManager(logger *zap.Logger, cfg *config.Config, ui tpkg.UI) (*manager, Manager) {
+	res := newManager(logger, cfg.Readmes, ui)
+	return res, res
+}
+
+func newManager(logger *zap.Logger, cfg config.Readmes, ui tpkg.UI) *manager {
+	return &manager{
+		logger:   logger,
+		cfg:      cfg,
+		ui:       ui,
+		markdown: goldmark.New(goldmark.WithExtensions(extension.GFM)),
+		policy:   bluemonday.UGCPolicy(),
+	}
+}
+
+// cachePath returns the directory of the extracted files of the package.
+func (m *manager) cachePath(desc *tpkg.Desc) string {
+	return filepath.Join(m.cfg.CachePath, tpkg.URLVersionToRelPath(desc.URL, desc.Version))
+}
+
+func (m *manager) Get(ctx context.Context, desc *tpkg.Desc) (*Readme, error) {
+	path := m.cachePath(desc)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		// Concurrent requests for the same version share the download. It
+		// must not be canceled when the first of them gives up.
+		ch := m.group.DoChan(path, func() (interface{}, error) {
+			ctx, cancel := context.WithTimeout(context.Background(), m.cfg.DownloadTimeout)
+			defer cancel()
+			return nil, m.download(ctx, desc)
+		})
+		select {
+		case res := <-ch:
+			if res.Err != nil {
+				return nil, res.Err
+			}
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	readme, err := readOptional(filepath.Join(path, readmeFileName))
+	if err != nil {
+		return nil, err
+	}
+	changelog, err := readOptional(filepath.Join(path, changelogFileName))
+	if err != nil {
+		return nil, err
+	}
+	res := &Readme{
+		Readme:    readme,
+		Changelog: changelog,
+	}
+	if res.ReadmeHTML, err = m.render(readme); err != nil {
+		return nil, err
+	}
+	if res.ChangelogHTML, err = m.render(changelog); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (m *manager) download(ctx context.Context, desc *tpkg.Desc) error {
+	// Another request might have finished the download in the meantime.
+	if _, err := os.Stat(m.cachePath(desc)); err == nil {
+		return nil
+	}
+	if !m.allowDownload() {
+		return ErrRateLimited
+	}
+	tmpDir, err := ioutil.TempDir("", "readme-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	repoDir := filepath.Join(tmpDir, "repo")
+	if _, err := tpkg.DownloadGit(ctx, tpkg.DownloadGitOptions{
+		Directory:  repoDir,
+		URL:        desc.URL,
+		Version:    desc.Version,
+		Hash:       desc.Hash,
+		UI:         m.ui,
+		NoReadOnly: true,
+	}); err != nil {
+		return err
+	}
+	return m.Store(desc, repoDir)
+}
+
+// allowDownload returns whether another download fits into the limit of the
+// current minute.
+func (m *manager) allowDownload() bool {
+	m.limitMutex.Lock()
+	defer m.limitMutex.Unlock()
+	now := time.Now()
+	if now.Sub(m.limitWindow) >= time.Minute {
+		m.limitWindow = now
+		m.downloads = 0
+	}
+	if m.downloads >= m.cfg.MaxDownloadsPerMinute {
+		return false
+	}
+	m.downloads++
+	return true
+}
+
+func (m *manager) Store(desc *tpkg.Desc, repoDir string) error {
+	path := m.cachePath(desc)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	// Fill a temporary directory next to the destination, so readers never
+	// see a partial result.
+	tmpDir, err := ioutil.TempDir(filepath.Dir(path), ".readme-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	for _, name := range []string{readmeFileName, changelogFileName} {
+		content, err := findFile(repoDir, name)
+		if err != nil {
+			return err
+		}
+		if content == nil {
+			continue
+		}
+		if err := ioutil.WriteFile(filepath.Join(tmpDir, name), content, 0644); err != nil {
+			return err
+		}
+	}
+
+	if err := os.Rename(tmpDir, path); err != nil {
+		if _, statErr := os.Stat(path); statErr == nil {
+			// Stored concurrently.
+			return nil
+		}
+		return err
+	}
+	m.logger.Debug("stored readme", zap.String("url", desc.URL), zap.String("version", desc.Version))
+	return nil
+}
+
+// render converts the markdown to HTML that is safe to embed in a page.
+func (m *manager) render(markdown []byte) ([]byte, error) {
+	if len(markdown) == 0 {
+		return nil, nil
+	}
+	var buf bytes.Buffer
+	if err := m.markdown.Convert(markdown, &buf); err != nil {
+		return nil, err
+	}
+	return m.policy.SanitizeBytes(buf.Bytes()), nil
+}
+
+// findFile returns the content of the file in the top-level directory,
+// ignoring the case of its name. Returns nil if there is no such file.
+func findFile(dir string, name string) ([]byte, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		if f.Mode().IsRegular() && strings.EqualFold(f.Name(), name) {
+			return ioutil.ReadFile(filepath.Join(dir, f.Name()))
+		}
+	}
+	return nil, nil
+}
+
+func readOptional(path string) ([]byte, error) {
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return content, err
+}
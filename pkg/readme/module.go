@@ -0,0 +1,13 @@
+// Copyright (C) 2026 Toitware ApS. All rights reserved.
+// Use of this source code is governed by an MIT-style license that can be
+// found in the LICENSE file.
+
+package readme
+
+import "go.uber.org/fx"
+
+var Module = fx.Options(
+	fx.Provide(
+		provideManager,
+	),
+)
@@ -28,7 +28,7 @@ func ensureFxLogger(printer fx.Printer, err error) fx.Printer {
 	return printer
 }
 
-func provideLogger(cfg *config.Config) (*zap.Logger, error) {
+func provideLogger(cfg *config.Config) (*zap.Logger, zap.AtomicLevel, error) {
 	zapCfg := zap.NewProductionConfig()
 
 	var options []zap.Option
@@ -38,13 +38,11 @@ func provideLogger(cfg *config.Config) (*zap.Logger, error) {
 	case "humio":
 		// Nothing, use production out of the box.
 	default:
-		return nil, fmt.Errorf("unknown logging backend: '%s'", cfg.Logging.Backend)
+		return nil, zapCfg.Level, fmt.Errorf("unknown logging backend: '%s'", cfg.Logging.Backend)
 	}
 
-	if level := cfg.Logging.Level; level != "" {
-		if err := zapCfg.Level.UnmarshalText([]byte(level)); err != nil {
-			return nil, err
-		}
+	if err := setLogLevel(zapCfg.Level, cfg.Logging); err != nil {
+		return nil, zapCfg.Level, err
 	}
 
 	zapCfg.InitialFields = map[string]interface{}{}
@@ -54,7 +52,7 @@ func provideLogger(cfg *config.Config) (*zap.Logger, error) {
 
 	logger, err := zapCfg.Build(options...)
 	if err != nil {
-		return nil, err
+		return nil, zapCfg.Level, err
 	}
 
 	logger.Info("started")
@@ -62,5 +60,33 @@ func provideLogger(cfg *config.Config) (*zap.Logger, error) {
 	zap.ReplaceGlobals(logger)
 	zap.RedirectStdLog(logger)
 
-	return logger, nil
+	return logger, zapCfg.Level, nil
+}
+
+// setLogLevel sets the configured level, or the default level of the
+// backend.
+func setLogLevel(level zap.AtomicLevel, cfg config.Logging) error {
+	if cfg.Level == "" {
+		if cfg.Backend == "" {
+			level.SetLevel(zap.DebugLevel)
+		} else {
+			level.SetLevel(zap.InfoLevel)
+		}
+		return nil
+	}
+	return level.UnmarshalText([]byte(cfg.Level))
+}
+
+// watchLogLevel applies changes of the log level without a restart.
+func watchLogLevel(watcher *config.Watcher, level zap.AtomicLevel, logger *zap.Logger) {
+	watcher.Subscribe(func(c *config.Change) {
+		if !c.Changed("logging.level") {
+			return
+		}
+		if err := setLogLevel(level, c.New.Logging); err != nil {
+			logger.Error("failed to set the log level", zap.Error(err))
+			return
+		}
+		logger.Info("changed the log level", zap.Stringer("level", level.Level()))
+	})
 }
@@ -18,6 +18,7 @@ var Module = fx.Options(
 	),
 	fx.Invoke(
 		loadTally,
+		watchLogLevel,
 	),
 	debug.Module,
 	fx.Logger(ensureFxLogger(fxLogger())),
@@ -15,6 +15,7 @@ import (
 
 	"github.com/toitlang/tpkg/pkg/tpkg"
 	"github.com/toitware/tpkg/config"
+	"github.com/toitware/tpkg/pkg/readme"
 	"go.uber.org/zap"
 )
 
@@ -26,18 +27,20 @@ type manager struct {
 	generator *generator
 	cfg       config.Toitdocs
 	ui        tpkg.UI
+	readmes   readme.Manager
 
 	toitdocs map[pkgIdentifier]*toitdoc
 	loading  map[pkgIdentifier]*loader
 }
 
-func provideManager(logger *zap.Logger, tpkgManager *tpkg.Manager, generator *generator, cfg *config.Config, ui tpkg.UI) (*manager, Manager, error) {
+func provideManager(logger *zap.Logger, tpkgManager *tpkg.Manager, generator *generator, cfg *config.Config, ui tpkg.UI, readmes readme.Manager) (*manager, Manager, error) {
 	res := &manager{
 		logger:    logger,
 		manager:   tpkgManager,
 		generator: generator,
 		cfg:       cfg.Toitdocs,
 		ui:        ui,
+		readmes:   readmes,
 		toitdocs:  map[pkgIdentifier]*toitdoc{},
 		loading:   map[pkgIdentifier]*loader{},
 	}
@@ -46,6 +49,12 @@ func provideManager(logger *zap.Logger, tpkgManager *tpkg.Manager, generator *ge
 
 type Manager interface {
 	Get(ctx context.Context, desc *tpkg.Desc) (Doc, error)
+	// Built returns whether the docs of the package are generated, without
+	// generating them.
+	Built(desc *tpkg.Desc) bool
+	// GC removes the generated docs of all versions that aren't in keep, and
+	// returns the number of removed versions.
+	GC(keep []*tpkg.Desc) (int, error)
 }
 
 type pkgIdentifier struct {
@@ -125,7 +134,7 @@ func (l *loader) start(desc *tpkg.Desc, mgr *manager) (doc *toitdoc, err error)
 		l.close(doc, err)
 	}()
 
-	path := filepath.Join(mgr.cfg.CachePath, tpkg.URLVersionToRelPath(desc.URL, desc.Version))
+	path := mgr.cachePath(desc)
 	// If the directory already exists, we just reuse it.
 	if stat, err := os.Stat(path); err == nil && stat.IsDir() {
 		return &toitdoc{desc: desc, path: path}, nil
@@ -153,6 +162,12 @@ func (l *loader) start(desc *tpkg.Desc, mgr *manager) (doc *toitdoc, err error)
 		return nil, err
 	}
 
+	// Cache the README while we have the checkout. The readme manager
+	// downloads it on demand if this fails.
+	if err := mgr.readmes.Store(desc, repoDir); err != nil {
+		mgr.logger.Warn("failed to store readme", zap.String("url", desc.URL), zap.String("version", desc.Version), zap.Error(err))
+	}
+
 	// Download dependent packages.
 	projectPaths, err := tpkg.NewProjectPaths(repoDir, "", "")
 	if err != nil {
@@ -235,6 +250,68 @@ func (m *manager) Get(ctx context.Context, desc *tpkg.Desc) (Doc, error) {
 	return m.load(ctx, desc, ident)
 }
 
+func (m *manager) Built(desc *tpkg.Desc) bool {
+	m.RLock()
+	_, ok := m.toitdocs[descIdentifier(desc)]
+	m.RUnlock()
+	if ok {
+		return true
+	}
+	stat, err := os.Stat(m.cachePath(desc))
+	return err == nil && stat.IsDir()
+}
+
+func (m *manager) GC(keep []*tpkg.Desc) (int, error) {
+	kept := map[string]bool{}
+	for _, desc := range keep {
+		kept[m.cachePath(desc)] = true
+	}
+
+	var remove []string
+	err := filepath.Walk(m.cfg.CachePath, func(path string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		// Generated docs are directories with a toitdoc file.
+		if _, err := os.Stat(filepath.Join(path, toitdocPath)); err != nil {
+			return nil
+		}
+		if !kept[path] {
+			remove = append(remove, path)
+		}
+		return filepath.SkipDir
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	m.Lock()
+	for ident, doc := range m.toitdocs {
+		if !kept[doc.path] {
+			delete(m.toitdocs, ident)
+		}
+	}
+	m.Unlock()
+
+	for i, path := range remove {
+		m.logger.Info("removing docs", zap.String("path", path))
+		if err := os.RemoveAll(path); err != nil {
+			return i, err
+		}
+	}
+	return len(remove), nil
+}
+
+// cachePath returns the directory of the generated docs of the package.
+func (m *manager) cachePath(desc *tpkg.Desc) string {
+	return filepath.Join(m.cfg.CachePath, tpkg.URLVersionToRelPath(desc.URL, desc.Version))
+}
+
 func (m *manager) load(ctx context.Context, desc *tpkg.Desc, ident pkgIdentifier) (*toitdoc, error) {
 	m.Lock()
 	loader, ok := m.loading[ident]
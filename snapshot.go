@@ -0,0 +1,90 @@
+// Copyright (C) 2026 Toitware ApS. All rights reserved.
+// Use of this source code is governed by an MIT-style license that can be
+// found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/toitware/tpkg/controllers"
+)
+
+func snapshotCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "snapshot",
+		Short: "Export and import snapshots of the registry",
+	}
+
+	var output string
+	exportCmd := &cobra.Command{
+		Use:   "export",
+		Short: "Write a snapshot of the registry",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runCommand(func(registry controllers.Registry) error {
+				ctx := commandContext()
+				if err := registry.Sync(ctx); err != nil {
+					return err
+				}
+				snapshot, err := registry.Snapshot(ctx)
+				if err != nil {
+					return err
+				}
+				if output == "-" {
+					return snapshot.Write(os.Stdout)
+				}
+				f, err := os.Create(output)
+				if err != nil {
+					return err
+				}
+				if err := snapshot.Write(f); err != nil {
+					f.Close()
+					return err
+				}
+				return f.Close()
+			})
+		},
+	}
+	exportCmd.Flags().StringVarP(&output, "output", "o", "-", "the file to write the snapshot to, '-' for stdout")
+
+	importCmd := &cobra.Command{
+		Use:   "import <file>",
+		Short: "Import a snapshot into a registry without packages",
+		Long: `Import a snapshot into a registry without packages.
+
+Commits all versions with their original registration time and author to the
+configured registry repository, which may be empty. Use '-' to read the
+snapshot from stdin.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var in io.Reader = os.Stdin
+			if args[0] != "-" {
+				f, err := os.Open(args[0])
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				in = f
+			}
+			snapshot, err := controllers.ReadSnapshot(in)
+			if err != nil {
+				return err
+			}
+			return runCommand(func(registry controllers.Registry) error {
+				ctx := commandContext()
+				if err := registry.ImportSnapshot(ctx, snapshot); err != nil {
+					return err
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "Imported %d packages\n", len(snapshot.Packages))
+				return nil
+			})
+		},
+	}
+
+	cmd.AddCommand(exportCmd, importCmd)
+	return cmd
+}